@@ -0,0 +1,62 @@
+package directio
+
+import "time"
+
+const (
+	// adaptiveBurst is how soon after the previous one a buffer full flush
+	// must come for WithAdaptiveBuffer to grow the buffer.
+	adaptiveBurst = 50 * time.Millisecond
+
+	// adaptiveIdle is how long without a buffer full flush makes
+	// WithAdaptiveBuffer shrink the buffer back.
+	adaptiveIdle = 2 * time.Second
+)
+
+// WithAdaptiveBuffer lets the writer resize its buffer to the rate of the
+// stream. The buffer doubles, up to max bytes, every time it fills up again
+// shortly after the previous flush, so a fast stream ends up writing in
+// large requests. When the writer then sits idle for a while, the buffer
+// returns to the size given to the constructor at the next Write. Thousands
+// of slow streams thus only hold small buffers.
+func WithAdaptiveBuffer(max int) Option {
+	return func(d *DirectIO) {
+		d.adaptMax = max
+	}
+}
+
+// adaptFlush grows the buffer after a buffer full flush that came soon
+// after the previous one. The buffer is empty at that point.
+func (d *DirectIO) adaptFlush() {
+	if d.adaptMax <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if d.adaptMin == 0 {
+		d.adaptMin = len(d.buf)
+	}
+
+	if !d.lastFull.IsZero() && now.Sub(d.lastFull) < adaptiveBurst && d.n == 0 {
+		if size := alignUp(min(2*len(d.buf), d.adaptMax), d.blockSize); size > len(d.buf) {
+			// Keep the current buffer if a larger one can't be had.
+			d.replaceBuf(size)
+		}
+	}
+
+	d.lastFull = now
+}
+
+// adaptIdle shrinks the buffer back to its initial size if no buffer full
+// flush happened for a while.
+func (d *DirectIO) adaptIdle() {
+	if d.adaptMax <= 0 || d.adaptMin == 0 || len(d.buf) == d.adaptMin {
+		return
+	}
+	if time.Since(d.lastFull) < adaptiveIdle || d.n > d.adaptMin {
+		return
+	}
+
+	if d.replaceBuf(d.adaptMin) == nil {
+		d.lastFull = time.Time{}
+	}
+}
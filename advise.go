@@ -0,0 +1,38 @@
+package directio
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Advice is an access pattern hint given to the kernel with Advise.
+type Advice int
+
+const (
+	// AdviceNormal drops any previous advice.
+	AdviceNormal Advice = unix.FADV_NORMAL
+
+	// AdviceSequential announces sequential reads, widening readahead.
+	AdviceSequential Advice = unix.FADV_SEQUENTIAL
+
+	// AdviceRandom announces random reads, disabling readahead.
+	AdviceRandom Advice = unix.FADV_RANDOM
+
+	// AdviceWillNeed starts reading the range into the page cache.
+	AdviceWillNeed Advice = unix.FADV_WILLNEED
+
+	// AdviceDontNeed drops the clean cached pages of the range.
+	AdviceDontNeed Advice = unix.FADV_DONTNEED
+
+	// AdviceNoReuse announces that the data is accessed once.
+	AdviceNoReuse Advice = unix.FADV_NOREUSE
+)
+
+// Advise gives advice about the length bytes of f at off to the kernel
+// with posix_fadvise(2). A length of 0 means up to the end of the file.
+// O_DIRECT I/O doesn't go through the page cache, but pipelines mixing it
+// with buffered access still benefit from these hints.
+func Advise(f *os.File, off, length int64, advice Advice) error {
+	return unix.Fadvise(int(f.Fd()), off, length, int(advice))
+}
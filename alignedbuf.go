@@ -0,0 +1,100 @@
+package directio
+
+import (
+	"errors"
+	"io"
+)
+
+var _ io.Writer = (*AlignedBuffer)(nil)
+
+// AlignedBuffer is a bytes.Buffer like staging area whose storage is block
+// aligned in memory and grows by whole blocks, e.g. to assemble records and
+// hand them to a writer in one Write taking the zero-copy path.
+type AlignedBuffer struct {
+	buf       []byte
+	n         int
+	blockSize int
+}
+
+// NewAlignedBuffer returns an empty buffer aligned to blockSize, typically
+// the BlockSize of the writer it is for, holding size bytes before growing.
+func NewAlignedBuffer(blockSize, size int) (*AlignedBuffer, error) {
+	if blockSize <= 0 || blockSize&(blockSize-1) != 0 {
+		return nil, errors.New("block size must be a power of two")
+	}
+	if size < blockSize {
+		size = blockSize
+	}
+
+	buf, err := allocAlignedBuf(blockSize, alignUp(size, blockSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AlignedBuffer{buf: buf, blockSize: blockSize}, nil
+}
+
+// Write appends p to the buffer, growing it as needed.
+func (b *AlignedBuffer) Write(p []byte) (int, error) {
+	if err := b.grow(len(p)); err != nil {
+		return 0, err
+	}
+
+	n := copy(b.buf[b.n:], p)
+	b.n += n
+
+	return n, nil
+}
+
+// WriteString is Write for a string.
+func (b *AlignedBuffer) WriteString(s string) (int, error) {
+	if err := b.grow(len(s)); err != nil {
+		return 0, err
+	}
+
+	n := copy(b.buf[b.n:], s)
+	b.n += n
+
+	return n, nil
+}
+
+// grow makes room for n more bytes, moving the data to a larger aligned
+// storage at least twice as big if needed.
+func (b *AlignedBuffer) grow(n int) error {
+	if b.n+n <= len(b.buf) {
+		return nil
+	}
+
+	buf, err := allocAlignedBuf(b.blockSize, alignUp(max(2*len(b.buf), b.n+n), b.blockSize))
+	if err != nil {
+		return err
+	}
+	copy(buf, b.buf[:b.n])
+	b.buf = buf
+
+	return nil
+}
+
+// Len returns the number of bytes in the buffer.
+func (b *AlignedBuffer) Len() int { return b.n }
+
+// Cap returns the size of the storage of the buffer, a multiple of the
+// block size.
+func (b *AlignedBuffer) Cap() int { return len(b.buf) }
+
+// Bytes returns the data in the buffer. It starts on a block boundary and
+// is valid until the next Write or Reset.
+func (b *AlignedBuffer) Bytes() []byte { return b.buf[:b.n] }
+
+// Padded zero pads the data to a whole number of blocks and returns it, so
+// that all of it can take the zero-copy path of a writer, e.g. with
+// WithStrictAlignment. The padding isn't part of Len.
+func (b *AlignedBuffer) Padded() []byte {
+	size := alignUp(b.n, b.blockSize)
+	clear(b.buf[b.n:size])
+
+	return b.buf[:size]
+}
+
+// Reset empties the buffer, keeping its storage.
+func (b *AlignedBuffer) Reset() { b.n = 0 }
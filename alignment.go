@@ -0,0 +1,127 @@
+package directio
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// AlignmentSource tells where an alignment was taken from.
+type AlignmentSource int
+
+const (
+	// AlignmentFallback is the default used when nothing could be asked,
+	// 4096 unless SetDefaults changed it.
+	AlignmentFallback AlignmentSource = iota
+
+	// AlignmentStatx is the direct I/O alignment reported by statx
+	// (STATX_DIOALIGN, Linux 6.1 and later).
+	AlignmentStatx
+
+	// AlignmentSectorSize is the sector size of the device, read with the
+	// BLKSSZGET/BLKPBSZGET ioctls or from sysfs.
+	AlignmentSectorSize
+
+	// AlignmentStatfs is the filesystem block size reported by statfs.
+	AlignmentStatfs
+)
+
+func (s AlignmentSource) String() string {
+	switch s {
+	case AlignmentStatx:
+		return "statx"
+	case AlignmentSectorSize:
+		return "sector size"
+	case AlignmentStatfs:
+		return "statfs"
+	default:
+		return "fallback"
+	}
+}
+
+func GetBestAlignment(path string) int {
+	a, _ := Alignment(path)
+
+	return a
+}
+
+// Alignment returns the block size GetBestAlignment picks for path and the
+// source it came from. The sources are tried in order: statx DIOALIGN, which
+// is what the kernel actually enforces, the sector size of the device, the
+// block size of the filesystem and finally the fallback alignment, 4096
+// unless SetDefaults changed it.
+func Alignment(path string) (int, AlignmentSource) {
+	if a := statxAlignment(path); a > 0 {
+		_, physical := pathSectorSizes(path)
+		return preferPhysical(a, physical), AlignmentStatx
+	}
+
+	// Ensure we check the directory if the file doesn't exist yet
+	checkPath := path
+	if info, err := os.Stat(path); err != nil || (!info.IsDir() && !isBlockDevice(info)) {
+		checkPath = filepath.Dir(path)
+	}
+
+	if logical, physical := pathSectorSizes(checkPath); logical > 0 {
+		return preferPhysical(logical, physical), AlignmentSectorSize
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(checkPath, &stat); err != nil {
+		// Fallback: 4KB is the safest bet for almost all modern Linux servers
+		return config().FallbackAlignment, AlignmentFallback
+	}
+
+	return statfsAlignment(int(stat.Bsize)), AlignmentStatfs
+}
+
+// fdAlignment is Alignment for an open file descriptor.
+func fdAlignment(fd uintptr) (int, AlignmentSource) {
+	logical, physical := fdSectorSizes(fd)
+
+	if a := statxAlignmentFd(fd); a > 0 {
+		return preferPhysical(a, physical), AlignmentStatx
+	}
+
+	if logical > 0 {
+		return preferPhysical(logical, physical), AlignmentSectorSize
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Fstatfs(int(fd), &stat); err != nil {
+		return config().FallbackAlignment, AlignmentFallback
+	}
+
+	return statfsAlignment(int(stat.Bsize)), AlignmentStatfs
+}
+
+// preferPhysical raises the minimal alignment a to the physical sector size.
+//
+// Remember that it's always best to use the disk's PHY-SEC and not its LOG-SEC (you can check that using `lsblk -o NAME,PHY-SEC,LOG-SEC`). The disk's LOG-SEC is an emulated value which exists so the disk can support older kernel versions.
+// statx and BLKSSZGET report the LOG-SEC in most cases, and using it results in Read-Modify-Write cycles on short-sized writes.
+func preferPhysical(a, physical int) int {
+	if physical > a {
+		return physical
+	}
+
+	return a
+}
+
+// statfsAlignment turns a filesystem block size, usually 4096 on
+// ext4/xfs/btrfs, into an alignment.
+func statfsAlignment(blockSize int) int {
+	// O_DIRECT usually requires at least 512.
+	// If Statfs returns something weird (like 0 or 1), force 4096.
+	if blockSize < 512 {
+		return 4096
+	}
+
+	// Optimization: If the FS says 512, but we are on a 4Kn drive,
+	// 512 writes will be slow (Read-Modify-Write).
+	// It is almost always better to upgrade 512 -> 4096.
+	if blockSize < 4096 {
+		return 4096
+	}
+
+	return blockSize
+}
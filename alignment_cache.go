@@ -0,0 +1,76 @@
+package directio
+
+import (
+	"sync"
+	"syscall"
+)
+
+// fileAlignment is the alignment detected for the files of one device.
+type fileAlignment struct {
+	blockSize   int
+	offsetAlign int
+	source      AlignmentSource
+}
+
+// unit returns the granularity file offsets and lengths must be aligned to:
+// the offset alignment when known, otherwise the block size.
+func (a fileAlignment) unit() int {
+	if a.offsetAlign <= 0 || a.offsetAlign > a.blockSize {
+		return a.blockSize
+	}
+
+	return a.offsetAlign
+}
+
+// alignmentCache holds the alignment detected per device, so that creating
+// a writer doesn't have to ask statx, sysfs and statfs every time.
+var alignmentCache struct {
+	sync.RWMutex
+	devs map[uint64]fileAlignment
+}
+
+// InvalidateAlignmentCache drops the alignments cached by NewSize. Call it
+// after remounting a filesystem or swapping the device under a mountpoint.
+func InvalidateAlignmentCache() {
+	alignmentCache.Lock()
+	alignmentCache.devs = nil
+	alignmentCache.Unlock()
+}
+
+// cachedFdAlignment returns the alignment of the regular file open at fd,
+// from the cache if the device it lives on was seen before.
+func cachedFdAlignment(fd uintptr) fileAlignment {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(fd), &st); err != nil {
+		return detectFdAlignment(fd)
+	}
+	dev := uint64(st.Dev)
+
+	alignmentCache.RLock()
+	a, ok := alignmentCache.devs[dev]
+	alignmentCache.RUnlock()
+	if ok {
+		return a
+	}
+
+	a = detectFdAlignment(fd)
+
+	alignmentCache.Lock()
+	if alignmentCache.devs == nil {
+		alignmentCache.devs = make(map[uint64]fileAlignment)
+	}
+	alignmentCache.devs[dev] = a
+	alignmentCache.Unlock()
+
+	return a
+}
+
+func detectFdAlignment(fd uintptr) fileAlignment {
+	blockSize, source := fdAlignment(fd)
+
+	return fileAlignment{
+		blockSize:   blockSize,
+		offsetAlign: offsetAlignment(fd),
+		source:      source,
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+// fileDev returns the device f lives on.
+func fileDev(t *testing.T, f *os.File) uint64 {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &st); err != nil {
+		t.Fatal(err)
+	}
+
+	return uint64(st.Dev)
+}
+
+func TestAlignmentCache(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	InvalidateAlignmentCache()
+	defer InvalidateAlignmentCache()
+
+	var dev uint64
+	newWriter := func(prefix string) *DirectIO {
+		f := tmpFile(t, dir, prefix)
+		t.Cleanup(func() { f.Close() })
+		dev = fileDev(t, f)
+		dio, err := New(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dio
+	}
+
+	// The first writer detects the alignment and caches it for its device.
+	first := newWriter("cache-first")
+	alignmentCache.RLock()
+	cached, ok := alignmentCache.devs[dev]
+	alignmentCache.RUnlock()
+	if !ok {
+		t.Fatal("alignment wasn't cached")
+	}
+	if cached.blockSize != first.BlockSize() || cached.source != first.AlignmentSource() {
+		t.Fatalf("cached %d (%v), the writer uses %d (%v)", cached.blockSize, cached.source, first.BlockSize(), first.AlignmentSource())
+	}
+
+	// Later writers on the same device take the cached entry as is, so a
+	// planted one shows whether detection ran again.
+	planted := fileAlignment{blockSize: 2 * cached.blockSize, source: AlignmentFallback}
+	alignmentCache.Lock()
+	alignmentCache.devs[dev] = planted
+	alignmentCache.Unlock()
+
+	if second := newWriter("cache-second"); second.BlockSize() != planted.blockSize || second.AlignmentSource() != planted.source {
+		t.Fatalf("second writer uses %d (%v), want the cached %d (%v)", second.BlockSize(), second.AlignmentSource(), planted.blockSize, planted.source)
+	}
+
+	// Another device has an entry of its own.
+	if other, err := os.MkdirTemp("/dev/shm", "directio-test-"); err == nil {
+		defer os.RemoveAll(other)
+		f := tmpFile(t, other, "cache-other")
+		defer f.Close()
+		if _, err := New(f); err == nil {
+			alignmentCache.RLock()
+			_, ok := alignmentCache.devs[fileDev(t, f)]
+			n := len(alignmentCache.devs)
+			alignmentCache.RUnlock()
+			if !ok || n != 2 {
+				t.Fatalf("%d cached devices, want 2", n)
+			}
+		}
+	}
+
+	// Invalidating forces a new detection.
+	InvalidateAlignmentCache()
+	if third := newWriter("cache-third"); third.BlockSize() != cached.blockSize || third.AlignmentSource() != cached.source {
+		t.Fatalf("after invalidation the writer uses %d (%v), want %d (%v)", third.BlockSize(), third.AlignmentSource(), cached.blockSize, cached.source)
+	}
+	alignmentCache.RLock()
+	a := alignmentCache.devs[dev]
+	alignmentCache.RUnlock()
+	if a != cached {
+		t.Fatalf("cache holds %+v after invalidation, want %+v", a, cached)
+	}
+}
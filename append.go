@@ -0,0 +1,86 @@
+package directio
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrAppendMode is returned for a file opened with O_APPEND, unless the
+// writer is created with WithAppend.
+var ErrAppendMode = errors.New("file is opened with O_APPEND")
+
+// WithAppend lets the writer take a file opened with O_APPEND. Every write
+// to such a file lands at its end whatever the file offset, so the writer
+// starts at the end of the file, which must meet the direct I/O alignment,
+// and tracks it from there. The writer must then be the only one appending
+// to the file: data appended behind its back shifts everything it writes
+// after, and breaks the tail handling of Close.
+//
+// Without it, the writer refuses such files with ErrAppendMode, instead of
+// writing from an offset that has nothing to do with where the data lands.
+func WithAppend(enabled bool) Option {
+	return func(d *DirectIO) {
+		d.allowAppend = enabled
+	}
+}
+
+// checkAppend reports whether the writer is on a file in append mode, and
+// fails if that isn't allowed.
+func (d *DirectIO) checkAppend() (bool, error) {
+	if !appendMode(d.f.Fd()) {
+		return false, nil
+	}
+	if !d.allowAppend {
+		return true, ErrAppendMode
+	}
+
+	return true, nil
+}
+
+// NewAppend returns a writer appending to the data f already holds, f being
+// opened read-write with O_DIRECT, but not O_APPEND. The file doesn't need to end on a
+// block boundary: its partial last block is read back into the buffer, and
+// rewritten along with the data that follows it. Only the new data counts
+// in Stats, LogicalOffset and the limits of the writer, but the tees of
+// WithTee see the partial block again.
+func NewAppend(f *os.File, opts ...Option) (*DirectIO, error) {
+	if appendMode(f.Fd()) {
+		return nil, ErrAppendMode
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	d, err := NewSize(f, 0, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	unit := int64(d.blockSize)
+	if d.offsetAlign > 0 && d.offsetAlign < d.blockSize {
+		unit = int64(d.offsetAlign)
+	}
+	head := size % unit
+
+	if _, err := d.Seek(size-head, io.SeekStart); err != nil {
+		d.release()
+		return nil, err
+	}
+	if head > 0 {
+		if _, err := ReadFullAt(f, d.buf[:head], size-head); err != nil {
+			d.release()
+			return nil, err
+		}
+		// The head isn't new data: flushed catches up once it is rewritten.
+		d.n = int(head)
+		d.flushed = -head
+	}
+
+	return d, nil
+}
@@ -0,0 +1,127 @@
+package directio
+
+import (
+	"errors"
+	"sync"
+)
+
+// Arena hands out aligned blocks of one size carved out of a few large
+// mmap(2) slabs, and recycles the blocks given back through a free list. It
+// is meant for programs juggling many pages, like a storage engine managing
+// its own cache, that can't afford an allocation per block. An Arena is
+// safe for concurrent use.
+type Arena struct {
+	blockSize int
+	slabSize  int
+	advice    []BufferAdvice
+
+	mu      sync.Mutex
+	regions [][]byte
+	slab    []byte // what is left of the newest slab
+	free    [][]byte
+	inUse   int
+	closed  bool
+}
+
+// NewArena returns an arena of blocks of blockSize bytes, a power of two,
+// mapped slabSize bytes at a time. slabSize is rounded up to a multiple of
+// blockSize. advice is applied to the slabs, see WithBufferAdvice.
+func NewArena(blockSize, slabSize int, advice ...BufferAdvice) (*Arena, error) {
+	if blockSize <= 0 || blockSize&(blockSize-1) != 0 {
+		return nil, errors.New("block size must be a power of two")
+	}
+	if slabSize < blockSize {
+		slabSize = blockSize
+	}
+
+	return &Arena{
+		blockSize: blockSize,
+		slabSize:  alignUp(slabSize, blockSize),
+		advice:    advice,
+	}, nil
+}
+
+// BlockSize returns the size, and alignment, of the blocks of the arena.
+func (a *Arena) BlockSize() int { return a.blockSize }
+
+// Get returns a block, aligned to the block size. Its content is whatever
+// the last user left in it, zeroes for a block handed out the first time.
+func (a *Arena) Get() ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return nil, errors.New("the arena is closed")
+	}
+
+	if n := len(a.free); n > 0 {
+		b := a.free[n-1]
+		a.free = a.free[:n-1]
+		a.inUse++
+		return b, nil
+	}
+
+	if len(a.slab) == 0 {
+		slab, region, err := mapAdvisedBuf(a.blockSize, a.slabSize, a.advice)
+		if err != nil {
+			return nil, err
+		}
+		a.regions = append(a.regions, region)
+		a.slab = slab
+	}
+
+	// Cap the block, so appending to it can't spill into the next one.
+	b := a.slab[:a.blockSize:a.blockSize]
+	a.slab = a.slab[a.blockSize:]
+	a.inUse++
+
+	return b, nil
+}
+
+// Put gives back a block returned by Get, which must no longer be used.
+func (a *Arena) Put(b []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return
+	}
+
+	a.free = append(a.free, b[:a.blockSize:a.blockSize])
+	a.inUse--
+}
+
+// InUse returns the number of blocks handed out by Get and not given back.
+func (a *Arena) InUse() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.inUse
+}
+
+// Slabs returns the number of slabs mapped by the arena.
+func (a *Arena) Slabs() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.regions)
+}
+
+// Close unmaps the slabs. No block of the arena may be used afterwards,
+// including the ones not given back.
+func (a *Arena) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return errors.New("the arena is already closed")
+	}
+	a.closed = true
+
+	for _, region := range a.regions {
+		unmapBuf(region)
+	}
+	a.regions, a.slab, a.free = nil, nil, nil
+
+	return nil
+}
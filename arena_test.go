@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	a, err := NewArena(4096, 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// Two slabs' worth of blocks.
+	var blocks [][]byte
+	for i := 0; i < 32; i++ {
+		b, err := a.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) != 4096 || cap(b) != 4096 || align(b, 4096) != 0 {
+			t.Fatalf("block %d: len %d, cap %d, misaligned by %d", i, len(b), cap(b), align(b, 4096))
+		}
+		b[0] = byte(i)
+		blocks = append(blocks, b)
+	}
+	if a.Slabs() != 2 || a.InUse() != 32 {
+		t.Fatalf("%d slabs, %d blocks in use", a.Slabs(), a.InUse())
+	}
+	for i, b := range blocks {
+		if b[0] != byte(i) {
+			t.Fatalf("block %d was overwritten", i)
+		}
+	}
+
+	// Given back blocks are handed out again before mapping more.
+	a.Put(blocks[5])
+	if b, _ := a.Get(); &b[0] != &blocks[5][0] {
+		t.Fatal("the free block wasn't recycled")
+	}
+	if a.Slabs() != 2 {
+		t.Fatalf("%d slabs after recycling", a.Slabs())
+	}
+
+	// The blocks are good for direct I/O.
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "arena")
+	defer f.Close()
+
+	copy(blocks[0], bytes.Repeat([]byte{'a'}, 4096))
+	if _, err := PWriteAligned(f, blocks[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, blocks[0]) {
+		t.Fatal("file content mismatch")
+	}
+}
@@ -0,0 +1,119 @@
+package directio
+
+import "errors"
+
+// errNotSynced completes the writes of WriteAsync still pending when Close
+// fails.
+var errNotSynced = errors.New("the writer was closed before the data was synced")
+
+// pendingWrite is a write of WriteAsync waiting for its data to be synced.
+type pendingWrite struct {
+	// end is the value flushed reaches once the data is in the file.
+	end int64
+	n   int
+	cb  func(n int, err error)
+}
+
+// WriteAsync buffers p like Write and calls cb once the data of p is
+// durable, that is written to the file and synced. That happens at the next
+// sync of the file covering it: the ones of the sync policy and Checkpoint,
+// or those of Close and of the background flush of WithFlushInterval, which
+// sync whenever such writes are pending. Data kept in the buffer, like an
+// unaligned remainder, is only durable after Close.
+//
+// cb gets the number of bytes of p the writer accepted. If Write fails, or
+// the sync, cb is called with the error. cb runs on the goroutine syncing
+// the file, while the writer is locked, and must not use the writer.
+func (d *DirectIO) WriteAsync(p []byte, cb func(n int, err error)) {
+	d.lock()
+	defer d.unlock()
+
+	if d.isClosed {
+		cb(0, errors.New("the writer is closed"))
+		return
+	}
+
+	n, err := d.writeData(p)
+	if err != nil {
+		cb(n, err)
+		return
+	}
+
+	d.pending = append(d.pending, pendingWrite{end: d.flushed + int64(d.n), n: n, cb: cb})
+}
+
+// WriteHandle tracks a write of Submit until its data is durable.
+type WriteHandle struct {
+	done chan struct{}
+	n    int
+	err  error
+}
+
+// Submit is WriteAsync returning a handle instead of calling back, e.g. for
+// a service acknowledging each request once its payload is on disk. With
+// WithFlushInterval, the background flush also syncs the file while writes
+// are pending, so handles complete without further calls on the writer.
+func (d *DirectIO) Submit(p []byte) *WriteHandle {
+	h := &WriteHandle{done: make(chan struct{})}
+	d.WriteAsync(p, func(n int, err error) {
+		h.n, h.err = n, err
+		close(h.done)
+	})
+
+	return h
+}
+
+// Done returns a channel closed once the write completed.
+func (h *WriteHandle) Done() <-chan struct{} { return h.done }
+
+// Err returns the error of the write once Done is closed, nil before.
+func (h *WriteHandle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Await waits for the write to complete and returns the number of bytes
+// the writer accepted and its error.
+func (h *WriteHandle) Await() (int, error) {
+	<-h.done
+
+	return h.n, h.err
+}
+
+// sync syncs the file and completes the writes of WriteAsync it made
+// durable.
+func (d *DirectIO) sync() error {
+	err := d.f.Sync()
+
+	done := 0
+	for _, w := range d.pending {
+		if w.end > d.flushed {
+			break
+		}
+		w.cb(w.n, err)
+		done++
+	}
+	if done == len(d.pending) {
+		d.pending = nil
+	} else {
+		d.pending = d.pending[done:]
+	}
+
+	return err
+}
+
+// failPending completes the writes of WriteAsync still pending with err.
+func (d *DirectIO) failPending(err error) {
+	if err == nil {
+		err = errNotSynced
+	}
+
+	for _, w := range d.pending {
+		w.cb(w.n, err)
+	}
+	d.pending = nil
+}
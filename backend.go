@@ -0,0 +1,70 @@
+package directio
+
+import "os"
+
+var _ Backend = (*os.File)(nil)
+
+// Backend is what a DirectIO writer writes to. *os.File is the usual one,
+// see New. Other implementations may wrap a raw descriptor, or be test
+// doubles.
+//
+// A Backend may also implement DirectModeSetter, and the methods Stat,
+// Truncate and Seek of *os.File, which are used when present: Stat to detect
+// block devices, Truncate to cut the padding of TailPad and Seek to find the
+// starting offset.
+type Backend interface {
+	Write(p []byte) (int, error)
+	WriteAt(p []byte, off int64) (int, error)
+	Sync() error
+
+	// Fd returns the file descriptor, used for alignment detection and
+	// fcntl, fadvise and friends. Backends without one return ^uintptr(0).
+	Fd() uintptr
+}
+
+// DirectModeSetter is implemented by backends that track the O_DIRECT mode
+// themselves instead of through fcntl on Fd.
+type DirectModeSetter interface {
+	DirectMode() (bool, error)
+	SetDirectMode(enabled bool) error
+}
+
+type statter interface {
+	Stat() (os.FileInfo, error)
+}
+
+type truncater interface {
+	statter
+	Truncate(size int64) error
+}
+
+// NewBackend returns a DirectIO writer on b with a buffer of size bytes. b
+// must be in O_DIRECT mode.
+func NewBackend(b Backend, size int, opts ...Option) (*DirectIO, error) {
+	return newWriter(b, size, EngineDirect, opts)
+}
+
+// checkDirect returns an error if the backend isn't in O_DIRECT mode.
+func (d *DirectIO) checkDirect() error {
+	if m, ok := d.f.(DirectModeSetter); ok {
+		enabled, err := m.DirectMode()
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return ErrNotSetDirectIO
+		}
+		return nil
+	}
+
+	return checkDirectIO(d.f.Fd())
+}
+
+// setDirect switches the O_DIRECT mode of the backend.
+func (d *DirectIO) setDirect(enabled bool) error {
+	if m, ok := d.f.(DirectModeSetter); ok {
+		return m.SetDirectMode(enabled)
+	}
+
+	return setDirectIO(d.f.Fd(), enabled)
+}
@@ -0,0 +1,139 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// memBackend is a Backend keeping the data in memory and enforcing the
+// alignment of O_DIRECT writes.
+type memBackend struct {
+	t      *testing.T
+	data   []byte
+	direct bool
+	syncs  int
+}
+
+func (m *memBackend) Write(p []byte) (int, error) {
+	return m.WriteAt(p, int64(len(m.data)))
+}
+
+func (m *memBackend) WriteAt(p []byte, off int64) (int, error) {
+	if m.direct && (len(p)%512 != 0 || off%512 != 0 || align(p, 512) != 0) {
+		m.t.Errorf("unaligned O_DIRECT write of %d bytes at %d", len(p), off)
+	}
+	if end := int(off) + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+
+	return copy(m.data[off:], p), nil
+}
+
+func (m *memBackend) Sync() error                      { m.syncs++; return nil }
+func (m *memBackend) Fd() uintptr                      { return ^uintptr(0) }
+func (m *memBackend) DirectMode() (bool, error)        { return m.direct, nil }
+func (m *memBackend) SetDirectMode(enabled bool) error { m.direct = enabled; return nil }
+
+func TestBackend(t *testing.T) {
+	b := &memBackend{t: t, direct: true}
+
+	dio, err := NewBackend(b, 0, WithAlignment(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	for _, n := range writesizes {
+		p := bytes.Repeat([]byte{byte(n)}, n)
+		if _, err := dio.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, p...)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b.data, data) {
+		t.Fatalf("backend holds %d bytes, want %d", len(b.data), len(data))
+	}
+	if !b.direct {
+		t.Fatal("O_DIRECT mode was not restored")
+	}
+}
+
+func TestSyncPolicy(t *testing.T) {
+	data := bytes.Repeat([]byte("sync"), 1000)
+
+	for _, tc := range []struct {
+		name   string
+		policy SyncPolicy
+		syncs  int
+	}{
+		{"default", SyncPolicy{}, 1},
+		{"never", SyncNever, 0},
+		{"close", SyncOnClose, 1},
+		{"always", SyncAlways, 8 + 1},
+		{"every", SyncEvery(2048), 1 + 1},
+	} {
+		b := &memBackend{t: t, direct: true}
+		dio, err := NewBackend(b, 0, WithAlignment(512), WithSyncPolicy(tc.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 4000 bytes are 7 blocks and a tail, written in 8 flushes.
+		for i := 0; i < len(data); i += 500 {
+			if _, err := dio.Write(data[i : i+500]); err != nil {
+				t.Fatal(err)
+			}
+			dio.Flush()
+		}
+		if err := dio.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if b.syncs != tc.syncs {
+			t.Errorf("%s: %d syncs, want %d", tc.name, b.syncs, tc.syncs)
+		}
+	}
+}
+
+func TestAdaptiveBuffer(t *testing.T) {
+	b := &memBackend{t: t, direct: true}
+	dio, err := NewBackend(b, 0, WithAlignment(512), WithAdaptiveBuffer(256<<10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := len(dio.buf)
+
+	data := bytes.Repeat([]byte("adaptive"), 1<<17)
+	for i := 0; i < len(data); i += 1000 {
+		if _, err := dio.Write(data[i:min(i+1000, len(data))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(dio.buf) != 256<<10 {
+		t.Fatalf("buffer is %d bytes after a fast stream, want %d", len(dio.buf), 256<<10)
+	}
+
+	// Pretend the stream went quiet.
+	dio.lastFull = time.Now().Add(-2 * adaptiveIdle)
+	if _, err := dio.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if len(dio.buf) != initial {
+		t.Fatalf("buffer is %d bytes after idling, want %d", len(dio.buf), initial)
+	}
+
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.data, append(data, 'x')) {
+		t.Fatal("wrong bytes were written")
+	}
+}
@@ -0,0 +1,32 @@
+package directio
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrDeviceBounds is returned when a write would go past the end of the
+// block device the writer targets.
+var ErrDeviceBounds = errors.New("write past the end of the block device")
+
+// blockDevice holds the geometry of a block device.
+type blockDevice struct {
+	logical  int
+	physical int
+	size     int64
+}
+
+// alignment returns the block size to use for O_DIRECT on the device: the
+// physical sector size, so 512e drives don't end up doing read-modify-write.
+func (b blockDevice) alignment() int {
+	if b.physical >= b.logical && b.physical > 0 {
+		return b.physical
+	}
+
+	return b.logical
+}
+
+// isBlockDevice reports whether info describes a block device.
+func isBlockDevice(info os.FileInfo) bool {
+	return info.Mode()&os.ModeDevice != 0 && info.Mode()&os.ModeCharDevice == 0
+}
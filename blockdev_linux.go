@@ -0,0 +1,163 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// queryBlockDevice reads the sector sizes and the size of the block device
+// open at fd with the BLKSSZGET, BLKPBSZGET and BLKGETSIZE64 ioctls.
+func queryBlockDevice(fd uintptr) (blockDevice, error) {
+	var dev blockDevice
+
+	logical, err := unix.IoctlGetUint32(int(fd), unix.BLKSSZGET)
+	if err != nil {
+		return dev, err
+	}
+
+	physical, err := unix.IoctlGetUint32(int(fd), unix.BLKPBSZGET)
+	if err != nil {
+		return dev, err
+	}
+
+	var size uint64
+	if _, _, e1 := syscall.Syscall(syscall.SYS_IOCTL, fd, unix.BLKGETSIZE64, uintptr(unsafe.Pointer(&size))); e1 != 0 {
+		return dev, e1
+	}
+
+	dev.logical = int(logical)
+	dev.physical = int(physical)
+	dev.size = int64(size)
+
+	return dev, nil
+}
+
+// blkDiscard is BLKDISCARD, _IO(0x12, 119).
+const blkDiscard = 0x1277
+
+// discardDevice tells the block device open at fd that the length bytes at
+// off are unused, with the BLKDISCARD ioctl.
+func discardDevice(fd uintptr, off, length int64) error {
+	r := [2]uint64{uint64(off), uint64(length)}
+	if _, _, e1 := syscall.Syscall(syscall.SYS_IOCTL, fd, blkDiscard, uintptr(unsafe.Pointer(&r))); e1 != 0 {
+		return e1
+	}
+
+	return nil
+}
+
+// SectorSizes returns the logical and physical sector sizes of the device
+// holding f. For a block device they are read with the BLKSSZGET and
+// BLKPBSZGET ioctls. For a regular file they come from the queue limits of
+// the backing device in sysfs, or, for filesystems not backed by a single
+// block device, from the statx direct I/O offset alignment.
+func SectorSizes(f *os.File) (logical, physical int, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if isBlockDevice(info) {
+		dev, err := queryBlockDevice(f.Fd())
+		if err != nil {
+			return 0, 0, err
+		}
+		return dev.logical, dev.physical, nil
+	}
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if logical, physical = sysfsSectorSizes(uint64(st.Dev)); logical > 0 {
+			return logical, physical, nil
+		}
+	}
+
+	_, offsetAlign, err := DIOAlignmentFd(f.Fd())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(offsetAlign), int(offsetAlign), nil
+}
+
+// sysfsSectorSizes reads the sector sizes of the block device dev from
+// /sys/dev/block. Partitions have no queue directory of their own, their
+// parent's is used. It returns zeros if the device isn't a block device.
+func sysfsSectorSizes(dev uint64) (logical, physical int) {
+	base := fmt.Sprintf("/sys/dev/block/%d:%d/", unix.Major(dev), unix.Minor(dev))
+
+	for _, queue := range []string{base + "queue/", base + "../queue/"} {
+		logical = readSysfsInt(queue + "logical_block_size")
+		physical = readSysfsInt(queue + "physical_block_size")
+		if logical > 0 {
+			if physical < logical {
+				physical = logical
+			}
+			return logical, physical
+		}
+	}
+
+	return 0, 0
+}
+
+// pathSectorSizes returns the sector sizes of the block device at path, or
+// of the device holding the file at path. It returns zeros if they can't be
+// determined.
+func pathSectorSizes(path string) (logical, physical int) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, 0
+	}
+
+	if st.Mode&syscall.S_IFMT == syscall.S_IFBLK {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, 0
+		}
+		defer f.Close()
+
+		return fdSectorSizes(f.Fd())
+	}
+
+	return sysfsSectorSizes(uint64(st.Dev))
+}
+
+// fdSectorSizes is pathSectorSizes for an open file descriptor.
+func fdSectorSizes(fd uintptr) (logical, physical int) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(fd), &st); err != nil {
+		return 0, 0
+	}
+
+	if st.Mode&syscall.S_IFMT == syscall.S_IFBLK {
+		dev, err := queryBlockDevice(fd)
+		if err != nil {
+			return 0, 0
+		}
+		return dev.logical, dev.physical
+	}
+
+	return sysfsSectorSizes(uint64(st.Dev))
+}
+
+func readSysfsInt(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
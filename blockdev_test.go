@@ -0,0 +1,35 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import "testing"
+
+func TestSectorSizes(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "sectors")
+	defer f.Close()
+
+	logical, physical, err := SectorSizes(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logical < 512 || physical < logical {
+		t.Fatalf("SectorSizes = %d, %d", logical, physical)
+	}
+
+	a, source := Alignment(f.Name())
+	if a < physical {
+		t.Fatalf("Alignment = %d (%v), below the physical sector size %d", a, source, physical)
+	}
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dio.BlockSize() != a || dio.AlignmentSource() != source {
+		t.Fatalf("writer uses %d (%v), Alignment says %d (%v)", dio.BlockSize(), dio.AlignmentSource(), a, source)
+	}
+}
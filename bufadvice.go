@@ -0,0 +1,70 @@
+package directio
+
+// BufferAdvice is a madvise(2) hint for the aligned buffer of a writer.
+type BufferAdvice int
+
+const (
+	// BufferHugePage backs the buffer with transparent huge pages, cutting
+	// TLB misses for buffers of several megabytes.
+	BufferHugePage BufferAdvice = iota + 1
+
+	// BufferDontFork keeps the buffer out of child processes, so a fork
+	// doesn't make them share, and copy on write, a large buffer.
+	BufferDontFork
+
+	// BufferDontDump leaves the buffer out of core dumps.
+	BufferDontDump
+)
+
+// WithBufferAdvice applies advice to the buffer of the writer. The buffer is
+// then mapped on its own with mmap(2) instead of coming from the Go heap, so
+// that the advice only covers it, and is unmapped by Close.
+func WithBufferAdvice(advice ...BufferAdvice) Option {
+	return func(d *DirectIO) {
+		d.bufAdvice = append(d.bufAdvice, advice...)
+	}
+}
+
+// replaceBuf swaps the buffer for a new one of size bytes holding the
+// buffered data.
+func (d *DirectIO) replaceBuf(size int) error {
+	var (
+		buf    []byte
+		mapped []byte
+		err    error
+	)
+	if d.bufAdvice != nil {
+		buf, mapped, err = mapAdvisedBuf(d.blockSize, size, d.bufAdvice)
+	} else if d.pool != nil {
+		buf, err = d.pool.get(d.blockSize, size)
+	} else {
+		buf, err = allocAlignedBuf(d.blockSize, size)
+	}
+	if err != nil {
+		return err
+	}
+
+	copy(buf, d.buf[:d.n])
+	d.buf = buf
+
+	d.releaseBuf()
+	d.mapped = mapped
+
+	return nil
+}
+
+// releaseBuf unmaps the buffer of WithBufferAdvice.
+func (d *DirectIO) releaseBuf() {
+	if d.mapped != nil {
+		unmapBuf(d.mapped)
+		d.mapped = nil
+	}
+}
+
+// recycleBuf hands the buffer of a closed writer back to its pool.
+func (d *DirectIO) recycleBuf() {
+	if d.pool != nil && d.bufAdvice == nil {
+		d.pool.put(d.buf)
+		d.buf = nil
+	}
+}
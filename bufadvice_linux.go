@@ -0,0 +1,47 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import "golang.org/x/sys/unix"
+
+// mapAdvisedBuf maps an anonymous region holding a buffer of size bytes
+// aligned by blockSize, and applies advice to it. It returns the buffer and
+// the region to unmap.
+func mapAdvisedBuf(blockSize, size int, advice []BufferAdvice) (buf, region []byte, err error) {
+	region, err = unix.Mmap(-1, 0, size+blockSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, a := range advice {
+		var flag int
+		switch a {
+		case BufferHugePage:
+			flag = unix.MADV_HUGEPAGE
+		case BufferDontFork:
+			flag = unix.MADV_DONTFORK
+		case BufferDontDump:
+			flag = unix.MADV_DONTDUMP
+		default:
+			continue
+		}
+
+		if err := unix.Madvise(region, flag); err != nil {
+			unix.Munmap(region)
+			return nil, nil, err
+		}
+	}
+
+	off := 0
+	if a := align(region, blockSize); a != 0 {
+		off = blockSize - a
+	}
+
+	return region[off : off+size], region, nil
+}
+
+// unmapBuf unmaps a region returned by mapAdvisedBuf.
+func unmapBuf(region []byte) {
+	unix.Munmap(region)
+}
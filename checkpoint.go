@@ -0,0 +1,75 @@
+package directio
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrResumeBeyondEnd is returned by ResumeAt when the file is shorter than
+// the offset to resume at.
+var ErrResumeBeyondEnd = errors.New("resume offset is past the end of the file")
+
+// Checkpoint writes out the block aligned part of the buffered data, syncs
+// the file and returns the durable offset: the file offset up to which all
+// data written so far is on stable storage. The unaligned remainder stays
+// in the buffer. After a crash, the transfer can continue from that offset
+// with ResumeAt.
+func (d *DirectIO) Checkpoint() (int64, error) {
+	d.lock()
+	defer d.unlock()
+
+	if d.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+
+	err := d.flushAligned()
+	d.report()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := d.sync(); err != nil {
+		return 0, err
+	}
+
+	return d.off, nil
+}
+
+// ResumeAt returns a new DirectIO writer continuing an interrupted transfer
+// to f at off, an offset returned by Checkpoint. off must meet the direct
+// I/O offset alignment of f, and f must hold at least off bytes; whatever
+// lies past off wasn't checkpointed and is truncated away on regular files.
+// The caller then writes the source again from off.
+func ResumeAt(f *os.File, off int64, size int, opts ...Option) (*DirectIO, error) {
+	if off < 0 {
+		return nil, errNegativePosition
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().IsRegular() && info.Size() < off {
+		return nil, ErrResumeBeyondEnd
+	}
+
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// Validates off against the alignment before anything is cut.
+	d, err := NewSize(f, size, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Mode().IsRegular() && info.Size() > off {
+		if err := f.Truncate(off); err != nil {
+			d.release()
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
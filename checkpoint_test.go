@@ -0,0 +1,106 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	data := make([]byte, 300000)
+	for i := range data {
+		data[i] = byte(i % 239)
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "checkpoint")
+	dio, err := NewSize(f, 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dio.Write(data[:100001]); err != nil {
+		t.Fatal(err)
+	}
+	off, err := dio.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off == 0 || off > 100001 || off%int64(dio.BlockSize()) != 0 {
+		t.Fatalf("checkpoint at %d", off)
+	}
+
+	// Some more data reaches the file, then the transfer dies.
+	dio.Write(data[100001:200000])
+	f.Close()
+
+	g, err := os.OpenFile(f.Name(), os.O_WRONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	if _, err := ResumeAt(g, off+1, 0); err != ErrUnalignedOffset {
+		t.Fatalf("resume at an unaligned offset returned %v", err)
+	}
+	if _, err := ResumeAt(g, 1<<30, 0); err != ErrResumeBeyondEnd {
+		t.Fatalf("resume past the end returned %v", err)
+	}
+
+	dio, err = ResumeAt(g, off, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.Write(data[off:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("resumed file has %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestResumeTruncateError(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	// A read-only descriptor can't be truncated.
+	r, _ := readerFile(t, dir, 3*4096)
+	defer r.Close()
+
+	leaks := make(chan string, 1)
+	logf := func(format string, args ...any) {
+		select {
+		case leaks <- fmt.Sprintf(format, args...):
+		default:
+		}
+	}
+
+	if _, err := ResumeAt(r, 4096, 0, WithLeakCheck(logf)); err == nil {
+		t.Fatal("resume on a read-only file succeeded")
+	}
+
+	// The writer created before the truncation must have been closed.
+	for i := 0; i < 20; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(leaks) != 0 {
+		t.Fatalf("failed resume leaked its writer:\n%s", <-leaks)
+	}
+}
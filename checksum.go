@@ -0,0 +1,106 @@
+package directio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+// checksumMagic terminates a checksum trailer.
+const checksumMagic = "DIOC"
+
+var (
+	// ErrNoChecksumTrailer is returned by VerifyFile when the file doesn't end
+	// with a trailer written by WithChecksumTrailer.
+	ErrNoChecksumTrailer = errors.New("file has no checksum trailer")
+
+	// ErrChecksumMismatch is returned by VerifyFile when the data doesn't match
+	// the digest recorded in the trailer.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// checksumTrailer encodes the trailer appended by WithChecksumTrailer:
+// the digest, the length of the data it covers (8 bytes, big endian) and
+// the magic.
+func checksumTrailer(sum []byte, n int64) []byte {
+	b := make([]byte, len(sum)+8+len(checksumMagic))
+	copy(b, sum)
+	binary.BigEndian.PutUint64(b[len(sum):], uint64(n))
+	copy(b[len(sum)+8:], checksumMagic)
+
+	return b
+}
+
+// Sum returns the digest computed by WithChecksum. It is only available
+// after Close and is nil otherwise.
+func (d *DirectIO) Sum() []byte { return d.sum }
+
+// VerifyFile re-reads the file at path with O_DIRECT and checks the data
+// against the trailer appended by WithChecksumTrailer. h must be a fresh
+// hash of the same kind the file was written with.
+func VerifyFile(path string, h hash.Hash) error {
+	f, err := os.OpenFile(path, os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	trailerLen := h.Size() + 8 + len(checksumMagic)
+	if info.Size() < int64(trailerLen) {
+		return ErrNoChecksumTrailer
+	}
+	dataLen := info.Size() - int64(trailerLen)
+
+	blockSize := GetBestAlignment(path)
+	buf, err := allocAlignedBuf(blockSize, alignUp(defaultBufSize, blockSize))
+	if err != nil {
+		return err
+	}
+
+	h.Reset()
+	trailer := make([]byte, 0, trailerLen)
+
+	var off int64
+	for {
+		n, err := f.Read(buf)
+
+		chunk := buf[:n]
+		if off < dataLen {
+			data := chunk
+			if rest := dataLen - off; int64(len(data)) > rest {
+				data = data[:rest]
+			}
+			h.Write(data)
+			chunk = chunk[len(data):]
+		}
+		trailer = append(trailer, chunk...)
+		off += int64(n)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(trailer) != trailerLen || string(trailer[trailerLen-len(checksumMagic):]) != checksumMagic {
+		return ErrNoChecksumTrailer
+	}
+	if int64(binary.BigEndian.Uint64(trailer[h.Size():])) != dataLen {
+		return ErrNoChecksumTrailer
+	}
+	if !bytes.Equal(h.Sum(nil), trailer[:h.Size()]) {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package directio
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// WithChunkCallback cuts the data accepted by Write into chunks of size
+// bytes, at the logical offsets 0, size, 2*size and so on, hashes each with
+// a hash from newHash, SHA-256 if nil, and calls fn with the offset, length
+// and digest of every chunk as soon as it is complete, and of the last,
+// shorter one at Close or Finish. Backup and dedup tools can build their
+// chunk index this way in the same pass as writing. fn runs within Write,
+// so the chunk may not be on disk yet.
+func WithChunkCallback(size int64, newHash func() hash.Hash, fn func(off, n int64, sum []byte)) Option {
+	return func(d *DirectIO) {
+		if size <= 0 || fn == nil {
+			d.chunks = nil
+			return
+		}
+		if newHash == nil {
+			newHash = sha256.New
+		}
+		d.chunks = &chunker{size: size, h: newHash(), fn: fn}
+	}
+}
+
+// chunker is the state of WithChunkCallback: the chunk at off holds n bytes
+// so far, hashed by h.
+type chunker struct {
+	size int64
+	h    hash.Hash
+	fn   func(off, n int64, sum []byte)
+
+	off int64
+	n   int64
+}
+
+// write adds the data accepted by Write to the chunks.
+func (c *chunker) write(p []byte) {
+	for len(p) > 0 {
+		k := int(min(int64(len(p)), c.size-c.n))
+		c.h.Write(p[:k])
+		c.n += int64(k)
+		p = p[k:]
+
+		if c.n == c.size {
+			c.flush()
+		}
+	}
+}
+
+// flush reports the current chunk, if it holds anything, and starts the
+// next one.
+func (c *chunker) flush() {
+	if c.n == 0 {
+		return
+	}
+
+	c.fn(c.off, c.n, c.h.Sum(nil))
+	c.off += c.n
+	c.n = 0
+	c.h.Reset()
+}
+
+// reset starts over at offset 0, dropping the current chunk.
+func (c *chunker) reset() {
+	c.off, c.n = 0, 0
+	c.h.Reset()
+}
@@ -0,0 +1,161 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// CloneFile makes dst a reflink copy of src with the FICLONE ioctl, so the
+// copy shares its extents with the source and completes instantly on
+// filesystems supporting it, like btrfs and XFS. When cloning isn't possible
+// (another filesystem, no reflink support, ...) it falls back to CopyFile
+// with opts. It returns the number of bytes in dst. Like CopyFile, it
+// refuses a dst that is src itself, or a hard link to it.
+func CloneFile(dst, src string, opts ...CopyOption) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return CopyFile(dst, src, opts...)
+	}
+
+	out, err := createDst(dst, 0, info)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		out.Close()
+		return CopyFile(dst, src, opts...)
+	}
+
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		out.Close()
+		return 0, err
+	}
+
+	cfg := copyConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.sync {
+		if err := out.Sync(); err != nil {
+			out.Close()
+			return 0, err
+		}
+	}
+
+	return info.Size(), out.Close()
+}
+
+// ErrDedupeDiffers is returned by DedupeRange when the two ranges don't hold
+// the same data.
+var ErrDedupeDiffers = errors.New("dedupe ranges differ")
+
+// checkRangeAlignment validates the offsets and length of a range shared
+// between two files: they must be multiples of the block size, except that
+// length may reach the end of src.
+func checkRangeAlignment(src *os.File, srcOff, dstOff, length int64) error {
+	blockSize := int64(GetBestAlignment(src.Name()))
+	if srcOff%blockSize != 0 || dstOff%blockSize != 0 {
+		return errors.New("range offsets must be multiples of the block size")
+	}
+
+	if length%blockSize != 0 {
+		info, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		if srcOff+length != info.Size() {
+			return errors.New("range length must be a multiple of the block size")
+		}
+	}
+
+	return nil
+}
+
+// CloneRange shares length bytes at srcOff in src with dst at dstOff using
+// the FICLONERANGE ioctl. Offsets and length must be multiples of the block
+// size, except that length may reach the end of src. A length of zero clones
+// to the end of src.
+//
+// Unlike CloneFile there is no fallback: the ioctl error (typically
+// EOPNOTSUPP or EXDEV) is returned as is.
+func CloneRange(dst, src *os.File, srcOff, dstOff, length int64) error {
+	if err := checkRangeAlignment(src, srcOff, dstOff, length); err != nil {
+		return err
+	}
+
+	return unix.IoctlFileCloneRange(int(dst.Fd()), &unix.FileCloneRange{
+		Src_fd:      int64(src.Fd()),
+		Src_offset:  uint64(srcOff),
+		Src_length:  uint64(length),
+		Dest_offset: uint64(dstOff),
+	})
+}
+
+// DedupeRange asks the filesystem to share the length bytes at srcOff in src
+// with the identical bytes at dstOff in dst, using the FIDEDUPERANGE ioctl.
+// The kernel compares both ranges first and only shares them if they match,
+// otherwise ErrDedupeDiffers is returned. Offsets and length follow the
+// same alignment rules as CloneRange, and a length of zero also reaches the
+// end of src.
+//
+// Filesystems cap the size of a single request, so large ranges are
+// submitted in several calls. It returns the number of bytes deduplicated.
+func DedupeRange(dst, src *os.File, srcOff, dstOff, length int64) (int64, error) {
+	if err := checkRangeAlignment(src, srcOff, dstOff, length); err != nil {
+		return 0, err
+	}
+
+	if length == 0 {
+		info, err := src.Stat()
+		if err != nil {
+			return 0, err
+		}
+		length = info.Size() - srcOff
+	}
+
+	var done int64
+	for done < length {
+		req := &unix.FileDedupeRange{
+			Src_offset: uint64(srcOff + done),
+			Src_length: uint64(length - done),
+			Info: []unix.FileDedupeRangeInfo{{
+				Dest_fd:     int64(dst.Fd()),
+				Dest_offset: uint64(dstOff + done),
+			}},
+		}
+
+		if err := unix.IoctlFileDedupeRange(int(src.Fd()), req); err != nil {
+			return done, err
+		}
+
+		info := req.Info[0]
+		switch {
+		case info.Status == unix.FILE_DEDUPE_RANGE_DIFFERS:
+			return done, ErrDedupeDiffers
+		case info.Status < 0:
+			return done, syscall.Errno(-info.Status)
+		case info.Bytes_deduped == 0:
+			return done, errors.New("dedupe made no progress")
+		}
+
+		done += int64(info.Bytes_deduped)
+	}
+
+	return done, nil
+}
@@ -0,0 +1,217 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneData writes a file for the clone tests and returns its content.
+func cloneData(t *testing.T, path string, size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 239)
+	}
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// reflinks reports whether the filesystem of dir supports FICLONE.
+func reflinks(t *testing.T, dir string) bool {
+	a, err := os.Create(filepath.Join(dir, "reflink-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := os.Create(filepath.Join(dir, "reflink-b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	return unix.IoctlFileClone(int(b.Fd()), int(a.Fd())) == nil
+}
+
+func checkClone(t *testing.T, dst string, data []byte, n int64) {
+	t.Helper()
+
+	if n != int64(len(data)) {
+		t.Errorf("cloned %d bytes, want %d", n, len(data))
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("wrong bytes were cloned")
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func TestCloneFile(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	src := filepath.Join(dir, "clone-src")
+	data := cloneData(t, src, 100000)
+
+	// With reflinks, the ioctl path; without, the CopyFile fallback after
+	// EOPNOTSUPP. An existing, longer dst is replaced either way.
+	dst := filepath.Join(dir, "clone-dst")
+	if err := os.WriteFile(dst, bytes.Repeat([]byte{1}, 300000), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if !reflinks(t, dir) {
+		t.Log("no reflink support, testing the CopyFile fallback")
+	}
+	n, err := CloneFile(dst, src, CopySync(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkClone(t, dst, data, n)
+
+	// dst must not be src.
+	link := filepath.Join(dir, "clone-link")
+	if err := os.Link(src, link); err != nil {
+		t.Fatal(err)
+	}
+	for _, dst := range []string{src, link} {
+		if _, err := CloneFile(dst, src); !errors.Is(err, errSameFile) {
+			t.Errorf("clone of %s to itself: %v", filepath.Base(dst), err)
+		}
+	}
+	got, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("clone to itself changed the source")
+	}
+}
+
+func TestCloneFileCrossDevice(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	other, err := os.MkdirTemp("/dev/shm", "directio-test-")
+	if err != nil {
+		t.Skip("no /dev/shm:", err)
+	}
+	defer os.RemoveAll(other)
+
+	// FICLONE fails with EXDEV, the copy goes through the page cache on
+	// the tmpfs end.
+	src := filepath.Join(dir, "xdev-src")
+	data := cloneData(t, src, 70000)
+	dst := filepath.Join(other, "xdev-dst")
+	n, err := CloneFile(dst, src, CopyDirect(true, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkClone(t, dst, data, n)
+}
+
+func TestCloneRangeAlignment(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	src := filepath.Join(dir, "range-src")
+	cloneData(t, src, 5*65536+100)
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.Create(filepath.Join(dir, "range-dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	bs := int64(GetBestAlignment(src))
+	for _, r := range [][3]int64{
+		{1, 0, bs},
+		{0, 1, bs},
+		{0, 0, bs + 1},
+		{bs, bs, bs - 100},
+	} {
+		err := CloneRange(out, in, r[0], r[1], r[2])
+		if err == nil || errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EXDEV) {
+			t.Errorf("unaligned range %v: %v", r, err)
+		}
+	}
+
+	// A length reaching the end of src may be unaligned.
+	err = CloneRange(out, in, 0, 0, 5*65536+100)
+	if err != nil && !errors.Is(err, unix.EOPNOTSUPP) {
+		t.Errorf("range to the end of src: %v", err)
+	}
+}
+
+func TestDedupeRange(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	const size = 3*65536 + 100
+	open := func(name string) *os.File {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	data := cloneData(t, filepath.Join(dir, "dedupe-src"), size)
+	cloneData(t, filepath.Join(dir, "dedupe-same"), size)
+	differ := append([]byte(nil), data...)
+	differ[65536+10] ^= 0xff
+	if err := os.WriteFile(filepath.Join(dir, "dedupe-differ"), differ, 0640); err != nil {
+		t.Fatal(err)
+	}
+	src, same, diff := open("dedupe-src"), open("dedupe-same"), open("dedupe-differ")
+
+	// A length of zero dedupes to the end of src.
+	n, err := DedupeRange(same, src, 0, 0, 0)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EINVAL) {
+		t.Skip("no dedupe support:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != size {
+		t.Fatalf("deduplicated %d bytes, want %d", n, size)
+	}
+
+	if _, err := DedupeRange(diff, src, 0, 0, 0); err != ErrDedupeDiffers {
+		t.Fatalf("differing ranges: err = %v, want %v", err, ErrDedupeDiffers)
+	}
+
+	// The first block matches, only the second differs.
+	if n, err := DedupeRange(diff, src, 0, 0, 65536); err != nil || n != 65536 {
+		t.Fatalf("matching block: %d bytes, %v", n, err)
+	}
+
+	got, err := os.ReadFile(diff.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, differ) {
+		t.Fatal("dedupe changed the data of dst")
+	}
+}
@@ -0,0 +1,129 @@
+// Command ddio copies a file or device like dd, through the same O_DIRECT
+// code path as directio.CopyFile.
+//
+// Usage:
+//
+//	ddio [-bs 1m] [-idirect=true] [-odirect=true] [-sparse] [-fsync] [-progress] if=SRC of=DST
+//
+// The source and destination can also be given as the two positional
+// arguments.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oddmario/directio"
+)
+
+func main() {
+	bsFlag := flag.String("bs", "1m", "size of the aligned copy buffer")
+	idirect := flag.Bool("idirect", true, "read the source with O_DIRECT")
+	odirect := flag.Bool("odirect", true, "write the destination with O_DIRECT")
+	sparse := flag.Bool("sparse", false, "skip the holes of a sparse source")
+	fsync := flag.Bool("fsync", false, "fsync the destination before exiting")
+	offload := flag.Bool("offload", true, "let the kernel copy with copy_file_range when possible")
+	progress := flag.Bool("progress", false, "print the progress to stderr")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] if=SRC of=DST\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	src, dst := parseOperands(flag.Args())
+	if src == "" || dst == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	bs, err := parseSize(*bsFlag)
+	if err != nil {
+		log.Fatalf("bad -bs: %v", err)
+	}
+
+	opts := []directio.CopyOption{
+		directio.CopyBufferSize(int(bs)),
+		directio.CopyDirect(*idirect, *odirect),
+		directio.CopySparse(*sparse),
+		directio.CopySync(*fsync),
+		directio.CopyOffload(*offload),
+	}
+
+	start := time.Now()
+	if *progress {
+		last := start
+		opts = append(opts, directio.CopyProgress(func(written int64) {
+			if now := time.Now(); now.Sub(last) >= time.Second {
+				last = now
+				fmt.Fprintf(os.Stderr, "\r%s", rate(written, now.Sub(start)))
+			}
+		}))
+	}
+
+	written, err := directio.CopyFile(dst, src, opts...)
+	if *progress {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		log.Fatalf("copy failed after %d bytes: %v", written, err)
+	}
+
+	fmt.Fprintln(os.Stderr, rate(written, time.Since(start)))
+}
+
+// parseOperands accepts if= and of= operands like dd, or a plain source and
+// destination.
+func parseOperands(args []string) (src, dst string) {
+	var plain []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "if="):
+			src = arg[3:]
+		case strings.HasPrefix(arg, "of="):
+			dst = arg[3:]
+		default:
+			plain = append(plain, arg)
+		}
+	}
+
+	if src == "" && len(plain) > 0 {
+		src, plain = plain[0], plain[1:]
+	}
+	if dst == "" && len(plain) > 0 {
+		dst = plain[0]
+	}
+
+	return src, dst
+}
+
+func rate(written int64, elapsed time.Duration) string {
+	return fmt.Sprintf("%d bytes copied, %.1fs, %.1f MB/s", written, elapsed.Seconds(),
+		float64(written)/elapsed.Seconds()/(1<<20))
+}
+
+// parseSize parses sizes like 4096, 4k, 64K, 1m or 2g.
+func parseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1<<10, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1<<20, s[:len(s)-1]
+	case strings.HasSuffix(s, "g"):
+		mult, s = 1<<30, s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return n * mult, nil
+}
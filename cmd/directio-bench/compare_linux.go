@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/oddmario/directio"
+)
+
+// compareWrites runs the -compare benchmark.
+func compareWrites(dir string, size int64) {
+	c, err := directio.Compare(dir, size, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("direct:   %v\nbuffered: %v\n", c.Direct, c.Buffered)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "log"
+
+// stub
+func compareWrites(dir string, size int64) {
+	log.Fatal("-compare is only supported on Linux")
+}
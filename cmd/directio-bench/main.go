@@ -0,0 +1,311 @@
+// Command directio-bench measures O_DIRECT write and read throughput and
+// latency with the directio package, to tell a slow disk from a slow
+// program.
+//
+// Usage:
+//
+//	directio-bench [-dir /var/tmp] [-size 1g] [-bs 4k,64k,1m] [-mode seq-write,seq-read,rand-write,rand-read]
+//
+// With -verify, it instead writes test patterns over the given file or
+// device and reads them back, like a destructive badblocks run, and reports
+// the ranges that didn't match. -size 0 covers the whole target.
+//
+//	directio-bench -verify /dev/sdX -size 0
+//
+// With -compare, it writes -size bytes under -dir once with O_DIRECT and
+// once through the page cache, and reports the throughput, CPU time and
+// page cache footprint of both.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/oddmario/directio"
+)
+
+func main() {
+	dir := flag.String("dir", "/var/tmp", "directory to create the benchmark file in")
+	sizeFlag := flag.String("size", "1g", "bytes to write or read per run")
+	bsFlag := flag.String("bs", "4k,64k,1m", "comma separated block sizes to sweep")
+	modeFlag := flag.String("mode", "seq-write,seq-read,rand-write,rand-read", "comma separated benchmarks to run")
+	keep := flag.Bool("keep", false, "keep the benchmark file")
+	verify := flag.String("verify", "", "file or device to pattern test, destroying its content")
+	compare := flag.Bool("compare", false, "compare O_DIRECT with buffered writes")
+	flag.Parse()
+
+	size, err := parseSize(*sizeFlag)
+	if err != nil {
+		log.Fatalf("bad -size: %v", err)
+	}
+
+	if *verify != "" {
+		verifyPatterns(*verify, size)
+		return
+	}
+
+	if *compare {
+		compareWrites(*dir, size)
+		return
+	}
+
+	var sizes []int
+	for _, s := range strings.Split(*bsFlag, ",") {
+		bs, err := parseSize(s)
+		if err != nil {
+			log.Fatalf("bad -bs: %v", err)
+		}
+		sizes = append(sizes, int(bs))
+	}
+
+	path := filepath.Join(*dir, fmt.Sprintf("directio-bench-%d", os.Getpid()))
+	if !*keep {
+		defer os.Remove(path)
+	}
+
+	align := directio.GetBestAlignment(*dir)
+	fmt.Printf("file %s, alignment %d\n", path, align)
+	fmt.Printf("%-10s %8s %12s %10s %10s %10s\n", "mode", "bs", "MB/s", "avg", "p50", "p99")
+
+	for _, mode := range strings.Split(*modeFlag, ",") {
+		for _, bs := range sizes {
+			if bs%align != 0 {
+				log.Printf("skipping block size %d, not a multiple of %d", bs, align)
+				continue
+			}
+
+			lat, elapsed, err := run(mode, path, size-size%int64(bs), bs, align)
+			if err != nil {
+				log.Fatalf("%s bs=%d: %v", mode, bs, err)
+			}
+			report(mode, bs, lat, elapsed)
+		}
+	}
+}
+
+// run runs one benchmark and returns the latency of every operation.
+func run(mode, path string, size int64, bs, align int) ([]time.Duration, time.Duration, error) {
+	switch mode {
+	case "seq-write":
+		return seqWrite(path, size, bs, align)
+	case "seq-read":
+		return read(path, size, bs, align, false)
+	case "rand-write":
+		return randWrite(path, size, bs, align)
+	case "rand-read":
+		return read(path, size, bs, align, true)
+	default:
+		return nil, 0, fmt.Errorf("unknown mode %q", mode)
+	}
+}
+
+func seqWrite(path string, size int64, bs, align int) ([]time.Duration, time.Duration, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|directio.O_DIRECT, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	w, err := directio.NewSize(f, bs)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Buffers below the minimum size are raised to it, so the writes of bs
+	// bytes are collected into larger ones.
+	if n := w.Available(); n != bs {
+		log.Printf("seq-write bs=%d: the writer flushes %d bytes at a time, the minimum buffer size", bs, n)
+	}
+
+	buf := alignedBuf(bs, align)
+	lat := make([]time.Duration, 0, size/int64(bs))
+
+	start := time.Now()
+	for off := int64(0); off < size; off += int64(bs) {
+		t := time.Now()
+		if _, err := w.Write(buf); err != nil {
+			return nil, 0, err
+		}
+		lat = append(lat, time.Since(t))
+	}
+	if err := w.Close(); err != nil {
+		return nil, 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, 0, err
+	}
+
+	return lat, time.Since(start), nil
+}
+
+func randWrite(path string, size int64, bs, align int) ([]time.Duration, time.Duration, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|directio.O_DIRECT, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	if err := f.Truncate(size); err != nil {
+		return nil, 0, err
+	}
+
+	buf := alignedBuf(bs, align)
+	blocks := size / int64(bs)
+	lat := make([]time.Duration, 0, blocks)
+
+	start := time.Now()
+	for i := int64(0); i < blocks; i++ {
+		off := rand.Int63n(blocks) * int64(bs)
+		t := time.Now()
+		if _, err := f.WriteAt(buf, off); err != nil {
+			return nil, 0, err
+		}
+		lat = append(lat, time.Since(t))
+	}
+	if err := f.Sync(); err != nil {
+		return nil, 0, err
+	}
+
+	return lat, time.Since(start), nil
+}
+
+func read(path string, size int64, bs, align int, random bool) ([]time.Duration, time.Duration, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|directio.O_DIRECT, 0)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w (run a write benchmark first)", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() < size {
+		size = info.Size() - info.Size()%int64(bs)
+	}
+
+	buf := alignedBuf(bs, align)
+	blocks := size / int64(bs)
+	lat := make([]time.Duration, 0, blocks)
+
+	start := time.Now()
+	for i := int64(0); i < blocks; i++ {
+		off := i * int64(bs)
+		if random {
+			off = rand.Int63n(blocks) * int64(bs)
+		}
+		t := time.Now()
+		if _, err := syscall.Pread(int(f.Fd()), buf, off); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		lat = append(lat, time.Since(t))
+	}
+
+	return lat, time.Since(start), nil
+}
+
+func report(mode string, bs int, lat []time.Duration, elapsed time.Duration) {
+	if len(lat) == 0 {
+		fmt.Printf("%-10s %8d %12s\n", mode, bs, "no data")
+		return
+	}
+
+	var total time.Duration
+	for _, l := range lat {
+		total += l
+	}
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+
+	bytes := float64(len(lat)) * float64(bs)
+	fmt.Printf("%-10s %8d %12.1f %10v %10v %10v\n", mode, bs,
+		bytes/elapsed.Seconds()/(1<<20),
+		(total / time.Duration(len(lat))).Round(time.Microsecond),
+		lat[len(lat)/2].Round(time.Microsecond),
+		lat[len(lat)*99/100].Round(time.Microsecond))
+}
+
+// verifyPatterns runs the write and read back passes over path and exits
+// with a non-zero status if any bad range was found.
+func verifyPatterns(path string, size int64) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|directio.O_DIRECT, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	patterns := []directio.Pattern{
+		directio.PatternByte(0xaa),
+		directio.PatternByte(0x55),
+		directio.PatternOffset(rand.Uint64()),
+	}
+
+	start := time.Now()
+	bad, err := directio.CheckPattern(f, size, patterns,
+		directio.PatternProgress(func(done, total int64) {
+			fmt.Fprintf(os.Stderr, "\r%d/%d MB", done>>20, total>>20)
+		}))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, r := range bad {
+		if r.Err != nil {
+			fmt.Printf("bad range %d+%d: %v\n", r.Offset, r.Length, r.Err)
+		} else {
+			fmt.Printf("bad range %d+%d: data mismatch\n", r.Offset, r.Length)
+		}
+	}
+	fmt.Printf("%d patterns verified in %v, %d bad ranges\n", len(patterns), time.Since(start).Round(time.Millisecond), len(bad))
+
+	if len(bad) > 0 {
+		os.Exit(1)
+	}
+}
+
+// alignedBuf returns a buffer of n bytes aligned to align, filled with data
+// that doesn't compress.
+func alignedBuf(n, align int) []byte {
+	buf := make([]byte, n+align)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) % uintptr(align)); rem != 0 {
+		off = align - rem
+	}
+	buf = buf[off : off+n]
+
+	rand.Read(buf)
+
+	return buf
+}
+
+// parseSize parses sizes like 4096, 4k, 64K, 1m or 2g.
+func parseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1<<10, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1<<20, s[:len(s)-1]
+	case strings.HasSuffix(s, "g"):
+		mult, s = 1<<30, s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return n * mult, nil
+}
@@ -0,0 +1,145 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// RunResult is the outcome of one run of Compare.
+type RunResult struct {
+	// Bytes is the amount of data written, Elapsed how long writing and
+	// syncing it took.
+	Bytes   int64
+	Elapsed time.Duration
+
+	// UserCPU and SystemCPU are the CPU time the process spent, in user
+	// space and in the kernel, during the run. Other goroutines running
+	// meanwhile are counted too.
+	UserCPU   time.Duration
+	SystemCPU time.Duration
+
+	// Cached is how much of the file was in the page cache after the run.
+	Cached int64
+}
+
+// Throughput returns the bytes written per second.
+func (r RunResult) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+func (r RunResult) String() string {
+	return fmt.Sprintf("%.1f MB/s, %v user, %v system, %d bytes cached",
+		r.Throughput()/(1<<20), r.UserCPU.Round(time.Millisecond), r.SystemCPU.Round(time.Millisecond), r.Cached)
+}
+
+// Comparison holds the results of Compare.
+type Comparison struct {
+	Direct   RunResult
+	Buffered RunResult
+}
+
+// Compare writes the same size bytes, chunk bytes at a time, to a file in
+// dir once with a DirectIO writer and once through the page cache, syncing
+// both, and reports the throughput, CPU time and page cache footprint of
+// each. It tells whether direct I/O pays off on the hardware under dir.
+// chunk defaults to 1MB. The files are removed afterwards.
+func Compare(dir string, size int64, chunk int) (*Comparison, error) {
+	if size <= 0 {
+		return nil, errors.New("size must be greater than zero")
+	}
+	if chunk <= 0 {
+		chunk = defaultCopyBufSize
+	}
+
+	// Both runs write the same aligned data, so the direct one isn't
+	// slowed down by copies.
+	data, err := allocAlignedBuf(4096, alignUp(chunk, 4096))
+	if err != nil {
+		return nil, err
+	}
+	data = data[:chunk]
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	c := &Comparison{}
+	if c.Direct, err = compareRun(dir, size, data, true); err != nil {
+		return nil, fmt.Errorf("direct run: %w", err)
+	}
+	if c.Buffered, err = compareRun(dir, size, data, false); err != nil {
+		return nil, fmt.Errorf("buffered run: %w", err)
+	}
+
+	return c, nil
+}
+
+// compareRun writes one file of Compare.
+func compareRun(dir string, size int64, data []byte, direct bool) (RunResult, error) {
+	flags := os.O_RDWR | os.O_CREATE | os.O_EXCL
+	if direct {
+		flags |= O_DIRECT
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf(".directio-compare-%d-%d", os.Getpid(), time.Now().UnixNano()))
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return RunResult{}, err
+	}
+	defer os.Remove(path)
+	defer f.Close()
+
+	var before syscall.Rusage
+	syscall.Getrusage(syscall.RUSAGE_SELF, &before)
+	start := time.Now()
+
+	var w io.Writer = f
+	var dio *DirectIO
+	if direct {
+		if dio, err = NewSize(f, len(data)); err != nil {
+			return RunResult{}, err
+		}
+		w = dio
+	}
+
+	for left := size; left > 0; {
+		p := data[:min(int64(len(data)), left)]
+		if _, err := w.Write(p); err != nil {
+			return RunResult{}, err
+		}
+		left -= int64(len(p))
+	}
+
+	if dio != nil {
+		if err := dio.Close(); err != nil {
+			return RunResult{}, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return RunResult{}, err
+	}
+
+	r := RunResult{Bytes: size, Elapsed: time.Since(start)}
+
+	var after syscall.Rusage
+	syscall.Getrusage(syscall.RUSAGE_SELF, &after)
+	r.UserCPU = time.Duration(after.Utime.Nano() - before.Utime.Nano())
+	r.SystemCPU = time.Duration(after.Stime.Nano() - before.Stime.Nano())
+
+	if r.Cached, _, err = CacheResidency(f, 0, 0); err != nil {
+		return RunResult{}, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	c, err := Compare(dir, 8<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []RunResult{c.Direct, c.Buffered} {
+		if r.Bytes != 8<<20 || r.Elapsed <= 0 || r.Throughput() <= 0 {
+			t.Fatalf("bad result %+v", r)
+		}
+	}
+	if c.Direct.Cached >= c.Buffered.Cached {
+		t.Fatalf("direct run left %d bytes cached, buffered one %d", c.Direct.Cached, c.Buffered.Cached)
+	}
+	t.Logf("direct: %v", c.Direct)
+	t.Logf("buffered: %v", c.Buffered)
+}
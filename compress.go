@@ -0,0 +1,401 @@
+package directio
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// compressedMagic starts every compressed frame.
+	compressedMagic = "DIOZ"
+
+	// compressedHeaderLen is the size of the frame header: magic (4 bytes),
+	// flags (1 byte), reserved (3 bytes), payload length (4 bytes) and
+	// uncompressed length (4 bytes).
+	compressedHeaderLen = 16
+
+	// compressedStored marks a frame whose payload didn't compress and is
+	// stored as is.
+	compressedStored = 1 << 0
+)
+
+// ErrBadFrame is returned when a compressed frame header is invalid.
+var ErrBadFrame = errors.New("invalid compressed frame")
+
+// Codec compresses and decompresses the payload of a single frame. Both
+// methods append to dst and return the result, like the EncodeAll/DecodeAll
+// style APIs of most LZ4 and zstd packages, which makes adapting them a
+// two-line wrapper. rawLen is the uncompressed length the frame records:
+// Decompress must not produce much more than that, so that a corrupt frame
+// can't exhaust memory.
+type Codec interface {
+	Compress(dst, src []byte) ([]byte, error)
+	Decompress(dst, src []byte, rawLen int) ([]byte, error)
+}
+
+// FlateCodec is a Codec using compress/flate. It is not safe for concurrent use.
+type FlateCodec struct {
+	Level int
+
+	w   *flate.Writer
+	buf bytes.Buffer
+}
+
+// Compress implements Codec.
+func (c *FlateCodec) Compress(dst, src []byte) ([]byte, error) {
+	c.buf.Reset()
+
+	if c.w == nil {
+		w, err := flate.NewWriter(&c.buf, c.Level)
+		if err != nil {
+			return nil, err
+		}
+		c.w = w
+	} else {
+		c.w.Reset(&c.buf)
+	}
+
+	if _, err := c.w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := c.w.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(dst, c.buf.Bytes()...), nil
+}
+
+// Decompress implements Codec. It stops one byte past rawLen.
+func (c *FlateCodec) Decompress(dst, src []byte, rawLen int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+
+	c.buf.Reset()
+	if _, err := c.buf.ReadFrom(io.LimitReader(r, int64(rawLen)+1)); err != nil {
+		return nil, err
+	}
+
+	return append(dst, c.buf.Bytes()...), nil
+}
+
+// CompressedFrame describes a frame written by CompressedWriter.
+type CompressedFrame struct {
+	// Offset and Length locate the frame in the compressed output. Both are
+	// multiples of the block size.
+	Offset int64
+	Length int
+
+	// RawOffset and RawLength locate the frame's data in the uncompressed stream.
+	RawOffset int64
+	RawLength int
+}
+
+// CompressedWriter compresses data in independent frames of up to chunkSize
+// uncompressed bytes. Each frame starts with a header recording its
+// compressed and uncompressed lengths and is zero padded to the block size,
+// so the output keeps the alignment DirectIO needs and every frame can be
+// located and decoded on its own.
+type CompressedWriter struct {
+	w         io.Writer
+	codec     Codec
+	blockSize int
+
+	raw    []byte
+	n      int
+	frame  []byte
+	comp   []byte
+	frames []CompressedFrame
+	off    int64
+	rawOff int64
+	err    error
+
+	isClosed bool
+}
+
+// NewCompressedWriter returns a writer compressing to w with codec. If w is
+// a *DirectIO its block size is used for padding, otherwise 4096.
+func NewCompressedWriter(w io.Writer, codec Codec, chunkSize int) (*CompressedWriter, error) {
+	if chunkSize <= 0 {
+		return nil, errors.New("chunk size must be greater than zero")
+	}
+
+	blockSize := config().FallbackAlignment
+	if d, ok := w.(*DirectIO); ok {
+		blockSize = d.blockSize
+	}
+
+	frame, err := allocAlignedBuf(blockSize, alignUp(compressedHeaderLen+chunkSize, blockSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompressedWriter{
+		w:         w,
+		codec:     codec,
+		blockSize: blockSize,
+		raw:       make([]byte, chunkSize),
+		frame:     frame,
+	}, nil
+}
+
+// Frames returns the index of the frames written so far.
+func (c *CompressedWriter) Frames() []CompressedFrame { return c.frames }
+
+// emit compresses the pending data into one frame and writes it.
+func (c *CompressedWriter) emit() error {
+	if c.n == 0 {
+		return nil
+	}
+
+	raw := c.raw[:c.n]
+
+	comp, err := c.codec.Compress(c.comp[:0], raw)
+	if err != nil {
+		return err
+	}
+	c.comp = comp
+
+	var flags byte
+	payload := comp
+	if len(payload) >= len(raw) {
+		flags |= compressedStored
+		payload = raw
+	}
+
+	size := alignUp(compressedHeaderLen+len(payload), c.blockSize)
+	frame := c.frame[:size]
+
+	copy(frame[0:4], compressedMagic)
+	frame[4] = flags
+	frame[5], frame[6], frame[7] = 0, 0, 0
+	binary.BigEndian.PutUint32(frame[8:12], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[12:16], uint32(len(raw)))
+	n := copy(frame[compressedHeaderLen:], payload)
+	for i := compressedHeaderLen + n; i < size; i++ {
+		frame[i] = 0
+	}
+
+	if _, err := c.w.Write(frame); err != nil {
+		return err
+	}
+
+	c.frames = append(c.frames, CompressedFrame{
+		Offset:    c.off,
+		Length:    size,
+		RawOffset: c.rawOff,
+		RawLength: len(raw),
+	})
+	c.off += int64(size)
+	c.rawOff += int64(len(raw))
+	c.n = 0
+
+	return nil
+}
+
+// Write compresses p. A frame is written every time chunkSize bytes have
+// been collected.
+func (c *CompressedWriter) Write(p []byte) (nn int, err error) {
+	if c.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	for len(p) > 0 {
+		n := copy(c.raw[c.n:], p)
+		c.n += n
+		nn += n
+		p = p[n:]
+
+		if c.n == len(c.raw) {
+			if c.err = c.emit(); c.err != nil {
+				return nn, c.err
+			}
+		}
+	}
+
+	return nn, nil
+}
+
+// Close writes the last, possibly short, frame. It doesn't close the
+// underlying writer.
+func (c *CompressedWriter) Close() error {
+	if c.isClosed {
+		return errors.New("the writer is already closed")
+	}
+
+	c.isClosed = true
+
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.emit()
+}
+
+// CompressedReader decompresses a stream written by CompressedWriter.
+type CompressedReader struct {
+	r         io.Reader
+	codec     Codec
+	blockSize int
+	chunkSize int
+
+	frame []byte
+	raw   []byte
+	pos   int
+	err   error
+}
+
+// NewCompressedReader returns a reader decompressing from r with codec.
+// blockSize and chunkSize must be the block and chunk sizes the stream was
+// written with; frames claiming more than chunkSize bytes are rejected with
+// ErrBadFrame before anything is allocated for them. r may be an O_DIRECT
+// file, frames are read into a block aligned buffer.
+func NewCompressedReader(r io.Reader, codec Codec, blockSize, chunkSize int) (*CompressedReader, error) {
+	if chunkSize <= 0 {
+		return nil, errors.New("chunk size must be greater than zero")
+	}
+
+	frame, err := allocAlignedBuf(blockSize, blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompressedReader{
+		r:         r,
+		codec:     codec,
+		blockSize: blockSize,
+		chunkSize: chunkSize,
+		frame:     frame,
+	}, nil
+}
+
+// next reads and decodes the next frame.
+func (c *CompressedReader) next() error {
+	if _, err := io.ReadFull(c.r, c.frame[:c.blockSize]); err != nil {
+		return err
+	}
+
+	size, err := compressedFrameSize(c.frame, c.blockSize, c.chunkSize)
+	if err != nil {
+		return err
+	}
+
+	if size > cap(c.frame) {
+		frame, err := allocAlignedBuf(c.blockSize, size)
+		if err != nil {
+			return err
+		}
+		copy(frame, c.frame[:c.blockSize])
+		c.frame = frame
+	}
+	c.frame = c.frame[:size]
+
+	if _, err := io.ReadFull(c.r, c.frame[c.blockSize:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	c.raw, err = decodeCompressedFrame(c.codec, c.raw[:0], c.frame)
+	c.pos = 0
+
+	return err
+}
+
+// Read reads decompressed data into p.
+func (c *CompressedReader) Read(p []byte) (int, error) {
+	for c.pos == len(c.raw) {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.err = c.next()
+	}
+
+	n := copy(p, c.raw[c.pos:])
+	c.pos += n
+
+	return n, nil
+}
+
+// compressedFrameSize validates the header at the start of b and returns the
+// padded size of the frame. Neither the payload nor the data of a frame
+// written with chunkSize can be longer than it.
+func compressedFrameSize(b []byte, blockSize, chunkSize int) (int, error) {
+	if len(b) < compressedHeaderLen || string(b[0:4]) != compressedMagic {
+		return 0, ErrBadFrame
+	}
+
+	payload := int(binary.BigEndian.Uint32(b[8:12]))
+	rawLen := int(binary.BigEndian.Uint32(b[12:16]))
+	if payload > chunkSize || rawLen > chunkSize {
+		return 0, ErrBadFrame
+	}
+
+	return alignUp(compressedHeaderLen+payload, blockSize), nil
+}
+
+// decodeCompressedFrame appends the uncompressed content of frame to dst.
+func decodeCompressedFrame(codec Codec, dst, frame []byte) ([]byte, error) {
+	flags := frame[4]
+	payload := int(binary.BigEndian.Uint32(frame[8:12]))
+	rawLen := int(binary.BigEndian.Uint32(frame[12:16]))
+
+	if compressedHeaderLen+payload > len(frame) {
+		return nil, ErrBadFrame
+	}
+	data := frame[compressedHeaderLen : compressedHeaderLen+payload]
+
+	if flags&compressedStored != 0 {
+		if payload != rawLen {
+			return nil, ErrBadFrame
+		}
+		return append(dst, data...), nil
+	}
+
+	out, err := codec.Decompress(dst, data, rawLen)
+	if err != nil {
+		return nil, err
+	}
+	if len(out)-len(dst) != rawLen {
+		return nil, ErrBadFrame
+	}
+
+	return out, nil
+}
+
+// ReadCompressedFrameAt decodes the single frame at off in r, as recorded in
+// CompressedWriter.Frames, and appends its data to dst. blockSize and
+// chunkSize are those of NewCompressedReader.
+func ReadCompressedFrameAt(r io.ReaderAt, codec Codec, blockSize, chunkSize int, off int64, dst []byte) ([]byte, error) {
+	head, err := allocAlignedBuf(blockSize, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.ReadAt(head, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	size, err := compressedFrameSize(head, blockSize, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := allocAlignedBuf(blockSize, size)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := r.ReadAt(frame, off); n < size {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return decodeCompressedFrame(codec, dst, frame)
+}
@@ -0,0 +1,145 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestCompressed(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	// A compressible chunk, one that isn't and a short compressible tail.
+	const chunkSize = 64 * 1024
+	data := bytes.Repeat([]byte("directio "), (2*chunkSize+1000)/9+1)[:2*chunkSize+1000]
+	rand.New(rand.NewSource(1)).Read(data[chunkSize : 2*chunkSize])
+
+	f := tmpFile(t, dir, "compressed")
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cw, err := NewCompressedWriter(dio, &FlateCodec{Level: 6}, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	frames := cw.Frames()
+	if len(frames) != 3 {
+		t.Fatalf("%d frames, want 3", len(frames))
+	}
+	if frames[0].Length >= chunkSize || frames[1].Length < chunkSize {
+		t.Fatalf("frame lengths %d and %d, want the first compressed and the second stored", frames[0].Length, frames[1].Length)
+	}
+
+	rf, err := os.OpenFile(f.Name(), os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	cr, err := NewCompressedReader(rf, &FlateCodec{}, dio.blockSize, chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("decompressed data doesn't match")
+	}
+
+	for i, fr := range frames {
+		if fr.Offset%int64(dio.blockSize) != 0 || fr.Length%dio.blockSize != 0 {
+			t.Fatalf("frame %d at %d+%d is not block aligned", i, fr.Offset, fr.Length)
+		}
+		got, err := ReadCompressedFrameAt(rf, &FlateCodec{}, dio.blockSize, chunkSize, fr.Offset, nil)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !bytes.Equal(got, data[fr.RawOffset:fr.RawOffset+int64(fr.RawLength)]) {
+			t.Fatalf("frame %d doesn't match", i)
+		}
+	}
+}
+
+func TestCompressedBadFrame(t *testing.T) {
+	const blockSize = 4096
+
+	// One frame of random data, stored, and one of text, compressed.
+	frame := func(raw []byte) []byte {
+		var buf bytes.Buffer
+		cw, err := NewCompressedWriter(&buf, &FlateCodec{Level: 6}, blockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cw.Write(raw); err != nil {
+			t.Fatal(err)
+		}
+		if err := cw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	random := make([]byte, 100)
+	rand.New(rand.NewSource(1)).Read(random)
+	stored := frame(random)
+	compressed := frame(bytes.Repeat([]byte("directio "), 400))
+	if stored[4]&compressedStored == 0 || compressed[4]&compressedStored != 0 {
+		t.Fatal("random data wasn't stored, or text wasn't compressed")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		frame   []byte
+		corrupt func(b []byte)
+		err     error
+	}{
+		{"magic", stored, func(b []byte) { b[0] = 'X' }, ErrBadFrame},
+		{"stored length", stored, func(b []byte) { binary.BigEndian.PutUint32(b[12:16], 50) }, ErrBadFrame},
+		{"payload length", stored, func(b []byte) { binary.BigEndian.PutUint32(b[8:12], blockSize) }, io.ErrUnexpectedEOF},
+		{"payload past the chunk size", stored, func(b []byte) { binary.BigEndian.PutUint32(b[8:12], 1<<31) }, ErrBadFrame},
+		{"length past the chunk size", compressed, func(b []byte) { binary.BigEndian.PutUint32(b[12:16], 1<<31) }, ErrBadFrame},
+		{"short length", compressed, func(b []byte) { binary.BigEndian.PutUint32(b[12:16], 10) }, ErrBadFrame},
+	} {
+		b := append([]byte(nil), tc.frame...)
+		tc.corrupt(b)
+
+		if _, err := ReadCompressedFrameAt(bytes.NewReader(b), &FlateCodec{}, blockSize, blockSize, 0, nil); err != tc.err {
+			t.Fatalf("%s: ReadCompressedFrameAt: err = %v, want %v", tc.name, err, tc.err)
+		}
+
+		cr, err := NewCompressedReader(bytes.NewReader(b), &FlateCodec{}, blockSize, blockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(cr); err != tc.err {
+			t.Fatalf("%s: Read: err = %v, want %v", tc.name, err, tc.err)
+		}
+	}
+
+	// The codec stops inflating one byte past the recorded length.
+	payload := compressed[compressedHeaderLen : compressedHeaderLen+binary.BigEndian.Uint32(compressed[8:12])]
+	if out, err := (&FlateCodec{}).Decompress(nil, payload, 10); err != nil || len(out) != 11 {
+		t.Fatalf("Decompress with a short length: %d bytes, %v", len(out), err)
+	}
+}
@@ -0,0 +1,27 @@
+package directio
+
+// WithConcurrentWrites makes the writer safe for concurrent use: Write,
+// ReadFrom, Flush, Checkpoint, Stats and Close are serialized by a mutex,
+// so several goroutines can append to the same log. Each Write is applied
+// whole, but the order of concurrent writes is unspecified. Without it the
+// writer must only be used by one goroutine at a time.
+func WithConcurrentWrites(enabled bool) Option {
+	return func(d *DirectIO) {
+		d.concurrent = enabled
+	}
+}
+
+// lock takes the writer mutex when something else than the caller may use
+// the writer.
+func (d *DirectIO) lock() {
+	if d.concurrent || d.interval > 0 {
+		d.mu.Lock()
+	}
+}
+
+// unlock releases the writer mutex taken by lock.
+func (d *DirectIO) unlock() {
+	if d.concurrent || d.interval > 0 {
+		d.mu.Unlock()
+	}
+}
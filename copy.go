@@ -0,0 +1,336 @@
+package directio
+
+import (
+	"errors"
+	"os"
+)
+
+const (
+	// Default buffer used by CopyFile is 1MB.
+	defaultCopyBufSize = 1 << 20
+)
+
+// errSameFile is returned by CopyFile and CloneFile when dst is src, or a
+// link to it: truncating dst would destroy the data to copy.
+var errSameFile = errors.New("source and destination are the same file")
+
+// CopyOption configures CopyFile.
+type CopyOption func(c *copyConfig)
+
+type copyConfig struct {
+	bufSize   int
+	sync      bool
+	noOffload bool
+	sparse    bool
+	bufferIn  bool
+	bufferOut bool
+	progress  func(written int64)
+
+	// workers and noReflink are the options of CopyTree.
+	workers   int
+	noReflink bool
+}
+
+// CopyBufferSize sets the size of the aligned buffer CopyFile streams
+// through. It is rounded up to the block size.
+func CopyBufferSize(n int) CopyOption {
+	return func(c *copyConfig) {
+		c.bufSize = n
+	}
+}
+
+// CopySync makes CopyFile call Sync on the destination before returning.
+func CopySync(enabled bool) CopyOption {
+	return func(c *copyConfig) {
+		c.sync = enabled
+	}
+}
+
+// CopyOffload controls whether CopyFile may use copy_file_range(2) when both
+// ends are regular files. It is enabled by default.
+func CopyOffload(enabled bool) CopyOption {
+	return func(c *copyConfig) {
+		c.noOffload = !enabled
+	}
+}
+
+// CopySparse makes CopyFile skip the holes of a sparse source, so that the
+// destination stays sparse. Only the data extents are read and written with
+// O_DIRECT. Offloading to copy_file_range is disabled in this mode, as it
+// may fill holes in. The bytes copied CopyFile returns and reports leave the
+// holes out.
+func CopySparse(enabled bool) CopyOption {
+	return func(c *copyConfig) {
+		c.sparse = enabled
+	}
+}
+
+// CopyDirect controls whether src and dst are opened with O_DIRECT. Both
+// are by default. Turning it off for one end lets that end go through the
+// page cache, e.g. to read a source that is hot in cache anyway or to copy
+// to a filesystem without O_DIRECT support.
+func CopyDirect(in, out bool) CopyOption {
+	return func(c *copyConfig) {
+		c.bufferIn = !in
+		c.bufferOut = !out
+	}
+}
+
+// CopyProgress sets a function called with the number of bytes copied so
+// far after every chunk.
+func CopyProgress(fn func(written int64)) CopyOption {
+	return func(c *copyConfig) {
+		c.progress = fn
+	}
+}
+
+// CopyFile copies the file at src to dst with O_DIRECT on both ends, so
+// neither file goes through the page cache. dst is created or truncated and
+// gets the permission bits of src; it must not be src itself, or a hard
+// link to it. It returns the number of bytes copied.
+//
+// When both files are regular files, the copy is first offloaded to the
+// kernel with copy_file_range(2), which is a server-side copy on NFS and a
+// reflink on filesystems supporting it. If that isn't possible, data is
+// streamed through one reusable aligned buffer. The last, partial block is
+// then written zero padded and the destination truncated to the size of
+// the source.
+func CopyFile(dst, src string, opts ...CopyOption) (written int64, err error) {
+	cfg := copyConfig{bufSize: defaultCopyBufSize}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	inFlags, outFlags := O_DIRECT, O_DIRECT
+	if cfg.bufferIn {
+		inFlags = 0
+	}
+	if cfg.bufferOut {
+		outFlags = 0
+	}
+
+	in, err := os.OpenFile(src, os.O_RDONLY|inFlags, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return 0, errors.New("source is a directory")
+	}
+
+	out, err := createDst(dst, outFlags, info)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	blockSize := GetBestAlignment(src)
+	if a := GetBestAlignment(dst); a > blockSize {
+		blockSize = a
+	}
+
+	switch {
+	case cfg.sparse && info.Mode().IsRegular():
+		written, err = copySparse(out, in, info.Size(), blockSize, &cfg)
+
+	default:
+		var off int64
+		if !cfg.noOffload && info.Mode().IsRegular() {
+			off = copyRange(out, in, info.Size())
+
+			// Resume the streaming copy at the last block boundary reached.
+			off -= off % int64(blockSize)
+		}
+
+		written, err = copyDirect(out, in, off, blockSize, &cfg)
+	}
+	if err != nil {
+		return written, err
+	}
+
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		return written, err
+	}
+
+	if cfg.sync {
+		if err := out.Sync(); err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// createDst opens dst for writing a copy of the file described by info,
+// creating it with the permission bits of the source if needed. An existing
+// regular file is truncated, once it is known not to be the source itself.
+func createDst(dst string, flags int, info os.FileInfo) (*os.File, error) {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|flags, info.Mode().Perm())
+	if err != nil {
+		return nil, err
+	}
+
+	dinfo, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	if os.SameFile(info, dinfo) {
+		out.Close()
+		return nil, errSameFile
+	}
+	if dinfo.Mode().IsRegular() && dinfo.Size() > 0 {
+		if err := out.Truncate(0); err != nil {
+			out.Close()
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// report passes the progress made to the progress function, if any.
+func (c *copyConfig) report(written int64) {
+	if c.progress != nil {
+		c.progress(written)
+	}
+}
+
+// copyBuffer allocates the aligned buffer the streaming copy goes through.
+func copyBuffer(blockSize int, cfg *copyConfig) ([]byte, error) {
+	size := cfg.bufSize
+	if size <= 0 {
+		size = defaultCopyBufSize
+	}
+
+	return allocAlignedBuf(blockSize, alignUp(size, blockSize))
+}
+
+// copyChunk copies up to len(buf) bytes at the block aligned offset off from
+// in to out. A short read means the end of in was reached; the partial last
+// block is then written zero padded and padded is reported so the caller can
+// truncate the destination afterwards.
+func copyChunk(out, in *os.File, buf []byte, off int64, blockSize int) (n int, padded bool, err error) {
+	n, err = pread(in, buf, off)
+	if err != nil || n == 0 {
+		return 0, false, err
+	}
+
+	wlen := n
+	if rem := n % blockSize; rem != 0 {
+		wlen = alignUp(n, blockSize)
+		for i := n; i < wlen; i++ {
+			buf[i] = 0
+		}
+		padded = true
+	}
+
+	if _, err := out.WriteAt(buf[:wlen], off); err != nil {
+		return 0, padded, err
+	}
+
+	return n, padded, nil
+}
+
+// copyDirect streams in to out at matching offsets through an aligned
+// buffer, starting at the block aligned offset off.
+func copyDirect(out, in *os.File, off int64, blockSize int, cfg *copyConfig) (int64, error) {
+	buf, err := copyBuffer(blockSize, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	truncate := false
+	for {
+		n, padded, err := copyChunk(out, in, buf, off, blockSize)
+		if err != nil {
+			return off, err
+		}
+		truncate = truncate || padded
+		off += int64(n)
+		cfg.report(off)
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	if truncate {
+		if info, err := out.Stat(); err == nil && info.Mode().IsRegular() {
+			if err := out.Truncate(off); err != nil {
+				return off, err
+			}
+		}
+	}
+
+	return off, nil
+}
+
+// copySparse copies only the data extents of in, found with SEEK_DATA and
+// SEEK_HOLE, and leaves holes unwritten in out, which is then truncated to
+// size. Extent boundaries are widened to the block size. It returns the
+// number of bytes copied, holes left out.
+func copySparse(out, in *os.File, size int64, blockSize int, cfg *copyConfig) (int64, error) {
+	buf, err := copyBuffer(blockSize, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	bs := int64(blockSize)
+
+	var off, written int64
+	for off < size {
+		data, hole, err := nextDataExtent(in, off)
+		if err != nil {
+			return written, err
+		}
+		if data < 0 {
+			// Only a hole is left.
+			break
+		}
+
+		pos := data - data%bs
+		end := hole
+		if rem := end % bs; rem != 0 {
+			end += bs - rem
+		}
+
+		for pos < end {
+			chunk := buf
+			if rest := end - pos; int64(len(chunk)) > rest {
+				chunk = chunk[:rest]
+			}
+
+			n, _, err := copyChunk(out, in, chunk, pos, blockSize)
+			if err != nil {
+				return written, err
+			}
+			pos += int64(n)
+			written += int64(n)
+			cfg.report(written)
+
+			if n < len(chunk) {
+				break
+			}
+		}
+
+		off = end
+	}
+
+	if info, err := out.Stat(); err == nil && info.Mode().IsRegular() {
+		if err := out.Truncate(size); err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
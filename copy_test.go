@@ -0,0 +1,188 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	for _, size := range []int{0, 1, 4096, 8191, 100000, 3 << 20} {
+		for _, offload := range []bool{true, false} {
+			testCopyFile(t, dir, size, offload)
+		}
+	}
+}
+
+func testCopyFile(t *testing.T, dir string, size int, offload bool) {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 249)
+	}
+
+	src := filepath.Join(dir, fmt.Sprintf("src-%d-%v", size, offload))
+	dst := filepath.Join(dir, fmt.Sprintf("dst-%d-%v", size, offload))
+	if err := os.WriteFile(src, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := CopyFile(dst, src, CopySync(true), CopyOffload(offload))
+	if err != nil {
+		t.Fatalf("size %d: CopyFile = %v", size, err)
+	}
+	if n != int64(size) {
+		t.Errorf("size %d: copied %d bytes", size, n)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("size %d: wrong bytes were copied", size)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("size %d: mode %v, want %v", size, info.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func TestCopyFileSparse(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	src := filepath.Join(dir, "sparse-src")
+	dst := filepath.Join(dir, "sparse-dst")
+
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1MB of data, a 16MB hole, 1000 bytes of data, then a trailing hole.
+	chunk := bytes.Repeat([]byte{0xAB}, 1<<20)
+	f.WriteAt(chunk, 0)
+	f.WriteAt(chunk[:1000], 17<<20)
+	f.Truncate(40 << 20)
+	f.Close()
+
+	n, err := CopyFile(dst, src, CopySparse(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 1<<20+1000 || n > 2<<20 {
+		t.Errorf("copied %d bytes, want the data extents only", n)
+	}
+
+	want, _ := os.ReadFile(src)
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("wrong bytes were copied")
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(dst, &st); err != nil {
+		t.Fatal(err)
+	}
+	if allocated := st.Blocks * 512; allocated > 4<<20 {
+		t.Errorf("destination has %d bytes allocated, holes were not preserved", allocated)
+	}
+}
+
+func TestCopyFileProgress(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	src := filepath.Join(dir, "progress-src")
+	dst := filepath.Join(dir, "progress-dst")
+
+	data := bytes.Repeat([]byte{0x5A}, 3<<20+123)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var last int64
+	written, err := CopyFile(dst, src,
+		CopyOffload(false),
+		CopyDirect(false, true),
+		CopyBufferSize(1<<20),
+		CopyProgress(func(n int64) {
+			if n < last {
+				t.Errorf("progress went back from %d to %d", last, n)
+			}
+			last = n
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(len(data)) || last != written {
+		t.Fatalf("copied %d bytes, last progress %d, want %d", written, last, len(data))
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("wrong bytes were copied")
+	}
+}
+
+func TestCopyFileSameFile(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	src := filepath.Join(dir, "same-src")
+	link := filepath.Join(dir, "same-link")
+	data := bytes.Repeat([]byte{0x3C}, 10000)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(src, link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dst := range []string{src, link} {
+		if n, err := CopyFile(dst, src); err == nil {
+			t.Errorf("copy of %s to itself succeeded, %d bytes", filepath.Base(dst), n)
+		}
+		got, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("copy of %s to itself changed the source", filepath.Base(dst))
+		}
+	}
+
+	// An existing, longer destination is still truncated.
+	dst := filepath.Join(dir, "same-dst")
+	if err := os.WriteFile(dst, bytes.Repeat([]byte{1}, 50000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CopyFile(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("existing destination wasn't overwritten")
+	}
+}
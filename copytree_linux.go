@@ -0,0 +1,192 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// CopyWorkers sets how many files CopyTree copies at once, GOMAXPROCS by
+// default.
+func CopyWorkers(n int) CopyOption {
+	return func(c *copyConfig) {
+		c.workers = n
+	}
+}
+
+// CopyReflink controls whether CopyTree tries to clone files with
+// CloneFile before copying them. It is enabled by default.
+func CopyReflink(enabled bool) CopyOption {
+	return func(c *copyConfig) {
+		c.noReflink = !enabled
+	}
+}
+
+// CopyTree copies the directory tree at src to dst, which must not exist or
+// be an empty directory, and returns the number of bytes of the regular
+// files copied. Regular files are cloned when both ends support reflinks,
+// and copied with CopyFile and opts otherwise, CopySparse keeping holes;
+// several of them are copied at once, see CopyWorkers. Symbolic links are
+// recreated as is, and modes and modification times are kept. Other files,
+// like devices and sockets, are skipped. A failing file doesn't stop the
+// others: the errors are joined. CopyProgress is called per file, from the
+// workers.
+func CopyTree(dst, src string, opts ...CopyOption) (int64, error) {
+	cfg := copyConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	workers := cfg.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return 0, err
+	}
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return 0, err
+	}
+	if rel, err := filepath.Rel(absSrc, absDst); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+		return 0, errors.New("destination is inside the source")
+	}
+
+	if info, err := os.Stat(dst); err == nil && !info.IsDir() {
+		return 0, errors.New("destination is not a directory")
+	}
+	if entries, err := os.ReadDir(dst); err == nil && len(entries) > 0 {
+		return 0, errors.New("destination is not empty")
+	}
+
+	var (
+		mu     sync.Mutex
+		total  int64
+		errs   []error
+		dirs   []string
+		jobs   = make(chan string)
+		wg     sync.WaitGroup
+		record = func(path string, err error) {
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			mu.Unlock()
+		}
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				n, err := copyTreeFile(filepath.Join(dst, rel), filepath.Join(src, rel), &cfg, opts)
+				if err != nil {
+					record(rel, err)
+				}
+				mu.Lock()
+				total += n
+				mu.Unlock()
+			}
+		}()
+	}
+
+	walkErr := filepath.WalkDir(src, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case e.IsDir():
+			// Writable until the files are in, the mode is set at the end.
+			if err := os.Mkdir(target, 0700); err != nil && !(rel == "." && errors.Is(err, fs.ErrExist)) {
+				return err
+			}
+			dirs = append(dirs, rel)
+		case e.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			return copyTimes(target, path, unix.AT_SYMLINK_NOFOLLOW)
+		case e.Type().IsRegular():
+			jobs <- rel
+		}
+
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+
+	if walkErr != nil {
+		errs = append(errs, walkErr)
+	}
+
+	// Deepest first, as filling a directory changes its times.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel := dirs[i]
+		info, err := os.Stat(filepath.Join(src, rel))
+		if err == nil {
+			err = os.Chmod(filepath.Join(dst, rel), info.Mode().Perm())
+		}
+		if err == nil {
+			err = copyTimes(filepath.Join(dst, rel), filepath.Join(src, rel), 0)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", rel, err))
+		}
+	}
+
+	return total, errors.Join(errs...)
+}
+
+// copyTreeFile copies one regular file of CopyTree, and its times.
+func copyTreeFile(dst, src string, cfg *copyConfig, opts []CopyOption) (int64, error) {
+	var (
+		n   int64
+		err error
+	)
+	if cfg.noReflink {
+		n, err = CopyFile(dst, src, opts...)
+	} else {
+		n, err = CloneFile(dst, src, opts...)
+	}
+	if err != nil {
+		return n, err
+	}
+
+	return n, copyTimes(dst, src, 0)
+}
+
+// copyTimes gives dst the access and modification times of src. flags may
+// hold AT_SYMLINK_NOFOLLOW, to copy those of links themselves.
+func copyTimes(dst, src string, flags int) error {
+	var st unix.Stat_t
+	if err := unix.Fstatat(unix.AT_FDCWD, src, &st, flags); err != nil {
+		return &os.PathError{Op: "stat", Path: src, Err: err}
+	}
+
+	ts := []unix.Timespec{st.Atim, st.Mtim}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, dst, ts, flags); err != nil {
+		return &os.PathError{Op: "utimes", Path: dst, Err: err}
+	}
+
+	return nil
+}
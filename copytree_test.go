@@ -0,0 +1,132 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyTree(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	src := filepath.Join(dir, "src")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	files := map[string][]byte{}
+	for i := 0; i < 20; i++ {
+		rel := filepath.Join(fmt.Sprintf("d%d", i%3), fmt.Sprintf("f%d", i))
+		if i%2 == 0 {
+			rel = filepath.Join("nested", rel)
+		}
+		data := bytes.Repeat([]byte{byte(i)}, 1000*i+7)
+		files[rel] = data
+
+		path := filepath.Join(src, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("d0/f0", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "d1"), 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(src, "d1"), 0755)
+
+	dst := filepath.Join(dir, "dst")
+	if _, err := CopyTree(filepath.Join(src, "d0"), src); err == nil {
+		t.Fatal("copy into the source accepted")
+	}
+
+	n, err := CopyTree(dst, src, CopyWorkers(3), CopySparse(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dst, "d1"), 0755)
+
+	var want int64
+	for rel, data := range files {
+		want += int64(len(data))
+
+		path := filepath.Join(dst, rel)
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: content mismatch", rel)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+			t.Fatalf("%s: got mode %v, time %v", rel, info.Mode(), info.ModTime())
+		}
+	}
+	if n != want {
+		t.Fatalf("copied %d bytes, want %d", n, want)
+	}
+
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "d0/f0" {
+		t.Fatalf("link: got %q, %v", link, err)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "d1")); err != nil || info.Mode().Perm() != 0500 {
+		t.Fatalf("directory mode: got %v, %v", info.Mode(), err)
+	}
+}
+
+func TestCopyTreeDestination(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	src := filepath.Join(dir, "tree")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "f"), []byte("tree"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("file"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dst := range []string{
+		src,
+		filepath.Join(src, "d"),
+		filepath.Join(src, "..d"),
+		file,
+	} {
+		if _, err := CopyTree(dst, src); err == nil {
+			t.Errorf("copy to %s accepted", dst)
+		}
+	}
+	if got, err := os.ReadFile(file); err != nil || string(got) != "file" {
+		t.Fatalf("the file at dst became %q, %v", got, err)
+	}
+
+	// A sibling whose name starts with the one of the source is outside it.
+	dst := filepath.Join(dir, "tree..copy")
+	if _, err := CopyTree(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "f")); err != nil || string(got) != "tree" {
+		t.Fatalf("copied %q, %v", got, err)
+	}
+}
@@ -0,0 +1,65 @@
+package directio
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Config holds the package defaults SetDefaults overrides.
+type Config struct {
+	// BufferSize is the buffer size of New, and of the constructors given a
+	// size of 0. 16KB by default.
+	BufferSize int
+
+	// MinBufferSize is the smallest buffer a writer gets, smaller sizes are
+	// raised to it. 16KB by default.
+	MinBufferSize int
+
+	// FallbackAlignment is the alignment used when the system can't tell
+	// the one of a file, and by the writers wrapping an io.Writer of unknown
+	// alignment. It must be a power of two, 4096 by default.
+	FallbackAlignment int
+}
+
+// defaults is the Config of SetDefaults, nil until it is called.
+var defaults atomic.Pointer[Config]
+
+// config returns the package defaults in effect.
+func config() Config {
+	if c := defaults.Load(); c != nil {
+		return *c
+	}
+
+	return Config{
+		BufferSize:        defaultBufSize,
+		MinBufferSize:     defaultBufSize,
+		FallbackAlignment: fallbackAlignment,
+	}
+}
+
+// SetDefaults overrides the package defaults with the non-zero fields of c,
+// for the writers and readers created afterwards, so embedders can tune them
+// once instead of passing options everywhere. Alignments already detected
+// stay cached, see InvalidateAlignmentCache.
+func SetDefaults(c Config) error {
+	if c.BufferSize < 0 || c.MinBufferSize < 0 {
+		return errors.New("buffer size must not be negative")
+	}
+	if c.FallbackAlignment < 0 || c.FallbackAlignment&(c.FallbackAlignment-1) != 0 {
+		return errors.New("fallback alignment must be a power of two")
+	}
+
+	cur := config()
+	if c.BufferSize > 0 {
+		cur.BufferSize = c.BufferSize
+	}
+	if c.MinBufferSize > 0 {
+		cur.MinBufferSize = c.MinBufferSize
+	}
+	if c.FallbackAlignment > 0 {
+		cur.FallbackAlignment = c.FallbackAlignment
+	}
+	defaults.Store(&cur)
+
+	return nil
+}
@@ -2,22 +2,32 @@ package directio
 
 import (
 	"errors"
+	"hash"
 	"io"
 	"os"
-	"path/filepath"
-	"syscall"
+	"runtime"
+	"sync"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
 
+// The defaults until SetDefaults overrides them.
 const (
 	// Default buffer is 16KB (4 pages).
 	defaultBufSize = 16384
+
+	// Alignment used for buffers when the destination alignment is unknown.
+	fallbackAlignment = 4096
 )
 
 var _ io.WriteCloser = (*DirectIO)(nil)
 
+// ErrUnalignedOffset is returned when a file offset doesn't meet the direct
+// I/O offset alignment of the file.
+var ErrUnalignedOffset = errors.New("offset is not aligned for direct I/O")
+
 // align returns an offset for alignment for buffer b and size.
 func align(b []byte, size int) int {
 	if size <= 0 || len(b) == 0 {
@@ -27,6 +37,15 @@ func align(b []byte, size int) int {
 	return int(uintptr(unsafe.Pointer(&b[0])) % uintptr(size))
 }
 
+// alignUp rounds n up to a multiple of blockSize.
+func alignUp(n, blockSize int) int {
+	if rem := n % blockSize; rem != 0 {
+		n += blockSize - rem
+	}
+
+	return n
+}
+
 // allocAlignedBuf allocates buffer of size n that is aligned by blockSize.
 func allocAlignedBuf(blockSize, n int) ([]byte, error) {
 	if blockSize <= 0 {
@@ -64,86 +83,249 @@ func allocAlignedBuf(blockSize, n int) ([]byte, error) {
 
 // DirectIO bypasses page cache.
 type DirectIO struct {
-	f         *os.File
+	f         Backend
 	buf       []byte
 	n         int
 	err       error
 	blockSize int
 	isClosed  bool
-}
 
-func GetBestAlignment(path string) int {
-	var stat syscall.Statfs_t
+	// written counts the bytes accepted by Write, off is the file offset
+	// the next flushed byte lands at.
+	written int64
+	off     int64
 
-	// Ensure we check the directory if the file doesn't exist yet
-	checkPath := path
-	if info, err := os.Stat(path); err != nil || !info.IsDir() {
-		checkPath = filepath.Dir(path)
-	}
+	// positional writers write at off with WriteAt and leave the file
+	// offset alone, see Regions. pool is where their buffers come from.
+	positional bool
+	pool       *bufPool
 
-	if err := syscall.Statfs(checkPath, &stat); err != nil {
-		// Fallback: 4KB is the safest bet for almost all modern Linux servers
-		return 4096
-	}
+	allowAppend bool
+	strict      bool
 
-	// Usually 4096 on ext4/xfs/btrfs
-	blockSize := int(stat.Bsize)
+	// pending holds the writes of WriteAsync not synced yet, in order.
+	pending []pendingWrite
 
-	// O_DIRECT usually requires at least 512.
-	// If Statfs returns something weird (like 0 or 1), force 4096.
-	if blockSize < 512 {
-		return 4096
-	}
+	hash    hash.Hash
+	trailer bool
+	sum     []byte
+	chunks  *chunker
 
-	// Optimization: If the FS says 512, but we are on a 4Kn drive,
-	// 512 writes will be slow (Read-Modify-Write).
-	// It is almost always better to upgrade 512 -> 4096.
-	// Remember that it's always best to use the disk's PHY-SEC and not its LOG-SEC (you can check that using `lsblk -o NAME,PHY-SEC,LOG-SEC`). The disk's LOG-SEC is an emulated value which exists so the disk can support older kernel versions.
-	// Note that the DIOMemAlign() function in statx.go uses Statx to ask the kernel to get the disk's sector size. However in most cases, the kernel returns the LOG-SEC instead of the PHY-SEC, and this results in issues with short-sized writes. That's why we no longer rely on statx.go in this fork of the project
-	if blockSize < 4096 {
-		return 4096
-	}
+	verify  bool
+	verifyF *os.File
+	scratch []byte
+
+	noSplice bool
+	pipe     []int
+
+	// devSize is the size of the target block device, 0 for regular files.
+	devSize int64
+
+	// offsetAlign is the file offset alignment O_DIRECT requires, 0 if unknown.
+	offsetAlign int
+	alignSource AlignmentSource
+	fixedAlign  bool
+	resetPolicy ResetPolicy
+	tail        TailStrategy
+
+	// engine is how data reaches the file, dropOff and dropEnd the range
+	// EngineNoCache still has to evict from the page cache.
+	engine  Engine
+	reason  string
+	dropOff int64
+	dropEnd int64
 
-	return blockSize
+	limiter *Limiter
+	ioprio  int
+
+	// maxSize is the budget of WithMaxSize, flushed the bytes written to the file.
+	maxSize int64
+	flushed int64
+
+	progress func(written, flushed int64)
+	reported int64
+	observer func(bytes int, d time.Duration)
+
+	tees []io.Writer
+
+	// closer is closed by Close, for files the writer owns: those of
+	// WithCloseFile, when closeFile is set.
+	closer    io.Closer
+	closeFile bool
+
+	// released is set once Close has released the buffer, isClosed once
+	// the writer took its last data.
+	released bool
+
+	failpoints map[FailurePoint]func() error
+
+	journal bool
+
+	syncPolicy SyncPolicy
+	unsynced   int64
+
+	// adaptMax and adaptMin bound the buffer of WithAdaptiveBuffer,
+	// lastFull is when it was last flushed because full.
+	adaptMax int
+	adaptMin int
+	lastFull time.Time
+
+	fast     fastPath
+	fastWarn func(format string, args ...any)
+
+	leakLog func(format string, args ...any)
+	leak    *leakCheck
+
+	// bufAdvice is the advice of WithBufferAdvice, mapped the region
+	// holding the buffer then.
+	bufAdvice []BufferAdvice
+	mapped    []byte
+
+	// mu guards the writer with WithConcurrentWrites, and against the
+	// background flushes of WithFlushInterval. It is only used with them.
+	mu         sync.Mutex
+	concurrent bool
+	interval   time.Duration
+	timer      *time.Timer
 }
 
 // NewSize returns a new DirectIO writer.
-func NewSize(f *os.File, size int) (*DirectIO, error) {
-	if err := checkDirectIO(f.Fd()); err != nil {
+func NewSize(f *os.File, size int, opts ...Option) (*DirectIO, error) {
+	return newWriter(f, size, EngineDirect, opts)
+}
+
+func newWriter(f Backend, size int, engine Engine, opts []Option) (*DirectIO, error) {
+	d := &DirectIO{
+		f:        f,
+		isClosed: false,
+		engine:   engine,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.applyEnv()
+
+	if err := d.attach(true); err != nil {
+		return nil, err
+	}
+	if err := d.replaceBuf(bufSize(size, d.blockSize)); err != nil {
 		return nil, err
 	}
 
-	// Get the file optimal block size dynamically
-	align := GetBestAlignment(f.Name())
+	d.startFlushTimer()
+	d.trackLeak()
 
-	blockSize := align
+	return d, nil
+}
 
+// bufSize returns the buffer size of a writer asked for size bytes: the
+// default buffer size for 0, at least the minimum one, rounded up to
+// blockSize.
+func bufSize(size, blockSize int) int {
+	c := config()
 	if size <= 0 {
-		size = defaultBufSize
+		size = c.BufferSize
 	}
-	if size < defaultBufSize {
-		size = defaultBufSize
+	if size < c.MinBufferSize {
+		size = c.MinBufferSize
 	}
 	if rem := size % blockSize; rem != 0 {
 		size += blockSize - rem
 	}
 
-	buf, err := allocAlignedBuf(blockSize, size)
+	return size
+}
+
+// attach prepares the writer for the backend d.f: checks its mode, detects
+// its alignment if detect is set, and finds the offset writing starts at.
+func (d *DirectIO) attach(detect bool) error {
+	if d.engine == EngineDirect {
+		if err := d.checkDirect(); err != nil {
+			return err
+		}
+	} else if err := d.setDirect(false); err != nil {
+		return err
+	}
+
+	appending, err := d.checkAppend()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &DirectIO{
-		buf:       buf,
-		f:         f,
-		blockSize: blockSize,
-		isClosed:  false,
-	}, nil
+	var info os.FileInfo
+	if st, ok := d.f.(statter); ok {
+		if info, err = st.Stat(); err != nil {
+			return err
+		}
+	}
+
+	var dev blockDevice
+	offsetAlign := d.offsetAlign
+	switch {
+	case !detect:
+		// Keep the alignment, only a device has to be looked at for its size.
+		if info != nil && isBlockDevice(info) {
+			if dev, err = queryBlockDevice(d.f.Fd()); err != nil {
+				return err
+			}
+		}
+	case d.blockSize != 0:
+		// Set by WithAlignment.
+		if d.blockSize < 0 || d.blockSize&(d.blockSize-1) != 0 {
+			return errors.New("block size must be a power of two")
+		}
+		offsetAlign = d.blockSize
+	case info != nil && isBlockDevice(info):
+		// Raw device: its sector size is the constraint and its size the bound.
+		if dev, err = queryBlockDevice(d.f.Fd()); err != nil {
+			return err
+		}
+		d.blockSize = dev.alignment()
+		d.alignSource = AlignmentSectorSize
+		offsetAlign = dev.logical
+	default:
+		// Get the file optimal block size dynamically. Ask through the fd,
+		// the file may have been renamed or have no name at all (O_TMPFILE).
+		a := cachedFdAlignment(d.f.Fd())
+		d.blockSize, d.alignSource = a.blockSize, a.source
+		offsetAlign = a.offsetAlign
+	}
+	d.devSize = dev.size
+
+	if s, ok := d.f.(io.Seeker); ok && !d.positional {
+		// In append mode the data lands at the end, not at the offset.
+		whence := io.SeekCurrent
+		if appending {
+			whence = io.SeekEnd
+		}
+		if d.off, err = s.Seek(0, whence); err != nil {
+			return err
+		}
+	} else if !d.positional {
+		d.off = 0
+	}
+
+	if d.engine == EngineDirect {
+		// Every flush lands at the current offset, which must be aligned.
+		d.offsetAlign = offsetAlign
+		if err := d.checkOffset(d.off); err != nil {
+			return err
+		}
+	}
+
+	if d.closeFile {
+		if c, ok := d.f.(io.Closer); ok {
+			d.closer = c
+		}
+	}
+
+	return nil
 }
 
 // New returns a new DirectIO writer with default buffer size.
-func New(f *os.File) (*DirectIO, error) {
-	return NewSize(f, defaultBufSize)
+func New(f *os.File, opts ...Option) (*DirectIO, error) {
+	return NewSize(f, 0, opts...)
 }
 
 // flush writes buffered data to the underlying os.File.
@@ -156,7 +338,7 @@ func (d *DirectIO) flush() error {
 		return nil
 	}
 
-	n, err := d.f.Write(d.buf[0:d.n])
+	n, err := d.writeFile(d.buf[0:d.n])
 
 	if n < d.n && err == nil {
 		err = io.ErrShortWrite
@@ -169,24 +351,207 @@ func (d *DirectIO) flush() error {
 	}
 
 	d.n -= n
+	if err == nil {
+		d.adaptFlush()
+	}
+
 	return err
 }
 
+// writeFile writes p to the underlying os.File at the current offset.
+// Every write to the file goes through here.
+func (d *DirectIO) writeFile(p []byte) (int, error) {
+	n, err := d.writeOut(p)
+
+	if err == nil && n > 0 && d.tees != nil {
+		err = d.tee(p[:n])
+	}
+
+	if err == nil && n > 0 {
+		err = d.failAt(FailAfterFlush)
+	}
+
+	return n, err
+}
+
+// writeOut is writeFile without feeding the tees of WithTee and WithHasher.
+func (d *DirectIO) writeOut(p []byte) (int, error) {
+	if d.devSize > 0 && d.off+int64(len(p)) > d.devSize {
+		return 0, ErrDeviceBounds
+	}
+
+	if d.limiter != nil {
+		d.limiter.Wait(len(p))
+		d.limiter.acquire(len(p))
+		defer d.limiter.release(len(p))
+	}
+
+	var start time.Time
+	if d.observer != nil {
+		start = time.Now()
+	}
+
+	var n int
+	var err error
+	if d.ioprio != 0 {
+		n, err = d.writePriority(p)
+	} else {
+		n, err = d.writeEngine(p)
+	}
+
+	if n > 0 && d.observer != nil {
+		d.observer(n, time.Since(start))
+	}
+
+	if err == nil && n > 0 && d.verify {
+		err = d.verifyRange(p[:n], d.off)
+	}
+
+	if n > 0 && d.engine == EngineNoCache {
+		d.dropBehind(d.off, n)
+	}
+
+	d.off += int64(n)
+	d.flushed += int64(n)
+
+	if err == nil && n > 0 {
+		err = d.syncAfterWrite(n)
+	}
+
+	return n, err
+}
+
+// tee feeds data just written to the file to the tees.
+func (d *DirectIO) tee(p []byte) error {
+	for _, w := range d.tees {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeEngine writes p at the current file offset with the engine of the writer.
+func (d *DirectIO) writeEngine(p []byte) (int, error) {
+	if d.positional {
+		return d.f.WriteAt(p, d.off)
+	}
+	if d.engine == EngineDontCache {
+		return d.writeDontCache(p)
+	}
+
+	return d.f.Write(p)
+}
+
+// writePriority is writeEngine with the I/O priority of WithIOPriority.
+func (d *DirectIO) writePriority(p []byte) (int, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	old, err := setThreadIOPriority(d.ioprio)
+	if err != nil {
+		return 0, err
+	}
+	defer setThreadIOPriority(old)
+
+	return d.writeEngine(p)
+}
+
+// checkOffset validates a file offset against the direct I/O offset
+// alignment of the file.
+func (d *DirectIO) checkOffset(off int64) error {
+	if d.offsetAlign > 0 && off%int64(d.offsetAlign) != 0 {
+		return ErrUnalignedOffset
+	}
+
+	return nil
+}
+
+// BlockSize returns the block size the writer aligns its writes to.
+func (d *DirectIO) BlockSize() int { return d.blockSize }
+
+// AlignmentSource returns where the block size of the writer came from.
+func (d *DirectIO) AlignmentSource() AlignmentSource { return d.alignSource }
+
 // Available returns how many bytes are unused in the buffer.
 func (d *DirectIO) Available() int { return len(d.buf) - d.n }
 
 // Buffered returns the number of bytes that have been written into the current buffer.
 func (d *DirectIO) Buffered() int { return d.n }
 
+// LogicalOffset returns the number of bytes accepted by Write and ReadFrom
+// since the writer was created, flushed or not: the offset in the output of
+// the next byte written, e.g. to record where a frame starts. The checksum
+// trailer of WithChecksumTrailer isn't counted. After Seek, use
+// Seek(0, io.SeekCurrent) for the file offset instead.
+func (d *DirectIO) LogicalOffset() int64 { return d.written }
+
 // Write writes the contents of p into the buffer.
 // It returns the number of bytes written.
 // If nn < len(p), it also returns an error explaining
 // why the write is short.
 func (d *DirectIO) Write(p []byte) (nn int, err error) {
+	d.lock()
+	defer d.unlock()
+
 	if d.isClosed {
 		return 0, errors.New("the writer is closed")
 	}
 
+	return d.writeData(p)
+}
+
+// writeData is Write on the locked, open writer.
+func (d *DirectIO) writeData(p []byte) (nn int, err error) {
+	if d.strict {
+		return d.writeStrict(p)
+	}
+
+	d.adaptIdle()
+
+	var over bool
+	if q := d.quota(); q >= 0 && int64(len(p)) > q {
+		p, over = p[:q], true
+	}
+
+	nn, err = d.write(p)
+	d.accept(p[:nn])
+	d.report()
+
+	if err == nil && over {
+		err = d.quotaError()
+	}
+
+	return nn, err
+}
+
+// accept accounts for data taken in by Write or ReadFrom.
+func (d *DirectIO) accept(p []byte) {
+	d.written += int64(len(p))
+
+	if d.hash != nil {
+		d.hash.Write(p)
+	}
+	if d.chunks != nil {
+		d.chunks.write(p)
+	}
+}
+
+// report calls the WithProgress callback if data was flushed since the
+// last call. It runs once the data that caused the flush is accounted for.
+// The padding of TailPad and the checksum trailer are flushed after all the
+// data and aren't reported.
+func (d *DirectIO) report() {
+	flushed := min(d.flushed, d.written)
+	if d.progress != nil && flushed != d.reported {
+		d.reported = flushed
+		d.progress(d.written, flushed)
+	}
+}
+
+// write buffers p and flushes full blocks to the underlying os.File.
+func (d *DirectIO) write(p []byte) (nn int, err error) {
 	// Write more than available in buffer.
 	for len(p) >= d.Available() && d.err == nil {
 		var n int
@@ -198,7 +563,8 @@ func (d *DirectIO) Write(p []byte) (nn int, err error) {
 			if (len(p) % d.blockSize) == 0 {
 				// Data and buffer p are already aligned to block size.
 				// So write directly from p to avoid copy.
-				n, d.err = d.f.Write(p)
+				n, d.err = d.writeFile(p)
+				d.fast.direct += int64(n)
 			} else {
 				// Data needs alignment. Buffer alredy aligned.
 
@@ -207,16 +573,19 @@ func (d *DirectIO) Write(p []byte) (nn int, err error) {
 
 				// Write directly from p to avoid copy.
 				var nl int
-				nl, d.err = d.f.Write(p[:l])
+				nl, d.err = d.writeFile(p[:l])
+				d.fast.direct += int64(nl)
 
 				// Save other data to buffer.
 				n = copy(d.buf[d.n:], p[l:])
 				d.n += n
+				d.fast.short += int64(n)
 
 				// written and buffered data
 				n += nl
 			}
 		} else {
+			d.fast.copied(p[:d.Available()], d.n, d.blockSize)
 			n = copy(d.buf[d.n:], p)
 			d.n += n
 			err = d.flush()
@@ -232,6 +601,7 @@ func (d *DirectIO) Write(p []byte) (nn int, err error) {
 		return nn, d.err
 	}
 
+	d.fast.copied(p, d.n, d.blockSize)
 	n := copy(d.buf[d.n:], p)
 	d.n += n
 	nn += n
@@ -241,16 +611,136 @@ func (d *DirectIO) Write(p []byte) (nn int, err error) {
 
 // Close writes any data left in the writer buffer
 //
-// Note that this function doesn't close the underlying os.File
+// Note that this function doesn't close the underlying os.File, unless the
+// writer was created with WithCloseFile,
 // it's the caller's responsibility to close the underlying os.File
 //
-// If the last bit of data aren't in a perfect aligned block, Close also calls Sync() on the underlying os.File
-func (d *DirectIO) Close() error {
-	if d.isClosed {
+// If the last bit of data aren't in a perfect aligned block, Close also calls Sync() on the underlying os.File,
+// unless WithSyncPolicy sets another policy.
+// How that last bit is written is set by WithTailStrategy. Block devices default to TailPad.
+func (d *DirectIO) Close() (err error) {
+	d.lock()
+	defer d.unlock()
+
+	if d.released {
 		return errors.New("the writer is already closed")
 	}
 
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	if d.closer != nil {
+		defer func() {
+			if cerr := d.closer.Close(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+
+	defer d.releaseVerify()
+	defer func() {
+		// The buffer must stay if Close can be retried.
+		if d.isClosed {
+			d.releaseBuf()
+			d.recycleBuf()
+			d.released = true
+			if d.leak != nil {
+				d.leak.closed.Store(true)
+			}
+		}
+	}()
+	defer d.closePipe()
+
+	if d.isClosed {
+		// Finish did the rest.
+		return nil
+	}
+
+	return d.finish(false)
+}
+
+// release frees a writer its constructor created, then failed to set up.
+// Unlike Close it writes nothing and leaves the file open, even with
+// WithCloseFile: the file is still the caller's.
+func (d *DirectIO) release() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.closePipe()
+	d.releaseVerify()
+	d.releaseBuf()
+	d.recycleBuf()
+	d.isClosed, d.released = true, true
+	if d.leak != nil {
+		d.leak.closed.Store(true)
+	}
+}
+
+// Finish writes out the buffered data and the tail like Close, then syncs
+// the file whatever the sync policy, and returns the number of bytes the
+// writer accepted, all of them now durable. Unlike Close, it keeps the
+// buffer and the file: the writer takes no more data, but can be pointed
+// at a new file with Reset. Close still has to be called in the end, it
+// then only releases the writer.
+func (d *DirectIO) Finish() (int64, error) {
+	d.lock()
+	defer d.unlock()
+
+	if d.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	if err := d.finish(true); err != nil {
+		return 0, err
+	}
+
+	return d.written, nil
+}
+
+// finish is the part of Close writing out the data. It syncs the file as
+// the sync policy says, and always if sync is set.
+func (d *DirectIO) finish(sync bool) (err error) {
+	defer d.report()
+
+	if d.chunks != nil {
+		d.chunks.flush()
+	}
+
+	if d.pending != nil {
+		// Runs after the sync below.
+		defer func() {
+			d.failPending(err)
+		}()
+	}
+	if sync || d.syncOnClose() || d.pending != nil {
+		defer func() {
+			if err == nil {
+				err = d.sync()
+			}
+		}()
+	}
+
+	if d.hash != nil {
+		d.sum = d.hash.Sum(nil)
+
+		if d.trailer {
+			if _, err := d.write(checksumTrailer(d.sum, d.written)); err != nil {
+				return err
+			}
+		}
+	}
+
 	d.isClosed = true
+	d.warnFastPath()
+
+	if d.engine == EngineNoCache {
+		defer d.dropAll()
+	}
 
 	if d.n == 0 {
 		return nil
@@ -263,7 +753,7 @@ func (d *DirectIO) Close() error {
 	// 2. Phase 1: Write the Aligned Bulk (Direct I/O)
 	//    We do this first while O_DIRECT is still enabled.
 	if alignedSize > 0 {
-		n, err := d.f.Write(d.buf[:alignedSize])
+		n, err := d.writeFile(d.buf[:alignedSize])
 		if err != nil {
 			return err
 		}
@@ -273,28 +763,69 @@ func (d *DirectIO) Close() error {
 		d.n -= n
 	}
 
-	// 3. Phase 2: Write the Tail (Buffered I/O)
-	//    If there are any bytes left (the unaligned remainder),
-	//    we must disable O_DIRECT to write them safely.
+	// 3. Phase 2: Write the Tail
+	//    If there are any bytes left (the unaligned remainder), either pad
+	//    them to a full block or write them with O_DIRECT disabled.
 	if d.n > 0 {
+		if err := d.failAt(FailAfterBulk); err != nil {
+			return err
+		}
+
+		if d.journal {
+			if err := d.writeJournal(); err != nil {
+				return err
+			}
+			defer func() {
+				if err == nil {
+					err = d.clearJournal()
+				}
+			}()
+
+			if err := d.failAt(FailAfterJournal); err != nil {
+				return err
+			}
+		}
+
+		if d.tailStrategy() == TailPad {
+			if err := d.writePaddedTail(); err != nil {
+				return err
+			}
+
+			d.syncTail()
+
+			return nil
+		}
+
+		if d.engine != EngineDirect {
+			// Already buffered, no flag to toggle.
+			if _, err := d.writeFile(d.buf[:d.n]); err != nil {
+				return err
+			}
+			d.n = 0
+
+			d.syncTail()
+
+			return nil
+		}
+
 		// Disable Direct IO temporarily
-		if err := setDirectIO(d.f.Fd(), false); err != nil {
+		if err := d.setDirect(false); err != nil {
 			return err
 		}
 
 		// Standard buffered write (touches Page Cache)
-		n, err := d.f.Write(d.buf[:d.n])
+		n, err := d.writeFile(d.buf[:d.n])
 
 		// CRITICAL: Re-enable Direct IO immediately
 		// Even if the write failed, we try to restore the state.
-		_ = setDirectIO(d.f.Fd(), true)
+		_ = d.setDirect(true)
 
 		if err != nil {
 			return err
 		}
 		d.n -= n
 
-		d.f.Sync() // sync the file to flush the final bit of data to the disk immediately
+		d.syncTail() // sync the file to flush the final bit of data to the disk immediately
 
 		// Advise the kernel to drop the pagecache immediately for the data that we wrote without O_DIRECT above
 		// Fd() returns uintptr, Fadvise expects int
@@ -306,3 +837,68 @@ func (d *DirectIO) Close() error {
 
 	return nil
 }
+
+// tailStrategy resolves TailAuto for the target of the writer.
+func (d *DirectIO) tailStrategy() TailStrategy {
+	if d.engine != EngineDirect {
+		return TailBuffered
+	}
+
+	if d.tail != TailAuto {
+		return d.tail
+	}
+
+	if d.devSize > 0 || d.positional {
+		return TailPad
+	}
+
+	return TailBuffered
+}
+
+// writePaddedTail writes the buffered tail zero padded to a full block with
+// O_DIRECT. On regular files the padding is truncated away again, except by
+// positional writers, and the file offset is moved back to the end of the
+// data.
+func (d *DirectIO) writePaddedTail() error {
+	size := alignUp(d.n, d.blockSize)
+	for i := d.n; i < size; i++ {
+		d.buf[i] = 0
+	}
+
+	end := d.off + int64(d.n)
+
+	// The tees only get the data, not the padding.
+	if _, err := d.writeOut(d.buf[:size]); err != nil {
+		return err
+	}
+	if d.tees != nil {
+		if err := d.tee(d.buf[:d.n]); err != nil {
+			return err
+		}
+	}
+	d.n = 0
+
+	// Positional writers leave the padding to the owner of the file, who
+	// knows its final size: another region may be growing the file meanwhile.
+	if t, ok := d.f.(truncater); ok && d.devSize == 0 && !d.positional {
+		// Only cut what the padding added, data already past it must stay.
+		info, err := t.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && info.Size() == d.off {
+			if err := t.Truncate(end); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s, ok := d.f.(io.Seeker); ok && !d.positional {
+		if _, err := s.Seek(end, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	d.off = end
+
+	return nil
+}
@@ -5,11 +5,20 @@ package directio
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 var (
@@ -23,8 +32,8 @@ var (
 )
 
 func tmpDir(t testing.TB) (string, func()) {
-	dir := fmt.Sprintf("/var/tmp/directio-test-%s", time.Now().Format("20060102150405"))
-	if err := os.Mkdir(dir, os.ModePerm); err != nil {
+	dir, err := os.MkdirTemp("/var/tmp", fmt.Sprintf("directio-test-%s-", time.Now().Format("20060102150405")))
+	if err != nil {
 		t.Fatal(err)
 	}
 
@@ -104,3 +113,1664 @@ func TestWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestChecksumTrailer(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "checksum")
+	dio, err := New(f, WithChecksum(sha256.New()), WithChecksumTrailer(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("checksum"), 5000)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if want := sha256.Sum256(data); !bytes.Equal(dio.Sum(), want[:]) {
+		t.Fatalf("Sum = %x, want %x", dio.Sum(), want)
+	}
+	if err := VerifyFile(f.Name(), sha256.New()); err != nil {
+		t.Fatalf("VerifyFile = %v", err)
+	}
+
+	// Flip one byte of data and verify again.
+	rw, err := os.OpenFile(f.Name(), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.WriteAt([]byte{'X'}, 100)
+	rw.Close()
+
+	if err := VerifyFile(f.Name(), sha256.New()); err != ErrChecksumMismatch {
+		t.Fatalf("VerifyFile = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "verify")
+	defer f.Close()
+
+	dio, err := New(f, WithVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("verify"), 10000)
+	for _, n := range writesizes {
+		if _, err := dio.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A byte changed on disk behind the writer's back must be reported at
+	// its offset.
+	f2 := tmpFile(t, dir, "verify-corrupt")
+	defer f2.Close()
+
+	const at = 20007
+	dio, err = NewBackend(&corruptingFile{File: f2, at: at}, 0, WithVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range writesizes {
+		if _, err = dio.Write(data[:n]); err != nil {
+			break
+		}
+	}
+	if cerr := dio.Close(); err == nil {
+		err = cerr
+	}
+
+	var ce *CorruptionError
+	if !errors.As(err, &ce) {
+		t.Fatalf("err = %v, want a *CorruptionError", err)
+	}
+	if ce.Offset != at {
+		t.Fatalf("corruption reported at %d, want %d", ce.Offset, at)
+	}
+}
+
+// corruptingFile flips the byte at offset at through a buffered descriptor
+// once a write to f has covered it.
+type corruptingFile struct {
+	*os.File
+	at   int64
+	pos  int64
+	done bool
+}
+
+func (c *corruptingFile) Write(p []byte) (int, error) {
+	n, err := c.File.Write(p)
+	if !c.done && c.at >= c.pos && c.at < c.pos+int64(n) {
+		c.done = true
+		if err := corruptByte(c.Name(), c.at, p[c.at-c.pos]); err != nil {
+			return n, err
+		}
+	}
+	c.pos += int64(n)
+
+	return n, err
+}
+
+// corruptByte replaces the byte b at off in the file at path with its
+// complement.
+func corruptByte(path string, off int64, b byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt([]byte{^b}, off); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func TestReadFrom(t *testing.T) {
+	data := make([]byte, 1<<20+333)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		// Mix block sized and odd sized writes into the pipe.
+		p := data
+		for i := 0; len(p) > 0; i++ {
+			n := 4096
+			if i%3 == 0 {
+				n = 1000
+			}
+			if n > len(p) {
+				n = len(p)
+			}
+			pw.Write(p[:n])
+			p = p[n:]
+		}
+		pw.Close()
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		for p := data; len(p) > 0; {
+			n := min(len(p), 70000)
+			c.Write(p[:n])
+			p = p[n:]
+		}
+		c.Close()
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sources := map[string]io.Reader{
+		"pipe":   pr,
+		"socket": conn,
+		"reader": bytes.NewReader(data),
+	}
+	for name, r := range sources {
+		f := tmpFile(t, dir, "readfrom-"+name)
+		dio, err := New(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := io.Copy(dio, r)
+		if err != nil {
+			t.Fatalf("%s: io.Copy = %v", name, err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("%s: io.Copy copied %d bytes", name, n)
+		}
+		if err := dio.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		written, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(written, data) {
+			t.Fatalf("%s: wrong bytes were written", name)
+		}
+	}
+}
+
+func TestReadFromSpliceOptions(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	data := make([]byte, 3<<19)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+
+	var (
+		written, flushed int64
+		observed         int
+		flushes          int
+	)
+	cases := []struct {
+		name   string
+		opts   []Option
+		setup  func(d *DirectIO)
+		splice bool
+		check  func(t *testing.T, elapsed time.Duration, err error)
+	}{
+		{
+			name: "progress",
+			opts: []Option{WithProgress(func(w, f int64) { written, flushed = w, f })},
+			// Spliced data is accounted for.
+			splice: true,
+			check: func(t *testing.T, _ time.Duration, err error) {
+				if written != int64(len(data)) || flushed != int64(len(data)) {
+					t.Errorf("progress reported %d written, %d flushed, want %d", written, flushed, len(data))
+				}
+			},
+		},
+		{
+			name: "limiter",
+			opts: []Option{WithRateLimit(1 << 20)},
+			check: func(t *testing.T, elapsed time.Duration, err error) {
+				// A second of burst, then half a second of waiting.
+				if elapsed < 400*time.Millisecond {
+					t.Errorf("copy took %v despite the rate limit", elapsed)
+				}
+			},
+		},
+		{
+			name: "observer",
+			opts: []Option{WithFlushObserver(func(n int, _ time.Duration) { observed += n })},
+			check: func(t *testing.T, _ time.Duration, err error) {
+				if observed != len(data) {
+					t.Errorf("observed %d bytes, want %d", observed, len(data))
+				}
+			},
+		},
+		{
+			name: "failpoint",
+			opts: []Option{WithFailurePoint(FailAfterFlush, func() error { flushes++; return nil })},
+			check: func(t *testing.T, _ time.Duration, err error) {
+				if flushes == 0 {
+					t.Error("failure point never hit")
+				}
+			},
+		},
+		{name: "syncpolicy", opts: []Option{WithSyncPolicy(SyncAlways)}},
+		{name: "ioprio", opts: []Option{WithIOPriority(IOPriorityBestEffort, 7)}},
+		{name: "nocache", setup: func(d *DirectIO) { d.engine = EngineNoCache }},
+		{
+			name:  "devsize",
+			setup: func(d *DirectIO) { d.devSize = int64(len(data) / 2) },
+			check: func(t *testing.T, _ time.Duration, err error) {
+				if !errors.Is(err, ErrDeviceBounds) {
+					t.Errorf("copy past the device size: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pr.Close()
+			go func() {
+				for p := data; len(p) > 0; p = p[min(len(p), 65536):] {
+					pw.Write(p[:min(len(p), 65536)])
+				}
+				pw.Close()
+			}()
+
+			f := tmpFile(t, dir, "splice-"+c.name)
+			defer f.Close()
+			dio, err := New(f, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.setup != nil {
+				c.setup(dio)
+			}
+			if got := dio.canSplice(); got != c.splice {
+				t.Fatalf("canSplice = %v, want %v", got, c.splice)
+			}
+
+			start := time.Now()
+			_, err = io.Copy(dio, pr)
+			if err == nil {
+				err = dio.Close()
+			}
+			elapsed := time.Since(start)
+			if c.check != nil {
+				c.check(t, elapsed, err)
+			}
+			if c.name == "devsize" {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("wrong bytes were written")
+			}
+		})
+	}
+}
+
+func TestReadFromSocketProgress(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	data := make([]byte, 3<<19)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.Write(data)
+		c.Close()
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	f := tmpFile(t, dir, "splice-socket")
+	defer f.Close()
+
+	var written, flushed int64
+	dio, err := New(f, WithProgress(func(w, fl int64) {
+		if fl > w {
+			t.Errorf("flushed %d bytes of %d written", fl, w)
+		}
+		written, flushed = w, fl
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.Copy(dio, conn); err != nil {
+		t.Fatal(err)
+	}
+	// Only a partial block may be left for Close.
+	if flushed < written-int64(dio.BlockSize()) {
+		t.Errorf("progress reported %d flushed of %d written before Close", flushed, written)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(len(data)) || flushed != int64(len(data)) {
+		t.Errorf("progress reported %d written, %d flushed, want %d", written, flushed, len(data))
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("wrong bytes were written")
+	}
+}
+
+func TestTailPad(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "tailpad")
+	defer f.Close()
+
+	dio, err := New(f, WithTailStrategy(TailPad))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("tail"), 3001)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("file holds %d bytes, want %d", len(got), len(data))
+	}
+	if pos, _ := f.Seek(0, io.SeekCurrent); pos != int64(len(data)) {
+		t.Fatalf("file offset = %d, want %d", pos, len(data))
+	}
+}
+
+func TestUnalignedOffset(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "offset")
+	defer f.Close()
+
+	if _, _, err := DIOAlignment(f.Name()); err != nil {
+		t.Skip(err)
+	}
+
+	if _, err := f.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(f); err != ErrUnalignedOffset {
+		t.Fatalf("New = %v, want %v", err, ErrUnalignedOffset)
+	}
+}
+
+func TestTmpFile(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, err := os.OpenFile(dir, os.O_WRONLY|O_DIRECT|unix.O_TMPFILE, 0666)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+
+	if _, err := DIOMemAlignFd(f.Fd()); err != nil && err != ErrFSNoDIOSupport {
+		t.Fatal(err)
+	}
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.Write(bytes.Repeat([]byte("tmp"), 10000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIOPriority(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "ioprio")
+	defer f.Close()
+
+	dio, err := New(f, WithIOPriority(IOPriorityIdle, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("idle"), 20000)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("file holds %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "maxsize")
+	defer f.Close()
+
+	const max = 40000
+
+	dio, err := New(f, WithMaxSize(max))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("quota"), 5000)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := dio.Write(data)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Write = %v, want %v", err, ErrQuotaExceeded)
+	}
+	if n != max-len(data) {
+		t.Fatalf("Write accepted %d bytes, want %d", n, max-len(data))
+	}
+
+	var qe *QuotaError
+	if !errors.As(err, &qe) || qe.Accepted != max || qe.Flushed%int64(dio.BlockSize()) != 0 {
+		t.Fatalf("QuotaError = %+v", qe)
+	}
+
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := f.Stat(); info.Size() != max {
+		t.Fatalf("file size = %d, want %d", info.Size(), max)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	// The padding and the trailer written by Close aren't the caller's data.
+	for i, opts := range [][]Option{
+		nil,
+		{WithTailStrategy(TailPad), WithChecksumTrailer(true)},
+	} {
+		f := tmpFile(t, dir, fmt.Sprintf("progress-%d", i))
+		defer f.Close()
+
+		var calls int
+		var lastWritten, lastFlushed int64
+		dio, err := New(f, append(opts, WithProgress(func(written, flushed int64) {
+			if written < lastWritten || flushed <= lastFlushed || flushed > written {
+				t.Errorf("progress went from %d/%d to %d/%d", lastWritten, lastFlushed, written, flushed)
+			}
+			calls++
+			lastWritten, lastFlushed = written, flushed
+		}))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := bytes.Repeat([]byte("progress"), 1000)
+		for i := 0; i < 20; i++ {
+			if _, err := dio.Write(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := dio.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if calls == 0 || lastWritten != int64(20*len(data)) || lastFlushed != lastWritten {
+			t.Fatalf("%d calls, last %d/%d", calls, lastWritten, lastFlushed)
+		}
+	}
+}
+
+func TestTee(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	for _, tail := range []TailStrategy{TailBuffered, TailPad} {
+		f := tmpFile(t, dir, fmt.Sprintf("tee-%d", tail))
+		defer f.Close()
+
+		var copied bytes.Buffer
+		h := sha256.New()
+		dio, err := New(f, WithTee(&copied), WithHasher(h), WithTailStrategy(tail))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var data []byte
+		for _, n := range writesizes {
+			p := bytes.Repeat([]byte{byte(n)}, n)
+			if _, err := dio.Write(p); err != nil {
+				t.Fatal(err)
+			}
+			data = append(data, p...)
+		}
+		if err := dio.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(copied.Bytes(), data) {
+			t.Fatalf("tail %d: tee got %d bytes, want %d", tail, copied.Len(), len(data))
+		}
+		if want := sha256.Sum256(data); !bytes.Equal(h.Sum(nil), want[:]) {
+			t.Fatalf("tail %d: hasher sum mismatch", tail)
+		}
+	}
+}
+
+func TestFailurePoint(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "failpoint")
+	defer f.Close()
+
+	crash := errors.New("crash")
+	dio, err := New(f, WithFailurePoint(FailAfterBulk, func() error { return crash }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("failpoint"), 5000)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != crash {
+		t.Fatalf("Close = %v, want %v", err, crash)
+	}
+
+	// Only the aligned bulk made it to the file.
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(data) - len(data)%dio.BlockSize()); info.Size() != want {
+		t.Fatalf("file size = %d, want %d", info.Size(), want)
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "interval")
+	defer f.Close()
+
+	dio, err := NewSize(f, 1<<20, WithFlushInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("interval"), 2000)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the whole blocks get flushed in the background.
+	want := int64(len(data) - len(data)%dio.BlockSize())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("file size = %d after the flush interval, want %d", info.Size(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(f.Name()); !bytes.Equal(got, data) {
+		t.Fatal("wrong bytes were written")
+	}
+}
+
+func TestBufferAdvice(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "bufadvice")
+	defer f.Close()
+
+	dio, err := NewSize(f, 4<<20, WithBufferAdvice(BufferDontFork, BufferDontDump, BufferHugePage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dio.mapped == nil || align(dio.buf, dio.BlockSize()) != 0 {
+		t.Fatal("the buffer is not an aligned mapping")
+	}
+
+	data := bytes.Repeat([]byte("advice"), 1<<20)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if dio.mapped != nil {
+		t.Error("the buffer is still mapped after Close")
+	}
+
+	if got, _ := os.ReadFile(f.Name()); !bytes.Equal(got, data) {
+		t.Fatal("wrong bytes were written")
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "concurrent")
+	defer f.Close()
+
+	dio, err := New(f, WithConcurrentWrites(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every goroutine writes whole records of its own letter.
+	const writers, records, size = 8, 500, 100
+	done := make(chan struct{})
+	for i := 0; i < writers; i++ {
+		go func(c byte) {
+			defer func() { done <- struct{}{} }()
+			rec := bytes.Repeat([]byte{c}, size)
+			for j := 0; j < records; j++ {
+				if _, err := dio.Write(rec); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(byte('a' + i))
+	}
+	for i := 0; i < writers; i++ {
+		<-done
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != writers*records*size {
+		t.Fatalf("file has %d bytes, want %d", len(got), writers*records*size)
+	}
+	for i := 0; i < len(got); i += size {
+		if !bytes.Equal(got[i:i+size], bytes.Repeat(got[i:i+1], size)) {
+			t.Fatalf("record at %d is interleaved", i)
+		}
+	}
+}
+
+func TestAppendMode(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	name := filepath.Join(dir, "append")
+	head := bytes.Repeat([]byte{'h'}, 4096)
+	if err := os.WriteFile(name, head, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := New(f); !errors.Is(err, ErrAppendMode) {
+		t.Fatalf("got %v, want ErrAppendMode", err)
+	}
+
+	dio, err := New(f, WithAppend(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte{'d'}, 5000)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, append(head, data...)) {
+		t.Fatalf("file content mismatch, got %d bytes", len(got))
+	}
+
+	// The end of the file is no longer aligned.
+	if _, err := New(f, WithAppend(true)); !errors.Is(err, ErrUnalignedOffset) {
+		t.Fatalf("got %v, want ErrUnalignedOffset", err)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "seek")
+	defer f.Close()
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reserve the header, write the body, then fill the header in.
+	header := bytes.Repeat([]byte{'h'}, 4096)
+	body := bytes.Repeat([]byte{'b'}, 8192)
+	tail := bytes.Repeat([]byte{'t'}, 100)
+	if _, err := dio.Write(make([]byte, len(header))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if pos, err := dio.Seek(0, io.SeekStart); err != nil || pos != 0 {
+		t.Fatalf("seek to the header: got %d, %v", pos, err)
+	}
+	if _, err := dio.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	if pos, err := dio.Seek(0, io.SeekEnd); err != nil || pos != 12288 {
+		t.Fatalf("seek to the end: got %d, %v", pos, err)
+	}
+	if _, err := dio.Seek(100, io.SeekStart); !errors.Is(err, ErrUnalignedOffset) {
+		t.Fatalf("unaligned seek: got %v, want ErrUnalignedOffset", err)
+	}
+	if _, err := dio.Write(tail); err != nil {
+		t.Fatal(err)
+	}
+	if pos, err := dio.Seek(0, io.SeekCurrent); err != nil || pos != 12388 {
+		t.Fatalf("current offset: got %d, %v", pos, err)
+	}
+	if _, err := dio.Seek(0, io.SeekStart); !errors.Is(err, ErrUnalignedSeek) {
+		t.Fatalf("seek with a partial block: got %v, want ErrUnalignedSeek", err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append(header, body...), tail...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("file content mismatch, got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestLogicalOffset(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "logical-offset")
+	defer f.Close()
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offs []int64
+	for _, n := range []int{17, 4096, 100000, 3} {
+		offs = append(offs, dio.LogicalOffset())
+		if _, err := dio.Write(make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dio.ReadFrom(bytes.NewReader(make([]byte, 50))); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{0, 17, 4113, 104113}
+	for i := range want {
+		if offs[i] != want[i] {
+			t.Fatalf("frame %d at %d, want %d", i, offs[i], want[i])
+		}
+	}
+	if off := dio.LogicalOffset(); off != 104166 {
+		t.Fatalf("final offset %d, want 104166", off)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPWriteAligned(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "pwrite")
+	defer f.Close()
+
+	buf, err := allocAlignedBuf(4096, 8192+4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range buf {
+		buf[i] = byte(i % 199)
+	}
+
+	if n, err := PWriteAligned(f, buf[:8192], 4096); err != nil || n != 8192 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if _, err := PWriteAligned(f, buf[1:4097], 0); !errors.Is(err, ErrUnalignedBuffer) {
+		t.Fatalf("misaligned buffer: got %v, want ErrUnalignedBuffer", err)
+	}
+	if _, err := PWriteAligned(f, buf[:100], 0); !errors.Is(err, ErrUnalignedBuffer) {
+		t.Fatalf("short buffer: got %v, want ErrUnalignedBuffer", err)
+	}
+	if _, err := PWriteAligned(f, buf[:4096], 100); !errors.Is(err, ErrUnalignedOffset) {
+		t.Fatalf("unaligned offset: got %v, want ErrUnalignedOffset", err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 12288 || !bytes.Equal(got[4096:], buf[:8192]) {
+		t.Fatalf("file content mismatch, got %d bytes", len(got))
+	}
+}
+
+func TestWriteAsync(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "write-async")
+	defer f.Close()
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var done []int
+	cb := func(i int) func(int, error) {
+		return func(n int, err error) {
+			if err != nil {
+				t.Errorf("write %d: %v", i, err)
+			}
+			done = append(done, i)
+		}
+	}
+
+	dio.WriteAsync(make([]byte, 4096), cb(0))
+	dio.WriteAsync(make([]byte, 4096), cb(1))
+	if len(done) != 0 {
+		t.Fatalf("writes %v completed while buffered", done)
+	}
+	if _, err := dio.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Fatalf("completed %v after Checkpoint, want [0 1]", done)
+	}
+
+	// The unaligned remainder is only durable once Close wrote it.
+	dio.WriteAsync(make([]byte, 100), cb(2))
+	if _, err := dio.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Fatalf("completed %v with the tail still buffered", done)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 3 {
+		t.Fatalf("completed %v after Close, want [0 1 2]", done)
+	}
+
+	var cerr error
+	dio.WriteAsync(make([]byte, 1), func(n int, err error) { cerr = err })
+	if cerr == nil {
+		t.Fatal("write to a closed writer succeeded")
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "submit")
+	defer f.Close()
+
+	dio, err := New(f, WithFlushInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := dio.Submit(make([]byte, 8192))
+	if err := h.Err(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the background flush didn't complete the write")
+	}
+	if n, err := h.Await(); n != 8192 || err != nil {
+		t.Fatalf("got %d, %v", n, err)
+	}
+
+	tail := dio.Submit(make([]byte, 10))
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := tail.Await(); n != 10 || err != nil {
+		t.Fatalf("tail: got %d, %v", n, err)
+	}
+}
+
+func TestFlushAllCloseAll(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	var ws []*DirectIO
+	for i := 0; i < 20; i++ {
+		f := tmpFile(t, dir, fmt.Sprintf("group-%d", i))
+		defer f.Close()
+
+		w, err := New(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, 4096+i)); err != nil {
+			t.Fatal(err)
+		}
+		ws = append(ws, w)
+	}
+
+	ctx := context.Background()
+	if err := FlushAll(ctx, ws...); err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range ws {
+		if w.Buffered() != i {
+			t.Fatalf("writer %d has %d bytes buffered after FlushAll, want %d", i, w.Buffered(), i)
+		}
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := CloseAll(cancelled, ws...); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	if err := CloseAll(ctx, ws...); err != nil {
+		t.Fatal(err)
+	}
+	if err := CloseAll(ctx, ws[:2]...); err == nil {
+		t.Fatal("closing closed writers succeeded")
+	}
+}
+
+func TestStrictAlignment(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "strict")
+	defer f.Close()
+
+	dio, err := New(f, WithStrictAlignment(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := dio.BlockSize()
+
+	buf, err := allocAlignedBuf(bs, 3*bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range buf {
+		buf[i] = byte(i % 193)
+	}
+
+	if n, err := dio.Write(buf[:2*bs]); n != 2*bs || err != nil {
+		t.Fatalf("aligned write: got %d, %v", n, err)
+	}
+	if dio.Buffered() != 0 {
+		t.Fatalf("%d bytes buffered in strict mode", dio.Buffered())
+	}
+
+	var serr *StrictAlignmentError
+	if _, err := dio.Write(buf[1 : bs+1]); !errors.As(err, &serr) || !serr.Misaligned || serr.Short {
+		t.Fatalf("misaligned write: got %v", err)
+	}
+	if _, err := dio.Write(buf[:100]); !errors.As(err, &serr) || serr.Misaligned || !serr.Short {
+		t.Fatalf("short write: got %v", err)
+	}
+	if !errors.Is(serr, ErrNotZeroCopy) {
+		t.Fatalf("%v doesn't match ErrNotZeroCopy", serr)
+	}
+
+	// A partial block left by ReadFrom can't be followed.
+	if _, err := dio.ReadFrom(bytes.NewReader(buf[:10])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.Write(buf[:bs]); !errors.As(err, &serr) || serr.Buffered != 10 {
+		t.Fatalf("write after a partial block: got %v", err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, append(buf[:2*bs:2*bs], buf[:10]...)) {
+		t.Fatalf("file content mismatch, got %d bytes", len(got))
+	}
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "aligned-buffer")
+	defer f.Close()
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewAlignedBuffer(dio.BlockSize(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []byte
+	// More than the writer buffers, so Write takes the zero-copy path.
+	for i := 0; i < 5000; i++ {
+		rec := fmt.Sprintf("record %d\n", i)
+		if _, err := b.WriteString(rec); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, rec...)
+	}
+	if b.Len() != len(want) || b.Cap()%dio.BlockSize() != 0 || align(b.Bytes(), dio.BlockSize()) != 0 {
+		t.Fatalf("len %d, cap %d, misaligned by %d", b.Len(), b.Cap(), align(b.Bytes(), dio.BlockSize()))
+	}
+
+	if _, err := dio.Write(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if s := dio.Stats(); s.FastPath != int64(len(want)-len(want)%dio.BlockSize()) {
+		t.Fatalf("%d bytes took the zero-copy path", s.FastPath)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("file content mismatch, got %d bytes, want %d", len(got), len(want))
+	}
+
+	b.Reset()
+	b.Write([]byte("x"))
+	if p := b.Padded(); len(p) != dio.BlockSize() || p[0] != 'x' || p[1] != 0 {
+		t.Fatalf("padded to %d bytes", len(p))
+	}
+}
+
+func TestFlushObserver(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "flush-observer")
+	defer f.Close()
+
+	var writes, total int
+	dio, err := NewSize(f, 16384, WithFlushObserver(func(n int, d time.Duration) {
+		if d <= 0 {
+			t.Errorf("write of %d bytes took %v", n, d)
+		}
+		writes++
+		total += n
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.Write(make([]byte, 3*16384+10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if writes < 2 || total != 3*16384+10 {
+		t.Fatalf("observed %d writes of %d bytes", writes, total)
+	}
+}
+
+func TestCloseFile(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "close-file")
+
+	dio, err := New(f, WithCloseFile(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.Write([]byte("owned")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("file still open after Close: %v", err)
+	}
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "owned" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestCloseFileConstructorError(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	// Constructors failing once the writer exists leave the file open.
+	for _, tc := range []struct {
+		name string
+		open func() *os.File
+		new  func(f *os.File) error
+	}{
+		{"record", func() *os.File { return tmpFile(t, dir, "close-file-record") }, func(f *os.File) error {
+			_, err := NewRecordWriter(f, 1000, WithCloseFile(true))
+			return err
+		}},
+		{"append", func() *os.File {
+			f := tmpFile(t, dir, "close-file-append")
+			if err := os.WriteFile(f.Name(), []byte("partial block"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			return f
+		}, func(f *os.File) error {
+			// The partial block can't be read back through a write-only file.
+			_, err := NewAppend(f, WithCloseFile(true))
+			return err
+		}},
+		{"part", func() *os.File { return tmpFile(t, dir, "close-file-part") }, func(f *os.File) error {
+			_, err := NewPartWriter(f, 1000, nil, func(Part) error { return nil }, WithCloseFile(true))
+			return err
+		}},
+		{"resume", func() *os.File { r, _ := readerFile(t, dir, 3*4096); return r }, func(f *os.File) error {
+			// A read-only descriptor can't be truncated.
+			_, err := ResumeAt(f, 4096, 0, WithCloseFile(true))
+			return err
+		}},
+	} {
+		f := tc.open()
+		defer f.Close()
+
+		if err := tc.new(f); err == nil {
+			t.Fatalf("%s: constructor succeeded", tc.name)
+		}
+		if _, err := f.Stat(); err != nil {
+			t.Fatalf("%s: file closed by the failed constructor: %v", tc.name, err)
+		}
+	}
+}
+
+func TestFinishReset(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	first := tmpFile(t, dir, "finish-first")
+	second := tmpFile(t, dir, "finish-second")
+	defer second.Close()
+
+	dio, err := New(first, WithCloseFile(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.Write([]byte("first file")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := dio.Finish(); err != nil || n != 10 {
+		t.Fatalf("Finish: got %d, %v", n, err)
+	}
+	if _, err := dio.Write([]byte("late")); err == nil {
+		t.Fatal("write after Finish didn't fail")
+	}
+
+	if err := dio.Reset(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("previous file still open after Reset: %v", err)
+	}
+	if _, err := dio.Write([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if got := dio.LogicalOffset(); got != 6 {
+		t.Fatalf("offset after Reset: got %d, want 6", got)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Reset(first); err == nil {
+		t.Fatal("Reset after Close didn't fail")
+	}
+
+	for f, want := range map[*os.File]string{first: "first file", second: "second"} {
+		got, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("%s: got %q, want %q", f.Name(), got, want)
+		}
+	}
+}
+
+func TestLeakCheck(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "leak")
+	defer f.Close()
+
+	leaks := make(chan string, 2)
+	logf := func(format string, args ...any) {
+		leaks <- fmt.Sprintf(format, args...)
+	}
+
+	closed, err := New(f, WithLeakCheck(logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := closed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	closed = nil
+
+	func() {
+		dio, err := New(f, WithLeakCheck(logf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dio.Write([]byte("lost"))
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(leaks) == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case msg := <-leaks:
+		if !strings.Contains(msg, "TestLeakCheck") {
+			t.Fatalf("report doesn't hold the creation stack:\n%s", msg)
+		}
+	default:
+		t.Fatal("unclosed writer not reported")
+	}
+
+	// The closed writer never is.
+	runtime.GC()
+	time.Sleep(10 * time.Millisecond)
+	if len(leaks) != 0 {
+		t.Fatalf("closed writer reported:\n%s", <-leaks)
+	}
+}
+
+func TestResetPolicy(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	for _, policy := range []ResetPolicy{ResetKeepAlignment, ResetRedetect, ResetSameAlignment} {
+		first := tmpFile(t, dir, fmt.Sprintf("reset-policy-first-%d", policy))
+		defer first.Close()
+		second := tmpFile(t, dir, fmt.Sprintf("reset-policy-second-%d", policy))
+		defer second.Close()
+
+		dio, err := New(first, WithResetPolicy(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dio.Finish(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Pretend the first file had a smaller alignment than the second.
+		detected := dio.BlockSize()
+		dio.blockSize, dio.offsetAlign = detected/2, detected/2
+
+		err = dio.Reset(second)
+		switch policy {
+		case ResetKeepAlignment:
+			if err != nil || dio.BlockSize() != detected/2 {
+				t.Fatalf("keep: got block size %d, %v", dio.BlockSize(), err)
+			}
+		case ResetRedetect:
+			if err != nil || dio.BlockSize() != detected {
+				t.Fatalf("redetect: got block size %d, %v", dio.BlockSize(), err)
+			}
+		case ResetSameAlignment:
+			if !errors.Is(err, ErrAlignmentChanged) || dio.BlockSize() != detected/2 {
+				t.Fatalf("same: got block size %d, %v", dio.BlockSize(), err)
+			}
+			if _, err := dio.Write([]byte("x")); err == nil {
+				t.Fatal("write after a failed Reset didn't fail")
+			}
+		}
+		if err := dio.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	defer SetDefaults(Config{
+		BufferSize:        defaultBufSize,
+		MinBufferSize:     defaultBufSize,
+		FallbackAlignment: fallbackAlignment,
+	})
+
+	if err := SetDefaults(Config{FallbackAlignment: 3000}); err == nil {
+		t.Fatal("alignment of 3000 accepted")
+	}
+	if err := SetDefaults(Config{BufferSize: 1 << 17, MinBufferSize: 1 << 15}); err != nil {
+		t.Fatal(err)
+	}
+	if c := config(); c.FallbackAlignment != fallbackAlignment {
+		t.Fatalf("unset field changed to %d", c.FallbackAlignment)
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	for _, tc := range []struct {
+		size, want int
+	}{
+		{0, 1 << 17},
+		{4096, 1 << 15},
+		{1 << 16, 1 << 16},
+	} {
+		f := tmpFile(t, dir, fmt.Sprintf("defaults-%d", tc.size))
+		defer f.Close()
+
+		dio, err := NewSize(f, tc.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := dio.Available(); got != tc.want {
+			t.Errorf("size %d: got a buffer of %d bytes, want %d", tc.size, got, tc.want)
+		}
+		if err := dio.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Buffers for streams of unknown alignment follow the fallback.
+	if err := SetDefaults(Config{FallbackAlignment: 1 << 16}); err != nil {
+		t.Fatal(err)
+	}
+	er, err := NewEncryptedReader(bytes.NewReader(nil), bytes.Repeat([]byte{1}, 32), 1<<16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := align(er.frame, 1<<16); a != 0 {
+		t.Errorf("encrypted reader frame is %d bytes off the fallback alignment", a)
+	}
+}
+
+func TestEnableEnvConfig(t *testing.T) {
+	defer env.Store(nil)
+	defer SetDefaults(Config{BufferSize: defaultBufSize})
+
+	t.Setenv(EnvForceAlign, "1000")
+	if err := EnableEnvConfig(); err == nil {
+		t.Fatal("alignment of 1000 accepted")
+	}
+	if env.Load() != nil {
+		t.Fatal("invalid variables applied")
+	}
+
+	t.Setenv(EnvBufSize, "65536")
+	t.Setenv(EnvForceAlign, "8192")
+	t.Setenv(EnvDisable, "1")
+	if err := EnableEnvConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "env")
+	defer f.Close()
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dio.Engine() != EngineNoCache || dio.BlockSize() != 8192 || dio.Available() != 65536 {
+		t.Fatalf("got engine %v, block size %d, buffer %d", dio.Engine(), dio.BlockSize(), dio.Available())
+	}
+	if _, err := dio.Write([]byte("through the cache")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "through the cache" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestNewAppend(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	name := filepath.Join(dir, "new-append")
+	head := bytes.Repeat([]byte{'h'}, 5000)
+	if err := os.WriteFile(name, head, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	dio, err := NewAppend(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 70000)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := dio.LogicalOffset(); got != int64(len(data)) {
+		t.Fatalf("LogicalOffset = %d, want %d", got, len(data))
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dio.Stats().Written; got != int64(len(data)) {
+		t.Fatalf("Stats().Written = %d, want %d", got, len(data))
+	}
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, append(head, data...)) {
+		t.Fatalf("file content mismatch, got %d bytes, want %d", len(got), len(head)+len(data))
+	}
+}
+
+func TestChunkCallback(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "chunks")
+	defer f.Close()
+
+	type chunk struct {
+		off, n int64
+		sum    []byte
+	}
+	var chunks []chunk
+
+	const size = 1 << 20
+	dio, err := New(f, WithChunkCallback(size, nil, func(off, n int64, sum []byte) {
+		chunks = append(chunks, chunk{off, n, sum})
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 3*size+12345)
+	for i := range data {
+		data[i] = byte(i % 247)
+	}
+	for p := data; len(p) > 0; {
+		n := min(len(p), 70001)
+		if _, err := dio.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks before Close, want 3", len(chunks))
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chunks) != 4 {
+		t.Fatalf("got %d chunks, want 4", len(chunks))
+	}
+	for i, c := range chunks {
+		end := min(int64(len(data)), int64(i+1)*size)
+		want := sha256.Sum256(data[int64(i)*size : end])
+		if c.off != int64(i)*size || c.off+c.n != end || !bytes.Equal(c.sum, want[:]) {
+			t.Fatalf("chunk %d: got offset %d, length %d", i, c.off, c.n)
+		}
+	}
+}
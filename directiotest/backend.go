@@ -0,0 +1,189 @@
+// Package directiotest provides an in-memory directio.Backend with fault
+// injection, so applications can test how they handle failing devices.
+package directiotest
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/oddmario/directio"
+)
+
+var (
+	_ directio.Backend          = (*Backend)(nil)
+	_ directio.DirectModeSetter = (*Backend)(nil)
+)
+
+// Backend is an in-memory file which, in O_DIRECT mode, rejects unaligned
+// writes with EINVAL like the kernel does. Faults are injected with the
+// Fail methods. It is safe for concurrent use.
+//
+// Use it with directio.NewBackend and directio.WithAlignment:
+//
+//	b := directiotest.New(4096)
+//	w, err := directio.NewBackend(b, 0, directio.WithAlignment(4096))
+type Backend struct {
+	mu        sync.Mutex
+	blockSize int
+	data      []byte
+	pos       int64
+	direct    bool
+	syncs     int
+
+	shortWrite int
+	noSpace    int64
+	ioErrorAt  []int64
+}
+
+// New returns an empty Backend in O_DIRECT mode, enforcing blockSize.
+func New(blockSize int) *Backend {
+	return &Backend{blockSize: blockSize, direct: true, noSpace: -1}
+}
+
+// FailShortWrites makes every write write at most n bytes and report it
+// without an error. 0 turns it off.
+func (b *Backend) FailShortWrites(n int) {
+	b.mu.Lock()
+	b.shortWrite = n
+	b.mu.Unlock()
+}
+
+// FailNoSpaceAfter makes writes fail with ENOSPC once the backend holds n
+// bytes. Writes crossing the limit are cut short at it.
+func (b *Backend) FailNoSpaceAfter(n int64) {
+	b.mu.Lock()
+	b.noSpace = n
+	b.mu.Unlock()
+}
+
+// FailIOAt makes every write covering off fail with EIO, without writing
+// anything.
+func (b *Backend) FailIOAt(off int64) {
+	b.mu.Lock()
+	b.ioErrorAt = append(b.ioErrorAt, off)
+	b.mu.Unlock()
+}
+
+// Bytes returns a copy of the content of the backend.
+func (b *Backend) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]byte(nil), b.data...)
+}
+
+// Syncs returns how many times Sync was called.
+func (b *Backend) Syncs() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.syncs
+}
+
+// Write implements directio.Backend.
+func (b *Backend) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, err := b.writeAt(p, b.pos)
+	b.pos += int64(n)
+
+	return n, err
+}
+
+// WriteAt implements directio.Backend.
+func (b *Backend) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.writeAt(p, off)
+}
+
+func (b *Backend) writeAt(p []byte, off int64) (int, error) {
+	if b.direct {
+		bs := b.blockSize
+		if len(p)%bs != 0 || off%int64(bs) != 0 || uintptr(unsafe.Pointer(unsafe.SliceData(p)))%uintptr(bs) != 0 {
+			return 0, pathError(syscall.EINVAL)
+		}
+	}
+
+	for _, bad := range b.ioErrorAt {
+		if bad >= off && bad < off+int64(len(p)) {
+			return 0, pathError(syscall.EIO)
+		}
+	}
+
+	var err error
+	if b.shortWrite > 0 && len(p) > b.shortWrite {
+		p = p[:b.shortWrite]
+	}
+	if b.noSpace >= 0 {
+		if off >= b.noSpace {
+			return 0, pathError(syscall.ENOSPC)
+		}
+		if rest := b.noSpace - off; int64(len(p)) > rest {
+			p, err = p[:rest], pathError(syscall.ENOSPC)
+		}
+	}
+
+	if end := off + int64(len(p)); end > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, end-int64(len(b.data)))...)
+	}
+
+	return copy(b.data[off:], p), err
+}
+
+// Seek implements io.Seeker.
+func (b *Backend) Seek(offset int64, whence int) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	}
+	if offset < 0 {
+		return 0, pathError(syscall.EINVAL)
+	}
+	b.pos = offset
+
+	return offset, nil
+}
+
+// Sync implements directio.Backend.
+func (b *Backend) Sync() error {
+	b.mu.Lock()
+	b.syncs++
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Fd implements directio.Backend. The backend has no descriptor.
+func (b *Backend) Fd() uintptr { return ^uintptr(0) }
+
+// DirectMode implements directio.DirectModeSetter.
+func (b *Backend) DirectMode() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.direct, nil
+}
+
+// SetDirectMode implements directio.DirectModeSetter.
+func (b *Backend) SetDirectMode(enabled bool) error {
+	b.mu.Lock()
+	b.direct = enabled
+	b.mu.Unlock()
+
+	return nil
+}
+
+func pathError(err error) error {
+	return &os.PathError{Op: "write", Path: "directiotest", Err: err}
+}
@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package directiotest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/oddmario/directio"
+)
+
+func writeAll(t *testing.T, b *Backend, data []byte) error {
+	t.Helper()
+
+	w, err := directio.NewBackend(b, 0, directio.WithAlignment(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := data; len(p) > 0; {
+		n := min(len(p), 5000)
+		if _, err := w.Write(p[:n]); err != nil {
+			return err
+		}
+		p = p[n:]
+	}
+
+	return w.Close()
+}
+
+func TestBackend(t *testing.T) {
+	data := bytes.Repeat([]byte("directiotest"), 10000)
+
+	b := New(4096)
+	if err := writeAll(t, b, data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), data) {
+		t.Fatalf("backend holds %d bytes, want %d", len(b.Bytes()), len(data))
+	}
+	if b.Syncs() != 1 {
+		t.Fatalf("Syncs = %d, want 1", b.Syncs())
+	}
+}
+
+func TestFaults(t *testing.T) {
+	data := bytes.Repeat([]byte("directiotest"), 10000)
+
+	for _, tc := range []struct {
+		name   string
+		inject func(b *Backend)
+		want   error
+	}{
+		{"nospace", func(b *Backend) { b.FailNoSpaceAfter(65536) }, syscall.ENOSPC},
+		{"eio", func(b *Backend) { b.FailIOAt(40000) }, syscall.EIO},
+		{"short", func(b *Backend) { b.FailShortWrites(4096) }, io.ErrShortWrite},
+	} {
+		b := New(4096)
+		tc.inject(b)
+
+		if err := writeAll(t, b, data); !errors.Is(err, tc.want) {
+			t.Errorf("%s: error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrUnalignedRange is returned by Discard when the range isn't aligned.
+var ErrUnalignedRange = errors.New("range is not aligned to the block size")
+
+// Discard releases the length bytes of f at off. On a block device they are
+// discarded with BLKDISCARD, which trims them on SSDs and thin provisioned
+// volumes; off and length must then be multiples of the logical sector size.
+// On a regular file a hole is punched with FALLOC_FL_PUNCH_HOLE, keeping the
+// file size; off and length must then be multiples of the block size DirectIO
+// uses for the file, so the range boundaries match its writes.
+//
+// Discarded ranges read back as zeros on files, and on devices whatever the
+// device returns for unmapped blocks.
+func Discard(f *os.File, off, length int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if isBlockDevice(info) {
+		dev, err := queryBlockDevice(f.Fd())
+		if err != nil {
+			return err
+		}
+		if off%int64(dev.logical) != 0 || length%int64(dev.logical) != 0 {
+			return ErrUnalignedRange
+		}
+		if off+length > dev.size {
+			return ErrDeviceBounds
+		}
+
+		return discardDevice(f.Fd(), off, length)
+	}
+
+	align := int64(cachedFdAlignment(f.Fd()).blockSize)
+	if off%align != 0 || length%align != 0 {
+		return ErrUnalignedRange
+	}
+
+	return unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, off, length)
+}
@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestDiscard(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	path := filepath.Join(dir, "discard")
+	data := bytes.Repeat([]byte{0x42}, 1<<20)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := Discard(f, 1, 4096); err != ErrUnalignedRange {
+		t.Fatalf("unaligned discard returned %v, want ErrUnalignedRange", err)
+	}
+
+	if err := Discard(f, 256<<10, 512<<10); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data[256<<10:768<<10], make([]byte, 512<<10))
+	if !bytes.Equal(got, data) {
+		t.Fatal("discarded range doesn't read back as zeros")
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		t.Fatal(err)
+	}
+	if allocated := st.Blocks * 512; allocated > 600<<10 {
+		t.Errorf("file still has %d bytes allocated after discard", allocated)
+	}
+}
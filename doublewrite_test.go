@@ -0,0 +1,219 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// doublewriteFiles opens a data file and a scratch file for the doublewrite
+// tests, read-write with O_DIRECT.
+func doublewriteFiles(t *testing.T, dir, name string) (f, scratch *os.File) {
+	var files [2]*os.File
+	for i, suffix := range []string{"data", "scratch"} {
+		path := filepath.Join(dir, name+"-"+suffix)
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL|O_DIRECT, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[i] = file
+	}
+
+	return files[0], files[1]
+}
+
+// doublewritePage returns a page filled with b, aligned for O_DIRECT.
+func doublewritePage(t *testing.T, size int, b byte) []byte {
+	page, err := allocAlignedBuf(4096, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range page {
+		page[i] = b
+	}
+
+	return page
+}
+
+// readPage reads the page at off of f.
+func readPage(t *testing.T, f *os.File, size int, off int64) []byte {
+	page := doublewritePage(t, size, 0)
+	if _, err := f.ReadAt(page, off); err != nil {
+		t.Fatal(err)
+	}
+
+	return page
+}
+
+func TestDoublewrite(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, scratch := doublewriteFiles(t, dir, "dwb")
+	defer f.Close()
+	defer scratch.Close()
+
+	const pageSize = 16384
+	d, err := NewDoublewrite(f, scratch, 0, pageSize, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WritePage(make([]byte, 100), 0); err == nil {
+		t.Fatal("short page accepted")
+	}
+
+	// Page 1 is queued twice, the second content wins.
+	for i, off := range []int64{0, pageSize, 3 * pageSize, pageSize} {
+		if err := d.WritePage(doublewritePage(t, pageSize, byte('a'+i)), off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[int64]byte{0: 'a', pageSize: 'd', 3 * pageSize: 'c'}
+	for off, b := range want {
+		if !bytes.Equal(readPage(t, f, pageSize, off), doublewritePage(t, pageSize, b)) {
+			t.Fatalf("page at %d wasn't written", off)
+		}
+	}
+
+	if n, err := RecoverDoublewrite(f, scratch, 0); err != nil || n != 0 {
+		t.Fatalf("recovery of intact pages: %d, %v", n, err)
+	}
+
+	// Tear a page: half of it new, half of it garbage.
+	torn := doublewritePage(t, pageSize, 'd')
+	copy(torn[pageSize/2:], bytes.Repeat([]byte{0xff}, pageSize/2))
+	if _, err := f.WriteAt(torn, pageSize); err != nil {
+		t.Fatal(err)
+	}
+	n, err := RecoverDoublewrite(f, scratch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("repaired %d pages, want 1", n)
+	}
+	if !bytes.Equal(readPage(t, f, pageSize, pageSize), doublewritePage(t, pageSize, 'd')) {
+		t.Fatal("torn page wasn't repaired")
+	}
+}
+
+func TestDoublewriteBadCRC(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, scratch := doublewriteFiles(t, dir, "dwb-crc")
+	defer f.Close()
+	defer scratch.Close()
+
+	const pageSize = 4096
+	d, err := NewDoublewrite(f, scratch, 0, pageSize, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 2; i++ {
+		if err := d.WritePage(doublewritePage(t, pageSize, 'x'), i*pageSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.WriteAt(doublewritePage(t, pageSize, 0xff), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scratch copy of page 0 is torn too: it must not be applied.
+	pageOff := int64(d.headerSize)
+	if _, err := scratch.WriteAt(doublewritePage(t, pageSize, 'y'), pageOff); err != nil {
+		t.Fatal(err)
+	}
+	n, err := RecoverDoublewrite(f, scratch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("repaired %d pages from a corrupt scratch copy", n)
+	}
+	if !bytes.Equal(readPage(t, f, pageSize, 0), doublewritePage(t, pageSize, 0xff)) {
+		t.Fatal("corrupt scratch copy was applied")
+	}
+
+	// A corrupt header means no batch at all.
+	header := readPage(t, scratch, d.headerSize, 0)
+	header[doublewriteHeaderLen] ^= 1
+	if _, err := scratch.WriteAt(header, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecoverDoublewrite(f, scratch, 0); !errors.Is(err, ErrNoDoublewrite) {
+		t.Fatalf("recovery with a corrupt header: %v", err)
+	}
+
+	// Geometry larger than the scratch file is refused before the checksum
+	// is checked, instead of being allocated.
+	header[doublewriteHeaderLen] ^= 1
+	for _, field := range []struct {
+		off  int
+		good uint32
+	}{{8, pageSize}, {12, 2}} {
+		binary.BigEndian.PutUint32(header[field.off:], 1<<31)
+		if _, err := scratch.WriteAt(header, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RecoverDoublewrite(f, scratch, 0); !errors.Is(err, ErrNoDoublewrite) {
+			t.Fatalf("recovery with the header field at %d corrupt: %v", field.off, err)
+		}
+		binary.BigEndian.PutUint32(header[field.off:], field.good)
+	}
+	if _, err := scratch.WriteAt(header, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecoverDoublewrite(f, scratch, 0); err != nil {
+		t.Fatalf("recovery with the header restored: %v", err)
+	}
+}
+
+func TestDoublewriteBlockSize(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, scratch := doublewriteFiles(t, dir, "dwb-bs")
+	defer f.Close()
+	defer scratch.Close()
+
+	// As if the data file needed a larger alignment than the scratch file,
+	// the header is then larger than the scratch file alone implies.
+	const pageSize, blockSize = 65536, 65536
+	d, err := NewDoublewrite(f, scratch, 0, pageSize, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.blockSize = blockSize
+	d.headerSize = doublewriteHeaderSize(d.slots, blockSize)
+	if d.header, err = allocAlignedBuf(blockSize, d.headerSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.WritePage(doublewritePage(t, pageSize, 'z'), pageSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(doublewritePage(t, pageSize, 0), pageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := RecoverDoublewrite(f, scratch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || !bytes.Equal(readPage(t, f, pageSize, pageSize), doublewritePage(t, pageSize, 'z')) {
+		t.Fatalf("repaired %d pages, want the page of the batch", n)
+	}
+}
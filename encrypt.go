@@ -0,0 +1,261 @@
+package directio
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// encryptedHeaderLen is the size of the frame header: plaintext length
+	// (4 bytes), flags (1 byte), reserved (3 bytes) and nonce (12 bytes).
+	encryptedHeaderLen = 20
+
+	// encryptedFinal marks the last frame of a stream.
+	encryptedFinal = 1 << 0
+)
+
+// ErrDecrypt is returned by EncryptedReader when a frame fails
+// authentication, e.g. because it was modified or reordered.
+var ErrDecrypt = errors.New("encrypted frame failed authentication")
+
+// encryptedAAD binds a frame to its position in the stream and to whether it
+// is the final one, so frames can't be reordered and the stream can't be
+// truncated at a frame boundary without detection.
+func encryptedAAD(index uint64, flags byte) []byte {
+	var aad [9]byte
+	binary.BigEndian.PutUint64(aad[:8], index)
+	aad[8] = flags
+
+	return aad[:]
+}
+
+func newEncryptedAEAD(key []byte, frameSize int) (cipher.AEAD, int, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	chunkSize := frameSize - encryptedHeaderLen - aead.Overhead()
+	if chunkSize <= 0 {
+		return nil, 0, errors.New("frame size is too small")
+	}
+
+	return aead, chunkSize, nil
+}
+
+// EncryptedWriter encrypts data with AES-GCM in fixed-size frames.
+//
+// Every frame holds up to frameSize minus the framing overhead bytes of
+// plaintext and is padded to exactly frameSize bytes, so when frameSize is a
+// multiple of the block size the ciphertext can be written to a DirectIO
+// writer without breaking its zero-copy path. The last frame is marked as
+// final, which lets EncryptedReader detect truncated streams.
+type EncryptedWriter struct {
+	w         io.Writer
+	aead      cipher.AEAD
+	chunkSize int
+
+	plain []byte
+	n     int
+	frame []byte
+	index uint64
+	err   error
+
+	isClosed bool
+}
+
+// NewEncryptedWriter returns a writer encrypting to w with the AES key (16,
+// 24 or 32 bytes) in frames of frameSize bytes. If w is a *DirectIO,
+// frameSize must be a multiple of its block size.
+func NewEncryptedWriter(w io.Writer, key []byte, frameSize int) (*EncryptedWriter, error) {
+	aead, chunkSize, err := newEncryptedAEAD(key, frameSize)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize := config().FallbackAlignment
+	if d, ok := w.(*DirectIO); ok {
+		blockSize = d.blockSize
+		if frameSize%blockSize != 0 {
+			return nil, errors.New("frame size must be a multiple of the block size")
+		}
+	}
+
+	frame, err := allocAlignedBuf(blockSize, frameSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedWriter{
+		w:         w,
+		aead:      aead,
+		chunkSize: chunkSize,
+		plain:     make([]byte, chunkSize),
+		frame:     frame,
+	}, nil
+}
+
+// seal encrypts the pending plaintext into a frame and writes it.
+func (e *EncryptedWriter) seal(flags byte) error {
+	for i := range e.frame {
+		e.frame[i] = 0
+	}
+
+	binary.BigEndian.PutUint32(e.frame[0:4], uint32(e.n))
+	e.frame[4] = flags
+
+	nonce := e.frame[8:encryptedHeaderLen]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	e.aead.Seal(e.frame[encryptedHeaderLen:encryptedHeaderLen], nonce, e.plain[:e.n], encryptedAAD(e.index, flags))
+
+	if _, err := e.w.Write(e.frame); err != nil {
+		return err
+	}
+
+	e.index++
+	e.n = 0
+
+	return nil
+}
+
+// Write encrypts p. Data is written to the underlying writer one full frame
+// at a time.
+func (e *EncryptedWriter) Write(p []byte) (nn int, err error) {
+	if e.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	for len(p) > 0 {
+		n := copy(e.plain[e.n:], p)
+		e.n += n
+		nn += n
+		p = p[n:]
+
+		if e.n == e.chunkSize && len(p) > 0 {
+			if e.err = e.seal(0); e.err != nil {
+				return nn, e.err
+			}
+		}
+	}
+
+	return nn, nil
+}
+
+// Close writes the final frame. It doesn't close the underlying writer.
+func (e *EncryptedWriter) Close() error {
+	if e.isClosed {
+		return errors.New("the writer is already closed")
+	}
+
+	e.isClosed = true
+
+	if e.err != nil {
+		return e.err
+	}
+
+	return e.seal(encryptedFinal)
+}
+
+// EncryptedReader decrypts a stream written by EncryptedWriter.
+type EncryptedReader struct {
+	r         io.Reader
+	aead      cipher.AEAD
+	chunkSize int
+
+	frame []byte
+	plain []byte
+	pos   int
+	index uint64
+	done  bool
+	err   error
+}
+
+// NewEncryptedReader returns a reader decrypting from r with the AES key
+// and frame size the stream was written with. r may be an O_DIRECT file,
+// frames are read into a block aligned buffer.
+func NewEncryptedReader(r io.Reader, key []byte, frameSize int) (*EncryptedReader, error) {
+	aead, chunkSize, err := newEncryptedAEAD(key, frameSize)
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := allocAlignedBuf(config().FallbackAlignment, frameSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedReader{
+		r:         r,
+		aead:      aead,
+		chunkSize: chunkSize,
+		frame:     frame,
+		plain:     make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// open reads and decrypts the next frame.
+func (e *EncryptedReader) open() error {
+	if _, err := io.ReadFull(e.r, e.frame); err != nil {
+		if err == io.EOF {
+			// The stream ended without a final frame.
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	n := int(binary.BigEndian.Uint32(e.frame[0:4]))
+	flags := e.frame[4]
+	if n > e.chunkSize {
+		return ErrDecrypt
+	}
+
+	nonce := e.frame[8:encryptedHeaderLen]
+	sealed := e.frame[encryptedHeaderLen : encryptedHeaderLen+n+e.aead.Overhead()]
+
+	plain, err := e.aead.Open(e.plain[:0], nonce, sealed, encryptedAAD(e.index, flags))
+	if err != nil {
+		return ErrDecrypt
+	}
+
+	e.plain = plain
+	e.pos = 0
+	e.index++
+	e.done = flags&encryptedFinal != 0
+
+	return nil
+}
+
+// Read reads decrypted data into p.
+func (e *EncryptedReader) Read(p []byte) (int, error) {
+	for e.pos == len(e.plain) {
+		if e.err != nil {
+			return 0, e.err
+		}
+		if e.done {
+			return 0, io.EOF
+		}
+		if e.err = e.open(); e.err != nil {
+			return 0, e.err
+		}
+	}
+
+	n := copy(p, e.plain[e.pos:])
+	e.pos += n
+
+	return n, nil
+}
@@ -0,0 +1,80 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestEncrypted(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+
+	f := tmpFile(t, dir, "encrypted")
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frameSize := 4 * dio.blockSize
+	ew, err := NewEncryptedWriter(dio, key, frameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ew.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	info, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size()%int64(frameSize) != 0 {
+		t.Fatalf("encrypted size %d is not a multiple of the frame size", info.Size())
+	}
+
+	rf, err := os.OpenFile(f.Name(), os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	er, err := NewEncryptedReader(rf, key, frameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(er)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("decrypted data doesn't match")
+	}
+
+	// Dropping the final frame must be detected.
+	truncated := io.NewSectionReader(rf, 0, info.Size()-int64(frameSize))
+	er, err = NewEncryptedReader(truncated, key, frameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(er); err != io.ErrUnexpectedEOF {
+		t.Fatalf("truncated stream: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
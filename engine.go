@@ -0,0 +1,147 @@
+package directio
+
+import (
+	"os"
+)
+
+// Engine is the way a writer gets data to the file.
+type Engine int
+
+const (
+	// EngineDirect writes with O_DIRECT, bypassing the page cache.
+	EngineDirect Engine = iota
+
+	// EngineNoCache writes through the page cache and evicts the written
+	// ranges right behind itself with sync_file_range and FADV_DONTNEED,
+	// like the nocache tool and rsync's --drop-cache. It is meant for
+	// filesystems without O_DIRECT where cache pollution is still the
+	// problem to solve.
+	EngineNoCache
+
+	// EngineDontCache writes through the page cache with RWF_DONTCACHE
+	// (Linux 6.14 and later), which drops the pages as soon as writeback is
+	// done. Where the filesystem doesn't support it, the writer switches to
+	// EngineNoCache at the first write.
+	EngineDontCache
+)
+
+func (e Engine) String() string {
+	switch e {
+	case EngineDirect:
+		return "direct"
+	case EngineNoCache:
+		return "nocache"
+	case EngineDontCache:
+		return "dontcache"
+	default:
+		return "unknown"
+	}
+}
+
+// Engine returns the engine the writer uses.
+func (d *DirectIO) Engine() Engine { return d.engine }
+
+// NewNoCache returns a writer using EngineNoCache with a buffer of size
+// bytes. f is used without O_DIRECT, the flag is cleared if it is set.
+func NewNoCache(f *os.File, size int, opts ...Option) (*DirectIO, error) {
+	return newWriter(f, size, EngineNoCache, opts)
+}
+
+// dropAll evicts everything the writer left in the cache.
+func (d *DirectIO) dropAll() {
+	if d.dropEnd > d.dropOff {
+		d.evict(d.dropOff, d.dropEnd-d.dropOff)
+		d.dropOff, d.dropEnd = 0, 0
+	}
+}
+
+// AutoHints describe the expected workload to NewAuto.
+type AutoHints struct {
+	// BufferSize is the size of the writer buffer, see NewSize.
+	BufferSize int
+
+	// SizeHint is the expected total size of the output, 0 if unknown.
+	SizeHint int64
+
+	// Unaligned tells that most writes aren't multiples of the block size.
+	Unaligned bool
+}
+
+// autoSmallFile is the size under which NewAuto considers O_DIRECT not
+// worth it: the file is written in a handful of flushes and the tail is
+// written buffered anyway.
+const autoSmallFile = 1 << 20
+
+// NewAuto returns a writer with the engine best suited to f and the hinted
+// workload:
+//   - EngineDirect when the filesystem supports O_DIRECT, unless the output
+//     is small or made of unaligned writes,
+//   - EngineDontCache otherwise, which itself falls back to EngineNoCache on
+//     kernels and filesystems without RWF_DONTCACHE.
+//
+// The choice and its reason are reported by Stats.
+func NewAuto(f *os.File, hints AutoHints, opts ...Option) (*DirectIO, error) {
+	engine, reason := EngineDirect, "O_DIRECT is supported"
+
+	switch {
+	case setDirectIO(f.Fd(), true) != nil:
+		engine, reason = EngineDontCache, "O_DIRECT is not supported here"
+	case hints.SizeHint > 0 && hints.SizeHint < autoSmallFile:
+		engine, reason = EngineDontCache, "the output is too small for O_DIRECT"
+	case hints.Unaligned:
+		engine, reason = EngineDontCache, "writes are not aligned"
+	}
+
+	d, err := newWriter(f, hints.BufferSize, engine, opts)
+	if err != nil {
+		return nil, err
+	}
+	if d.reason == "" {
+		d.reason = reason
+	}
+
+	return d, nil
+}
+
+// Stats describes a writer.
+type Stats struct {
+	// Engine is the engine in use and Reason why NewAuto picked it.
+	Engine Engine
+	Reason string
+
+	// BlockSize is the alignment of the writer and AlignmentSource where it
+	// came from.
+	BlockSize       int
+	AlignmentSource AlignmentSource
+
+	// Written is the number of bytes accepted by the writer.
+	Written int64
+
+	// FastPath is the number of bytes Write sent to the file straight from
+	// the caller's slice. The other bytes given to Write were copied to the
+	// buffer first, because data was already buffered (CopyBuffered), the
+	// slice wasn't aligned in memory (CopyMisaligned), or its length wasn't
+	// a multiple of the block size (CopyShort).
+	FastPath       int64
+	CopyBuffered   int64
+	CopyMisaligned int64
+	CopyShort      int64
+}
+
+// Stats returns the current statistics of the writer.
+func (d *DirectIO) Stats() Stats {
+	d.lock()
+	defer d.unlock()
+
+	return Stats{
+		Engine:          d.engine,
+		Reason:          d.reason,
+		BlockSize:       d.blockSize,
+		AlignmentSource: d.alignSource,
+		Written:         d.written,
+		FastPath:        d.fast.direct,
+		CopyBuffered:    d.fast.buffered,
+		CopyMisaligned:  d.fast.misaligned,
+		CopyShort:       d.fast.short,
+	}
+}
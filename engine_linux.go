@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import "golang.org/x/sys/unix"
+
+// dropBehind starts writeback of the range just written and evicts the
+// previous one, which has had the time of one flush to reach the disk, so
+// writes don't stall on every flush.
+func (d *DirectIO) dropBehind(off int64, n int) {
+	fd := int(d.f.Fd())
+
+	_ = unix.SyncFileRange(fd, off, int64(n), unix.SYNC_FILE_RANGE_WRITE)
+
+	if d.dropEnd > d.dropOff {
+		d.evict(d.dropOff, d.dropEnd-d.dropOff)
+	}
+
+	d.dropOff, d.dropEnd = off, off+int64(n)
+}
+
+// evict waits for the writeback of a range and drops it from the page cache.
+func (d *DirectIO) evict(off, n int64) {
+	fd := int(d.f.Fd())
+
+	_ = unix.SyncFileRange(fd, off, n, unix.SYNC_FILE_RANGE_WAIT_BEFORE|unix.SYNC_FILE_RANGE_WRITE|unix.SYNC_FILE_RANGE_WAIT_AFTER)
+	_ = unix.Fadvise(fd, off, n, unix.FADV_DONTNEED)
+}
+
+// writeDontCache writes p at the file offset with RWF_DONTCACHE. If the
+// filesystem doesn't support it, the writer falls back to EngineNoCache.
+func (d *DirectIO) writeDontCache(p []byte) (int, error) {
+	n, err := unix.Pwritev2(int(d.f.Fd()), [][]byte{p}, -1, unix.RWF_DONTCACHE)
+	if err == unix.EOPNOTSUPP || err == unix.EINVAL {
+		d.engine = EngineNoCache
+		d.reason = "RWF_DONTCACHE is not supported here, fell back to nocache"
+
+		return d.f.Write(p)
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	return n, err
+}
@@ -0,0 +1,150 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNoCache(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, err := os.Create(filepath.Join(dir, "nocache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	dio, err := NewNoCache(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dio.Engine() != EngineNoCache {
+		t.Fatalf("Engine = %v, want %v", dio.Engine(), EngineNoCache)
+	}
+
+	var want []byte
+	for _, n := range writesizes {
+		p := bytes.Repeat([]byte{byte(n)}, n)
+		if _, err := dio.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, p...)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("file holds %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestNewAuto(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	for _, tc := range []struct {
+		hints AutoHints
+		want  Engine
+	}{
+		{AutoHints{SizeHint: 1 << 30}, EngineDirect},
+		{AutoHints{SizeHint: 4096}, EngineDontCache},
+		{AutoHints{Unaligned: true}, EngineDontCache},
+	} {
+		f, err := os.Create(filepath.Join(dir, "auto"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dio, err := NewAuto(f, tc.hints)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := bytes.Repeat([]byte("auto"), 10000)
+		if _, err := dio.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := dio.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		// Without RWF_DONTCACHE support the writer may have fallen back.
+		st := dio.Stats()
+		if st.Engine != tc.want && !(tc.want == EngineDontCache && st.Engine == EngineNoCache) {
+			t.Errorf("%+v: Engine = %v (%s), want %v", tc.hints, st.Engine, st.Reason, tc.want)
+		}
+		if st.Written != int64(len(data)) {
+			t.Errorf("%+v: Written = %d, want %d", tc.hints, st.Written, len(data))
+		}
+
+		got, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%+v: file holds %d bytes, want %d", tc.hints, len(got), len(data))
+		}
+	}
+}
+
+func TestFastPathStats(t *testing.T) {
+	var warnings []string
+	b := &memBackend{t: t, direct: true}
+	dio, err := NewBackend(b, 0, WithAlignment(512), WithFastPathWarning(func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aligned, err := allocAlignedBuf(512, 64<<10+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dio.Write(aligned[:48<<10])    // zero-copy
+	dio.Write(aligned[1 : 32<<10]) // misaligned pointer
+	dio.Write(aligned[:100])       // buffered data present
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := dio.Stats()
+	if st.FastPath != 48<<10 {
+		t.Errorf("FastPath = %d, want %d", st.FastPath, 48<<10)
+	}
+	if st.CopyMisaligned == 0 || st.CopyBuffered == 0 {
+		t.Errorf("copies not accounted for: %+v", st)
+	}
+	if total := st.FastPath + st.CopyBuffered + st.CopyMisaligned + st.CopyShort; total != st.Written {
+		t.Errorf("accounted for %d bytes, %d were written", total, st.Written)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warning %q", warnings)
+	}
+
+	// Mostly small writes trip the warning.
+	dio, _ = NewBackend(&memBackend{t: t, direct: true}, 0, WithAlignment(512), WithFastPathWarning(func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}))
+	for i := 0; i < 100; i++ {
+		dio.Write(aligned[:100])
+	}
+	dio.Close()
+	if len(warnings) != 1 {
+		t.Errorf("got %d warnings, want 1", len(warnings))
+	}
+}
@@ -0,0 +1,84 @@
+package directio
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// The environment variables of EnableEnvConfig.
+const (
+	// EnvBufSize sets the default buffer size, in bytes.
+	EnvBufSize = "DIRECTIO_BUFSIZE"
+
+	// EnvForceAlign sets the block size of every writer, detected or set
+	// with WithAlignment. It must be a power of two.
+	EnvForceAlign = "DIRECTIO_FORCE_ALIGN"
+
+	// EnvDisable, set to a true value like 1, makes the writers asked for
+	// O_DIRECT use EngineNoCache instead.
+	EnvDisable = "DIRECTIO_DISABLE"
+)
+
+// envOverrides holds what EnableEnvConfig read for the writers.
+type envOverrides struct {
+	forceAlign int
+	disable    bool
+}
+
+var env atomic.Pointer[envOverrides]
+
+// EnableEnvConfig reads the DIRECTIO_* environment variables and applies
+// them to the writers created afterwards, so operators can tune or disable
+// direct I/O without a rebuild. Nothing is read unless it is called, and
+// nothing is applied if a variable is invalid. Unset variables leave the
+// defaults alone.
+func EnableEnvConfig() error {
+	var (
+		c   Config
+		o   envOverrides
+		err error
+	)
+
+	if v := os.Getenv(EnvBufSize); v != "" {
+		if c.BufferSize, err = strconv.Atoi(v); err != nil || c.BufferSize <= 0 {
+			return fmt.Errorf("%s: invalid buffer size %q", EnvBufSize, v)
+		}
+	}
+	if v := os.Getenv(EnvForceAlign); v != "" {
+		if o.forceAlign, err = strconv.Atoi(v); err != nil || o.forceAlign <= 0 || o.forceAlign&(o.forceAlign-1) != 0 {
+			return fmt.Errorf("%s: alignment %q is not a power of two", EnvForceAlign, v)
+		}
+	}
+	if v := os.Getenv(EnvDisable); v != "" {
+		if o.disable, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", EnvDisable, v)
+		}
+	}
+
+	if err := SetDefaults(c); err != nil {
+		return err
+	}
+	env.Store(&o)
+
+	return nil
+}
+
+// applyEnv applies the overrides of EnableEnvConfig to a new writer.
+func (d *DirectIO) applyEnv() {
+	o := env.Load()
+	if o == nil {
+		return
+	}
+
+	if o.forceAlign > 0 {
+		d.blockSize = o.forceAlign
+		d.alignSource = AlignmentFallback
+		d.fixedAlign = true
+	}
+	if o.disable && d.engine == EngineDirect {
+		d.engine = EngineNoCache
+		d.reason = "direct I/O is disabled by " + EnvDisable
+	}
+}
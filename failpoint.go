@@ -0,0 +1,42 @@
+package directio
+
+// FailurePoint is a place in the writer where WithFailurePoint can inject
+// an error.
+type FailurePoint int
+
+const (
+	// FailAfterFlush is hit after every successful write to the file.
+	FailAfterFlush FailurePoint = iota + 1
+
+	// FailAfterBulk is hit in Close after the aligned bulk was written and
+	// before the unaligned tail is, which is where a crash leaves a file
+	// with its last, partial block missing.
+	FailAfterBulk
+
+	// FailAfterJournal is hit in Close once WithTailJournal has made the
+	// journal durable and before the tail is written to the file.
+	FailAfterJournal
+)
+
+// WithFailurePoint calls fn when the writer reaches point. If fn returns an
+// error, the writer fails with it as if the write had failed, which lets
+// integration tests exercise crash-consistency paths deterministically. fn
+// may also count calls, to fail only at the N-th flush, or panic to
+// simulate a crash.
+func WithFailurePoint(point FailurePoint, fn func() error) Option {
+	return func(d *DirectIO) {
+		if d.failpoints == nil {
+			d.failpoints = make(map[FailurePoint]func() error)
+		}
+		d.failpoints[point] = fn
+	}
+}
+
+// failAt runs the failure point hook of point, if any.
+func (d *DirectIO) failAt(point FailurePoint) error {
+	if fn := d.failpoints[point]; fn != nil {
+		return fn()
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package directio
+
+// fastPath counts the bytes given to Write by the path they took.
+type fastPath struct {
+	direct     int64
+	buffered   int64
+	misaligned int64
+	short      int64
+}
+
+// copied accounts for p being copied to the buffer holding n bytes, and
+// records why the zero-copy path couldn't take it.
+func (f *fastPath) copied(p []byte, n, blockSize int) {
+	switch {
+	case len(p) == 0:
+	case n > 0:
+		f.buffered += int64(len(p))
+	case align(p, blockSize) != 0:
+		f.misaligned += int64(len(p))
+	default:
+		f.short += int64(len(p))
+	}
+}
+
+// WithFastPathWarning makes Close call logf, once, if less than half of the
+// bytes given to Write could be written without being copied to the buffer,
+// with the reasons reported by Stats. log.Printf fits. It helps to find
+// producers handing over unaligned slices.
+func WithFastPathWarning(logf func(format string, args ...any)) Option {
+	return func(d *DirectIO) {
+		d.fastWarn = logf
+	}
+}
+
+// warnFastPath logs the warning of WithFastPathWarning, if due.
+func (d *DirectIO) warnFastPath() {
+	f := d.fast
+	total := f.direct + f.buffered + f.misaligned + f.short
+	if d.fastWarn == nil || total == 0 || 2*f.direct >= total {
+		return
+	}
+
+	d.fastWarn("directio: only %d of %d bytes took the zero-copy path (copied: %d already buffered, %d misaligned, %d short)",
+		f.direct, total, f.buffered, f.misaligned, f.short)
+}
@@ -0,0 +1,44 @@
+package directio
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// NewFd returns a DirectIO writer on the file descriptor fd, e.g. one
+// received over a unix socket with SCM_RIGHTS, with a buffer of size bytes.
+// The descriptor must have O_DIRECT set.
+//
+// The writer works on a duplicate of fd, which Close closes; fd itself stays
+// open and owned by the caller. Both share the file offset and flags.
+func NewFd(fd uintptr, size int, opts ...Option) (*DirectIO, error) {
+	nfd, err := dupFd(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	f := os.NewFile(nfd, fmt.Sprintf("fd/%d", fd))
+
+	d, err := NewSize(f, size, opts...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.closer = f
+
+	return d, nil
+}
+
+// NewRawConn is NewFd for the descriptor behind c.
+func NewRawConn(c syscall.RawConn, size int, opts ...Option) (*DirectIO, error) {
+	var d *DirectIO
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		d, err = NewFd(fd, size, opts...)
+	}); cerr != nil {
+		return nil, cerr
+	}
+
+	return d, err
+}
@@ -0,0 +1,50 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestNewFd(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	name := filepath.Join(dir, "fd")
+	fd, err := syscall.Open(name, syscall.O_WRONLY|syscall.O_CREAT|O_DIRECT, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+
+	dio, err := NewFd(uintptr(fd), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("fd"), 12345)
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The caller's descriptor must still be usable.
+	if err := checkDirectIO(uintptr(fd)); err != nil {
+		t.Fatalf("fd after Close: %v", err)
+	}
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("file holds %d bytes, want %d", len(got), len(data))
+	}
+}
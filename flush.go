@@ -0,0 +1,88 @@
+package directio
+
+import (
+	"errors"
+	"time"
+)
+
+// WithFlushInterval makes the writer flush the block aligned part of its
+// buffer every interval, even if the buffer isn't full, so a writer getting
+// little data, like a metrics or audit log, bounds how much of it a crash
+// can lose. The unaligned remainder stays buffered. The writer is then
+// guarded by a mutex, as flushes happen in the background; a flush due
+// during a Write or ReadFrom waits for it.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(d *DirectIO) {
+		d.interval = interval
+	}
+}
+
+// startFlushTimer arms the timer of WithFlushInterval.
+func (d *DirectIO) startFlushTimer() {
+	if d.interval > 0 {
+		d.lock()
+		d.timer = time.AfterFunc(d.interval, d.flushTick)
+		d.unlock()
+	}
+}
+
+// flushTick is the background flush of WithFlushInterval.
+func (d *DirectIO) flushTick() {
+	d.lock()
+	defer d.unlock()
+
+	if d.isClosed {
+		return
+	}
+
+	if d.err == nil {
+		d.flushAligned()
+		d.report()
+	}
+
+	// Complete the handles of Submit without waiting for the next write.
+	if d.err == nil && d.pending != nil {
+		d.sync()
+	}
+
+	d.timer.Reset(d.interval)
+}
+
+// Flush writes out the block aligned part of the buffered data. The
+// unaligned remainder stays in the buffer until more data completes its
+// block, or until Close.
+func (d *DirectIO) Flush() error {
+	d.lock()
+	defer d.unlock()
+
+	if d.isClosed {
+		return errors.New("the writer is closed")
+	}
+
+	err := d.flushAligned()
+	d.report()
+
+	return err
+}
+
+// flushAligned writes the whole blocks of the buffer to the file and moves
+// the remainder to its start. A failure is sticky, like in flush.
+func (d *DirectIO) flushAligned() error {
+	if d.err != nil {
+		return d.err
+	}
+
+	aligned := d.n - d.n%d.blockSize
+	if aligned == 0 {
+		return nil
+	}
+
+	n, err := d.writeFile(d.buf[:aligned])
+	copy(d.buf, d.buf[n:d.n])
+	d.n -= n
+	if err != nil {
+		d.err = err
+	}
+
+	return err
+}
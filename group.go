@@ -0,0 +1,53 @@
+package directio
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// groupParallelism bounds how many writers FlushAll and CloseAll work on at
+// once.
+const groupParallelism = 16
+
+// FlushAll calls Flush on writers concurrently, a bounded number of them at
+// a time, and returns the errors of those that failed, joined. Once ctx is
+// done, the writers not started yet are left alone and ctx.Err() is part of
+// the result; flushes already running are waited for.
+func FlushAll(ctx context.Context, writers ...*DirectIO) error {
+	return forAll(ctx, writers, (*DirectIO).Flush)
+}
+
+// CloseAll is FlushAll with Close, e.g. for the segment files of a store at
+// checkpoint time.
+func CloseAll(ctx context.Context, writers ...*DirectIO) error {
+	return forAll(ctx, writers, (*DirectIO).Close)
+}
+
+// forAll runs fn on writers, groupParallelism of them at a time.
+func forAll(ctx context.Context, writers []*DirectIO, fn func(d *DirectIO) error) error {
+	errs := make([]error, len(writers), len(writers)+1)
+	sem := make(chan struct{}, groupParallelism)
+	var wg sync.WaitGroup
+
+	for i, w := range writers {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			errs[i] = fn(w)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(append(errs, ctx.Err())...)
+}
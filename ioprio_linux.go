@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioprioClassShift = 13
+	ioprioWhoProcess = 1
+)
+
+// ioprioValue encodes a class and a level for ioprio_set(2).
+func ioprioValue(class IOPriorityClass, level int) int {
+	return int(class)<<ioprioClassShift | level
+}
+
+// setThreadIOPriority sets the I/O priority of the calling thread and
+// returns the previous one. The caller must have locked its goroutine to the
+// thread.
+func setThreadIOPriority(prio int) (int, error) {
+	// With who set to 0, IOPRIO_WHO_PROCESS is the calling thread.
+	old, _, e1 := syscall.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+	if e1 != 0 {
+		return 0, e1
+	}
+
+	if _, _, e1 := syscall.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio)); e1 != 0 {
+		return 0, e1
+	}
+
+	return int(old), nil
+}
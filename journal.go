@@ -0,0 +1,208 @@
+package directio
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// TailJournalSuffix is appended to the path of a file to name the
+	// journal of WithTailJournal.
+	TailJournalSuffix = ".tail-journal"
+
+	// tailJournalMagic starts every tail journal.
+	tailJournalMagic = "DIOJ"
+
+	// tailJournalHeaderLen is the size of the journal header: magic (4
+	// bytes), tail length (4 bytes), tail offset (8 bytes), CRC-32C of the
+	// header and the tail (4 bytes) and reserved (12 bytes).
+	tailJournalHeaderLen = 32
+)
+
+// namer is implemented by backends that know the path they were opened at.
+type namer interface {
+	Name() string
+}
+
+// WithTailJournal makes Close journal the unaligned tail before writing it.
+// The tail is first written, zero padded, to a small journal file next to
+// the target, named after it with TailJournalSuffix, with O_DIRECT and
+// fsync. It is then written to the target as set by WithTailStrategy and,
+// once the target is synced, the journal is removed. A crash in between
+// leaves the journal behind for Recover, so the file always ends up either
+// without its tail or with all of it, never with part of it. The target must
+// be a file opened by path.
+func WithTailJournal(enabled bool) Option {
+	return func(d *DirectIO) {
+		d.journal = enabled
+	}
+}
+
+// journalPath returns the path of the tail journal of the target.
+func (d *DirectIO) journalPath() (string, error) {
+	n, ok := d.f.(namer)
+	if !ok || n.Name() == "" {
+		return "", errors.New("tail journal needs a file opened by path")
+	}
+
+	return n.Name() + TailJournalSuffix, nil
+}
+
+// writeJournal durably writes the buffered tail, to go at d.off, to the
+// journal.
+func (d *DirectIO) writeJournal() error {
+	path, err := d.journalPath()
+	if err != nil {
+		return err
+	}
+
+	buf, err := allocAlignedBuf(d.blockSize, alignUp(tailJournalHeaderLen+d.n, d.blockSize))
+	if err != nil {
+		return err
+	}
+
+	copy(buf[0:4], tailJournalMagic)
+	binary.BigEndian.PutUint32(buf[4:8], uint32(d.n))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(d.off))
+	copy(buf[tailJournalHeaderLen:], d.buf[:d.n])
+
+	crc := crc32.Update(crc32.Checksum(buf[0:16], crc32c), crc32c, buf[tailJournalHeaderLen:tailJournalHeaderLen+d.n])
+	binary.BigEndian.PutUint32(buf[16:20], crc)
+
+	j, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|O_DIRECT, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := j.Write(buf); err != nil {
+		j.Close()
+		return err
+	}
+	if err := j.Sync(); err != nil {
+		j.Close()
+		return err
+	}
+	if err := j.Close(); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// clearJournal syncs the target and then removes the journal, the tail it
+// held being safely in the target.
+func (d *DirectIO) clearJournal() error {
+	path, err := d.journalPath()
+	if err != nil {
+		return err
+	}
+
+	if err := d.sync(); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes the creation or removal of an entry of dir durable.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
+
+// Recover completes a Close interrupted while writing the tail of the file
+// at path with WithTailJournal. If a valid journal is found, its tail is
+// written to the file again, which is then truncated right after it (for a
+// regular file) and synced, and recovered is true. A journal that isn't
+// valid was torn before its tail was applied and is just dropped. Either
+// way the journal is removed. Recover does nothing if there is no journal.
+func Recover(path string) (recovered bool, err error) {
+	jpath := path + TailJournalSuffix
+
+	j, err := os.ReadFile(jpath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if tail, off, ok := parseTailJournal(j); ok {
+		if err := applyTail(path, tail, off); err != nil {
+			return false, err
+		}
+		recovered = true
+	}
+
+	if err := os.Remove(jpath); err != nil {
+		return recovered, err
+	}
+
+	return recovered, syncDir(filepath.Dir(jpath))
+}
+
+// parseTailJournal validates the journal j and returns the tail it holds and
+// the offset the tail goes at.
+func parseTailJournal(j []byte) (tail []byte, off int64, ok bool) {
+	if len(j) < tailJournalHeaderLen || string(j[0:4]) != tailJournalMagic {
+		return nil, 0, false
+	}
+
+	n := int(binary.BigEndian.Uint32(j[4:8]))
+	if n > len(j)-tailJournalHeaderLen {
+		return nil, 0, false
+	}
+	tail = j[tailJournalHeaderLen : tailJournalHeaderLen+n]
+
+	crc := crc32.Update(crc32.Checksum(j[0:16], crc32c), crc32c, tail)
+	if crc != binary.BigEndian.Uint32(j[16:20]) {
+		return nil, 0, false
+	}
+
+	return tail, int64(binary.BigEndian.Uint64(j[8:16])), true
+}
+
+// applyTail writes tail at off in the file at path, without O_DIRECT as it
+// is unaligned, and syncs it.
+func applyTail(path string, tail []byte, off int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt(tail, off); err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() {
+		if err := f.Truncate(off + int64(len(tail))); err != nil {
+			return err
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	// Don't leave the recovered tail in the page cache.
+	unix.Fadvise(int(f.Fd()), off, int64(len(tail)), unix.FADV_DONTNEED)
+
+	return nil
+}
@@ -0,0 +1,66 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestTailJournal(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	data := bytes.Repeat([]byte("journal"), 3001)
+
+	f := tmpFile(t, dir, "journal")
+	defer f.Close()
+
+	crash := errors.New("crash")
+	dio, err := New(f, WithTailJournal(true), WithFailurePoint(FailAfterJournal, func() error { return crash }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != crash {
+		t.Fatalf("Close = %v, want %v", err, crash)
+	}
+
+	recovered, err := Recover(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recovered {
+		t.Fatal("the tail was not recovered")
+	}
+	if got, _ := os.ReadFile(f.Name()); !bytes.Equal(got, data) {
+		t.Fatalf("recovered file has %d bytes, want %d", len(got), len(data))
+	}
+	if _, err := os.Stat(f.Name() + TailJournalSuffix); !os.IsNotExist(err) {
+		t.Fatal("the journal is still there after Recover")
+	}
+
+	// A clean Close leaves no journal behind.
+	g := tmpFile(t, dir, "journal-clean")
+	defer g.Close()
+
+	dio, err = New(g, WithTailJournal(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dio.Write(data)
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(g.Name() + TailJournalSuffix); !os.IsNotExist(err) {
+		t.Fatal("the journal is still there after Close")
+	}
+	if recovered, err := Recover(g.Name()); recovered || err != nil {
+		t.Fatalf("Recover without a journal returned %v, %v", recovered, err)
+	}
+}
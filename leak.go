@@ -0,0 +1,43 @@
+package directio
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// WithLeakCheck makes the writer call logf, with the stack it was created
+// at, if it is garbage collected without a successful Close: whatever it
+// still buffered, the tail at least, is then silently lost. log.Printf fits;
+// tests can pass a function panicking or failing the test instead. It is a
+// debugging aid: checks run only when the garbage collector gets to the
+// writer, and recording the stack makes creating writers slower. Writers
+// with WithFlushInterval stay reachable through their timer, and are never
+// reported.
+func WithLeakCheck(logf func(format string, args ...any)) Option {
+	return func(d *DirectIO) {
+		d.leakLog = logf
+	}
+}
+
+// leakCheck is what the cleanup of WithLeakCheck looks at. It must not
+// reference the writer, or the writer would never be collected.
+type leakCheck struct {
+	stack  []byte
+	closed atomic.Bool
+}
+
+// trackLeak arms the cleanup of WithLeakCheck, once the writer is created.
+func (d *DirectIO) trackLeak() {
+	if d.leakLog == nil {
+		return
+	}
+
+	logf := d.leakLog
+	d.leak = &leakCheck{stack: debug.Stack()}
+	runtime.AddCleanup(d, func(c *leakCheck) {
+		if !c.closed.Load() {
+			logf("directio: writer garbage collected without Close, buffered data was lost; created at:\n%s", c.stack)
+		}
+	}, d.leak)
+}
@@ -0,0 +1,108 @@
+package directio
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket limiting the bandwidth of writes. One Limiter
+// can be shared by writers on the same device to cap their total bandwidth,
+// so that e.g. backup jobs don't starve a database on the same disk.
+//
+// Tokens are taken at flush granularity: each flush waits until the bucket
+// has refilled enough to pay for it. Flushes larger than the burst are fine,
+// they just wait longer.
+//
+// A Limiter can also cap the bytes being written at any given time across
+// all its writers, see SetMaxInFlight.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// inFlight counts the bytes of the writes in progress, capped by
+	// maxInFlight when it is set. cond is signalled when writes finish.
+	cond        *sync.Cond
+	inFlight    int64
+	maxInFlight int64
+}
+
+// NewLimiter returns a Limiter allowing bytesPerSec bytes per second, with
+// bursts of up to one second worth of data. A bytesPerSec of 0 doesn't limit
+// the bandwidth, which is useful with SetMaxInFlight.
+func NewLimiter(bytesPerSec int64) *Limiter {
+	rate := float64(bytesPerSec)
+
+	l := &Limiter{
+		rate:   rate,
+		burst:  rate,
+		tokens: rate,
+		last:   time.Now(),
+	}
+	l.cond = sync.NewCond(&l.mu)
+
+	return l
+}
+
+// SetMaxInFlight caps the number of bytes the writers sharing l may have
+// in progress at once, 0 meaning no cap. A single write larger than the cap
+// is let through once nothing else is in flight.
+func (l *Limiter) SetMaxInFlight(n int64) {
+	l.mu.Lock()
+	l.maxInFlight = n
+	l.mu.Unlock()
+
+	l.cond.Broadcast()
+}
+
+// acquire waits until n more bytes may be in flight and accounts for them.
+func (l *Limiter) acquire(n int) {
+	l.mu.Lock()
+	for l.maxInFlight > 0 && l.inFlight > 0 && l.inFlight+int64(n) > l.maxInFlight {
+		l.cond.Wait()
+	}
+	l.inFlight += int64(n)
+	l.mu.Unlock()
+}
+
+// release ends a write started with acquire.
+func (l *Limiter) release(n int) {
+	l.mu.Lock()
+	l.inFlight -= int64(n)
+	l.mu.Unlock()
+
+	l.cond.Broadcast()
+}
+
+// Wait takes n bytes worth of tokens from the bucket, sleeping until they
+// are available.
+func (l *Limiter) Wait(n int) {
+	if l.rate <= 0 || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	// Reserve n right away, so concurrent callers queue up behind each other.
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
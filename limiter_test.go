@@ -0,0 +1,109 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "ratelimit")
+	defer f.Close()
+
+	const rate = 4 << 20
+
+	dio, err := NewSize(f, 1<<20, WithRateLimit(rate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first second worth of data is the burst, the rest must wait.
+	start := time.Now()
+	data := bytes.Repeat([]byte{1}, 1<<20)
+	for i := 0; i < 6; i++ {
+		if _, err := dio.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("wrote 6MB at %d bytes/s in %v", rate, elapsed)
+	}
+}
+
+func TestLimiterInFlight(t *testing.T) {
+	l := NewLimiter(0)
+	l.SetMaxInFlight(8192)
+
+	l.acquire(6144)
+
+	done := make(chan struct{})
+	go func() {
+		l.acquire(4096)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("acquire went over the in-flight cap")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	l.release(6144)
+	<-done
+	l.release(4096)
+
+	// Writes larger than the cap go through alone.
+	l.acquire(1 << 20)
+	l.release(1 << 20)
+}
+
+func TestSharedLimiter(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	l := NewLimiter(4 << 20)
+	l.SetMaxInFlight(1 << 20)
+
+	start := time.Now()
+	errc := make(chan error, 2)
+	for _, name := range []string{"shared-a", "shared-b"} {
+		f := tmpFile(t, dir, name)
+		defer f.Close()
+
+		go func() {
+			dio, err := NewSize(f, 1<<20, WithLimiter(l))
+			if err != nil {
+				errc <- err
+				return
+			}
+			data := bytes.Repeat([]byte{2}, 1<<20)
+			for i := 0; i < 3; i++ {
+				if _, err := dio.Write(data); err != nil {
+					errc <- err
+					return
+				}
+			}
+			errc <- dio.Close()
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 6MB in total at 4MB/s, with a 4MB burst.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("two writers wrote 6MB at 4MB/s in %v", elapsed)
+	}
+}
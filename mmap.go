@@ -0,0 +1,89 @@
+package directio
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+var (
+	// ErrUnalignedMapping is returned by WriteFromMmap when data can't be
+	// written straight from memory: it doesn't start on a block boundary,
+	// or the writer still buffers a partial block.
+	ErrUnalignedMapping = errors.New("mapping is not aligned for direct I/O")
+
+	// ErrMappingFault is returned, along with EFAULT, when the kernel
+	// couldn't read the memory given to WriteFromMmap.
+	ErrMappingFault = errors.New("direct write from the mapping faulted")
+)
+
+// WriteFromMmap writes data, typically a memory mapped input, straight to
+// the file with O_DIRECT instead of copying it to the buffer first. mmap(2)
+// returns page aligned memory, which meets the alignment of most files, so
+// only the last, partial block of data is copied to the buffer. data must
+// start on a block boundary, and the data written before must end on one,
+// otherwise nothing is written and ErrUnalignedMapping is returned.
+//
+// The kernel reads the mapping itself, and fails with EFAULT, reported as
+// ErrMappingFault, where user space would get SIGBUS: for pages past the
+// end of the mapped file, e.g. after it was truncated, and for mappings
+// without read permission. Mapping the file being written is not supported.
+// Like any write error, the fault leaves the writer failed.
+func (d *DirectIO) WriteFromMmap(data []byte) (int, error) {
+	d.lock()
+	defer d.unlock()
+
+	if d.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+
+	if err := d.flushAligned(); err != nil {
+		return 0, err
+	}
+	if d.n != 0 || align(data, d.blockSize) != 0 {
+		return 0, ErrUnalignedMapping
+	}
+
+	n, err := d.writeMapped(data)
+	if errors.Is(err, syscall.EFAULT) {
+		err = fmt.Errorf("%w: %w", ErrMappingFault, err)
+	}
+
+	return n, err
+}
+
+// writeMapped writes the aligned data straight to the file, and buffers its
+// partial last block.
+func (d *DirectIO) writeMapped(data []byte) (int, error) {
+	if d.strict {
+		return d.writeStrict(data)
+	}
+
+	var over bool
+	if q := d.quota(); q >= 0 && int64(len(data)) > q {
+		data, over = data[:q], true
+	}
+
+	var n int
+	var err error
+	if l := len(data) - len(data)%d.blockSize; l > 0 {
+		n, err = d.writeFile(data[:l])
+		d.fast.direct += int64(n)
+		if err != nil {
+			d.err = err
+		}
+	}
+	if err == nil {
+		var m int
+		m, err = d.write(data[n:])
+		n += m
+	}
+	d.accept(data[:n])
+	d.report()
+
+	if err == nil && over {
+		err = d.quotaError()
+	}
+
+	return n, err
+}
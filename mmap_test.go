@@ -0,0 +1,100 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps size bytes of the file at path read-only.
+func mapFile(t *testing.T, path string, size int) []byte {
+	src, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	m, err := unix.Mmap(int(src.Fd()), 0, size, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unix.Munmap(m) })
+
+	return m
+}
+
+func TestWriteFromMmap(t *testing.T) {
+	data := make([]byte, 3*4096+100)
+	for i := range data {
+		data[i] = byte(i % 227)
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	name := filepath.Join(dir, "source")
+	if err := os.WriteFile(name, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	m := mapFile(t, name, len(data))
+
+	f := tmpFile(t, dir, "mmap")
+	defer f.Close()
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := dio.WriteFromMmap(m); n != len(data) || err != nil {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if s := dio.Stats(); s.FastPath != 3*4096 {
+		t.Fatalf("%d bytes took the zero-copy path, want %d", s.FastPath, 3*4096)
+	}
+
+	// The tail is buffered now.
+	if _, err := dio.WriteFromMmap(m); !errors.Is(err, ErrUnalignedMapping) {
+		t.Fatalf("got %v, want ErrUnalignedMapping", err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("file content mismatch, got %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestWriteFromMmapFault(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	name := filepath.Join(dir, "short-source")
+	if err := os.WriteFile(name, make([]byte, 4096), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// Map past the end of the file.
+	m := mapFile(t, name, 4*4096)
+
+	f := tmpFile(t, dir, "mmap-fault")
+	defer f.Close()
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dio.WriteFromMmap(m); !errors.Is(err, ErrMappingFault) || !errors.Is(err, unix.EFAULT) {
+		t.Fatalf("got %v, want ErrMappingFault", err)
+	}
+}
@@ -0,0 +1,198 @@
+package directio
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// MultiPolicy decides what a MultiWriter does when some destinations fail.
+type MultiPolicy int
+
+const (
+	// MultiRequireAll fails the writer as soon as any destination fails.
+	MultiRequireAll MultiPolicy = iota
+
+	// MultiRequireOne drops failed destinations and keeps going while at
+	// least one is left.
+	MultiRequireOne
+)
+
+// ErrAllDestinationsFailed is returned by a MultiWriter with the
+// MultiRequireOne policy once no destination is left.
+var ErrAllDestinationsFailed = errors.New("all destinations failed")
+
+// MultiWriter writes the same stream to several O_DIRECT files, e.g. to keep
+// a copy on a second disk. Every block is written to all destinations from
+// one aligned buffer, instead of one buffer per destination as with an
+// io.MultiWriter over DirectIO writers.
+type MultiWriter struct {
+	dests     []*os.File
+	errs      []error
+	policy    MultiPolicy
+	blockSize int
+
+	buf []byte
+	n   int
+	err error
+
+	isClosed bool
+}
+
+// NewMultiWriter returns a writer fanning out to dests, which must be opened
+// with O_DIRECT, with a buffer of size bytes.
+func NewMultiWriter(dests []*os.File, size int, policy MultiPolicy) (*MultiWriter, error) {
+	if len(dests) == 0 {
+		return nil, errors.New("no destinations")
+	}
+
+	blockSize := 0
+	for _, f := range dests {
+		if err := checkDirectIO(f.Fd()); err != nil {
+			return nil, err
+		}
+		if a, _ := fdAlignment(f.Fd()); a > blockSize {
+			blockSize = a
+		}
+	}
+
+	if c := config(); size < c.MinBufferSize {
+		size = c.MinBufferSize
+	}
+
+	buf, err := allocAlignedBuf(blockSize, alignUp(size, blockSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultiWriter{
+		dests:     dests,
+		errs:      make([]error, len(dests)),
+		policy:    policy,
+		blockSize: blockSize,
+		buf:       buf,
+	}, nil
+}
+
+// Errors returns the error of each destination, nil for the healthy ones.
+func (m *MultiWriter) Errors() []error { return m.errs }
+
+// writeAll writes p to every healthy destination with write and applies the
+// failure policy.
+func (m *MultiWriter) writeAll(p []byte, write func(f *os.File, p []byte) error) error {
+	healthy := 0
+	for i, f := range m.dests {
+		if m.errs[i] != nil {
+			continue
+		}
+		if err := write(f, p); err != nil {
+			m.errs[i] = err
+			if m.policy == MultiRequireAll {
+				return err
+			}
+			continue
+		}
+		healthy++
+	}
+
+	if healthy == 0 {
+		return ErrAllDestinationsFailed
+	}
+
+	return nil
+}
+
+func writeFull(f *os.File, p []byte) error {
+	_, err := f.Write(p)
+
+	return err
+}
+
+// Write writes p to all destinations. Block aligned data in an aligned p is
+// written without copying it to the buffer.
+func (m *MultiWriter) Write(p []byte) (nn int, err error) {
+	if m.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	if m.n == 0 && align(p, m.blockSize) == 0 && len(p) >= len(m.buf) {
+		l := len(p) & -m.blockSize
+		if m.err = m.writeAll(p[:l], writeFull); m.err != nil {
+			return 0, m.err
+		}
+		nn, p = l, p[l:]
+	}
+
+	for len(p) > 0 {
+		n := copy(m.buf[m.n:], p)
+		m.n += n
+		nn += n
+		p = p[n:]
+
+		if m.n == len(m.buf) {
+			if m.err = m.writeAll(m.buf, writeFull); m.err != nil {
+				return nn, m.err
+			}
+			m.n = 0
+		}
+	}
+
+	return nn, nil
+}
+
+// Close writes the data left in the buffer to all destinations, the
+// unaligned tail with O_DIRECT disabled like DirectIO.Close. It doesn't
+// close the files.
+func (m *MultiWriter) Close() error {
+	if m.isClosed {
+		return errors.New("the writer is already closed")
+	}
+
+	m.isClosed = true
+
+	if m.err != nil {
+		return m.err
+	}
+
+	if aligned := m.n - m.n%m.blockSize; aligned > 0 {
+		if err := m.writeAll(m.buf[:aligned], writeFull); err != nil {
+			return err
+		}
+		copy(m.buf, m.buf[aligned:m.n])
+		m.n -= aligned
+	}
+
+	if m.n == 0 {
+		return nil
+	}
+
+	return m.writeAll(m.buf[:m.n], writeBufferedTail)
+}
+
+// writeBufferedTail writes an unaligned tail to f with O_DIRECT disabled,
+// syncs it and drops it from the page cache.
+func writeBufferedTail(f *os.File, p []byte) error {
+	if err := setDirectIO(f.Fd(), false); err != nil {
+		return err
+	}
+
+	_, err := f.Write(p)
+
+	_ = setDirectIO(f.Fd(), true)
+
+	if err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestMultiWriter(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	a := tmpFile(t, dir, "multi-a")
+	defer a.Close()
+	b := tmpFile(t, dir, "multi-b")
+	defer b.Close()
+
+	// A read-only destination fails all its writes.
+	c, err := os.OpenFile(a.Name(), os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	m, err := NewMultiWriter([]*os.File{a, b, c}, 0, MultiRequireOne)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	for _, n := range writesizes {
+		p := bytes.Repeat([]byte{byte(n)}, n)
+		if _, err := m.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, p...)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := m.Errors()
+	if errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Fatalf("Errors = %v", errs)
+	}
+
+	for _, f := range []*os.File{a, b} {
+		got, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s holds %d bytes, want %d", f.Name(), len(got), len(data))
+		}
+	}
+}
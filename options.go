@@ -0,0 +1,179 @@
+package directio
+
+import (
+	"hash"
+	"io"
+	"time"
+)
+
+// Option configures optional behavior of a DirectIO writer.
+type Option func(d *DirectIO)
+
+// WithAlignment sets the block size of the writer instead of detecting it,
+// e.g. for a Backend without a real file descriptor. It must be a power of
+// two.
+func WithAlignment(blockSize int) Option {
+	return func(d *DirectIO) {
+		d.blockSize = blockSize
+		d.alignSource = AlignmentFallback
+		d.fixedAlign = true
+	}
+}
+
+// WithChecksum hashes every byte accepted by Write with h. The final digest
+// is recorded at Close and returned by Sum.
+func WithChecksum(h hash.Hash) Option {
+	return func(d *DirectIO) {
+		d.hash = h
+	}
+}
+
+// WithChecksumTrailer makes Close append a trailer holding the digest of
+// WithChecksum and the data length to the output, so the file can later be
+// validated with VerifyFile. It has no effect without WithChecksum.
+func WithChecksumTrailer(enabled bool) Option {
+	return func(d *DirectIO) {
+		d.trailer = enabled
+	}
+}
+
+// WithTee copies everything the writer writes to the file to w, straight
+// from the aligned buffer after each flush. Unlike an io.MultiWriter in
+// front of the writer, it keeps the zero-copy path for aligned writes. An
+// error from w fails the writer. It may be given several times.
+func WithTee(w io.Writer) Option {
+	return func(d *DirectIO) {
+		d.tees = append(d.tees, w)
+	}
+}
+
+// WithHasher feeds everything the writer writes to the file to h, like
+// WithTee. Unlike WithChecksum, it sees the data as it reaches the file,
+// checksum trailer included.
+func WithHasher(h hash.Hash) Option {
+	return WithTee(h)
+}
+
+// WithVerify makes the writer re-read every range it flushes with O_DIRECT
+// and compare it with the data that was written. A mismatch is reported as a
+// *CorruptionError holding the offset of the first bad byte.
+//
+// Verification doubles the I/O done by the writer and is meant for archival
+// writes to hardware that isn't trusted.
+func WithVerify(enabled bool) Option {
+	return func(d *DirectIO) {
+		d.verify = enabled
+	}
+}
+
+// WithRateLimit limits the writer to bytesPerSec bytes per second, checked
+// at every flush.
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(d *DirectIO) {
+		d.limiter = NewLimiter(bytesPerSec)
+	}
+}
+
+// WithLimiter makes the writer take its bandwidth from l, which may be
+// shared with other writers.
+func WithLimiter(l *Limiter) Option {
+	return func(d *DirectIO) {
+		d.limiter = l
+	}
+}
+
+// WithMaxSize limits the writer to n bytes of data. A write going past the
+// budget is cut short at it and returns a *QuotaError, which matches
+// ErrQuotaExceeded. The checksum trailer of WithChecksumTrailer and the
+// padding of TailPad don't count towards the budget.
+func WithMaxSize(n int64) Option {
+	return func(d *DirectIO) {
+		d.maxSize = n
+	}
+}
+
+// WithProgress calls fn whenever a Write, ReadFrom or Close flushed data,
+// with the number of bytes accepted by the writer so far and how many of
+// them are in the file, e.g. to render a progress bar. The padding of
+// TailPad and the checksum trailer of WithChecksumTrailer aren't counted, so
+// flushed never exceeds written. fn runs on the goroutine calling Write,
+// ReadFrom or Close and should return quickly.
+func WithProgress(fn func(written, flushed int64)) Option {
+	return func(d *DirectIO) {
+		d.progress = fn
+	}
+}
+
+// WithFlushObserver calls fn after every write to the file, with the number
+// of bytes written and how long the write took, rate limiting of
+// WithRateLimit excluded, e.g. to feed a moving average of the device
+// throughput and alert when it slows down. fn runs on the goroutine that
+// flushed and should return quickly.
+func WithFlushObserver(fn func(bytes int, d time.Duration)) Option {
+	return func(d *DirectIO) {
+		d.observer = fn
+	}
+}
+
+// WithCloseFile makes Close also close the file, once the tail is written
+// and synced, so the writer owns the file. The error of closing the file is
+// returned by Close if nothing failed before. The file stays open, and the
+// caller's, if creating the writer fails.
+func WithCloseFile(enabled bool) Option {
+	return func(d *DirectIO) {
+		d.closeFile = enabled
+	}
+}
+
+// IOPriorityClass is an I/O scheduling class, see ioprio_set(2).
+type IOPriorityClass int
+
+const (
+	// IOPriorityRealtime gets the disk first. It needs CAP_SYS_ADMIN.
+	IOPriorityRealtime IOPriorityClass = 1
+
+	// IOPriorityBestEffort is the default class, with levels 0 (highest)
+	// to 7 (lowest).
+	IOPriorityBestEffort IOPriorityClass = 2
+
+	// IOPriorityIdle only gets the disk when nobody else needs it.
+	IOPriorityIdle IOPriorityClass = 3
+)
+
+// WithIOPriority runs the writes of the writer with the I/O priority class
+// and level given, so that e.g. archival writes yield to foreground traffic.
+//
+// I/O priorities are per thread, so every write locks its goroutine to its
+// thread, switches the priority and restores it afterwards. They are
+// honored by the BFQ and mq-deadline schedulers, and only for O_DIRECT
+// writes: buffered writes are written back by kernel threads.
+func WithIOPriority(class IOPriorityClass, level int) Option {
+	return func(d *DirectIO) {
+		d.ioprio = ioprioValue(class, level)
+	}
+}
+
+// TailStrategy selects how Close writes the last, partial block.
+type TailStrategy int
+
+const (
+	// TailAuto uses TailPad for block devices and the writers of Regions,
+	// TailBuffered otherwise.
+	TailAuto TailStrategy = iota
+
+	// TailBuffered writes the tail with O_DIRECT disabled, then syncs it and
+	// drops it from the page cache. The file ends exactly at the data.
+	TailBuffered
+
+	// TailPad zero pads the tail to a full block and writes it with O_DIRECT.
+	// Regular files are truncated back to the data afterwards. This is the
+	// only option on raw devices, which can't hold a partial sector.
+	TailPad
+)
+
+// WithTailStrategy sets how Close writes the last, partial block.
+func WithTailStrategy(s TailStrategy) Option {
+	return func(d *DirectIO) {
+		d.tail = s
+	}
+}
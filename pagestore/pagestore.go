@@ -0,0 +1,381 @@
+// Package pagestore stores fixed size pages in a file, read and written by
+// page ID with O_DIRECT, with a free list for recycling pages and optional
+// per-page checksums. It is the minimal building block of an embedded
+// storage engine managing its own cache.
+//
+// Page 0 of the file is the header of the store; IDs handed out by
+// AllocatePage start at 1.
+package pagestore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sync"
+
+	"github.com/oddmario/directio"
+)
+
+var (
+	// ErrPageRange is returned for a page ID the store doesn't hold.
+	ErrPageRange = errors.New("page ID out of range")
+
+	// ErrChecksum is returned when a page read back doesn't match its
+	// checksum.
+	ErrChecksum = errors.New("page checksum mismatch")
+
+	// ErrPageSize is returned for a page buffer of the wrong size.
+	ErrPageSize = errors.New("wrong page size")
+
+	// ErrNotPageStore is returned by Open for a file without a valid header.
+	ErrNotPageStore = errors.New("not a page store")
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	headerMagic = "DIOPAGES"
+
+	// The header holds the magic, the page size, the flags, the number of
+	// pages, the head of the free list and a checksum of it all.
+	headerSize = 8 + 4 + 4 + 8 + 8 + 4
+
+	flagChecksums = 1 << 0
+
+	// checksumSize is what the checksum takes at the end of every page.
+	checksumSize = 4
+
+	// minPageSize is the smallest page size, enough for the header.
+	minPageSize = 64
+)
+
+// Option configures a store created with Create.
+type Option func(s *Store)
+
+// WithChecksums makes the store keep a CRC-32C checksum at the end of every
+// page, checked when the page is read. Pages then hold DataSize bytes, 4
+// less than the page size.
+func WithChecksums(enabled bool) Option {
+	return func(s *Store) {
+		s.checksums = enabled
+	}
+}
+
+// Store is a file of fixed size pages. It is safe for concurrent use.
+type Store struct {
+	f         *os.File
+	pageSize  int
+	checksums bool
+
+	// arena holds the aligned scratch pages I/O goes through.
+	arena *directio.Arena
+
+	mu       sync.Mutex
+	pages    uint64
+	freeHead uint64
+	isClosed bool
+}
+
+// Create initializes a store of pages of pageSize bytes in f, which must be
+// opened read-write with O_DIRECT. pageSize must be a power of two and a
+// multiple of the direct I/O alignment of the file. Whatever f held is
+// overwritten.
+func Create(f *os.File, pageSize int, opts ...Option) (*Store, error) {
+	if !validPageSize(pageSize) {
+		return nil, errors.New("page size must be a power of two of at least 64 bytes")
+	}
+
+	s, err := newStore(f, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.pages = 1
+
+	if err := f.Truncate(0); err != nil {
+		s.arena.Close()
+		return nil, err
+	}
+	if err := s.writeHeader(); err != nil {
+		s.arena.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Open opens the store in f, which must be opened read-write with O_DIRECT.
+func Open(f *os.File) (*Store, error) {
+	// The page size isn't known yet, read just the header.
+	head := make([]byte, headerSize)
+	if _, err := directio.ReadFullAt(f, head, 0); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotPageStore, err)
+	}
+
+	if string(head[:8]) != headerMagic ||
+		crc32.Checksum(head[:headerSize-4], crc32c) != binary.LittleEndian.Uint32(head[headerSize-4:]) {
+		return nil, ErrNotPageStore
+	}
+
+	pageSize := int(binary.LittleEndian.Uint32(head[8:]))
+	if !validPageSize(pageSize) {
+		return nil, ErrNotPageStore
+	}
+
+	s, err := newStore(f, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	s.checksums = binary.LittleEndian.Uint32(head[12:])&flagChecksums != 0
+	s.pages = binary.LittleEndian.Uint64(head[16:])
+	s.freeHead = binary.LittleEndian.Uint64(head[24:])
+
+	return s, nil
+}
+
+// validPageSize reports whether pageSize is one Create accepts.
+func validPageSize(pageSize int) bool {
+	return pageSize >= minPageSize && pageSize&(pageSize-1) == 0
+}
+
+func newStore(f *os.File, pageSize int) (*Store, error) {
+	arena, err := directio.NewArena(pageSize, 16*pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{f: f, pageSize: pageSize, arena: arena}, nil
+}
+
+// PageSize returns the size of the pages in the file.
+func (s *Store) PageSize() int { return s.pageSize }
+
+// DataSize returns how many bytes a page holds: the page size, less the
+// checksum with WithChecksums.
+func (s *Store) DataSize() int {
+	if s.checksums {
+		return s.pageSize - checksumSize
+	}
+
+	return s.pageSize
+}
+
+// Pages returns the number of pages in the file, header and free pages
+// included.
+func (s *Store) Pages() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pages
+}
+
+// ReadPage reads page id into p, which must be DataSize bytes long.
+func (s *Store) ReadPage(id uint64, p []byte) error {
+	if len(p) != s.DataSize() {
+		return ErrPageSize
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(id); err != nil {
+		return err
+	}
+
+	page, err := s.readPage(id)
+	if err != nil {
+		return err
+	}
+	copy(p, page)
+	s.arena.Put(page)
+
+	return nil
+}
+
+// WritePage writes p, which must be DataSize bytes long, to page id.
+func (s *Store) WritePage(id uint64, p []byte) error {
+	if len(p) != s.DataSize() {
+		return ErrPageSize
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(id); err != nil {
+		return err
+	}
+
+	page, err := s.arena.Get()
+	if err != nil {
+		return err
+	}
+	defer s.arena.Put(page)
+	copy(page, p)
+
+	return s.writePage(id, page)
+}
+
+// AllocatePage returns the ID of a zeroed page, taken from the free list
+// or added at the end of the file.
+func (s *Store) AllocatePage() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isClosed {
+		return 0, errors.New("the store is closed")
+	}
+
+	id, next := s.pages, s.freeHead
+	reused := s.freeHead != 0
+	if reused {
+		page, err := s.readPage(s.freeHead)
+		if err != nil {
+			return 0, err
+		}
+		id, next = s.freeHead, binary.LittleEndian.Uint64(page)
+		s.arena.Put(page)
+	}
+
+	page, err := s.arena.Get()
+	if err != nil {
+		return 0, err
+	}
+	defer s.arena.Put(page)
+	clear(page)
+	if err := s.writePage(id, page); err != nil {
+		return 0, err
+	}
+
+	if reused {
+		s.freeHead = next
+	} else {
+		s.pages++
+	}
+
+	return id, s.writeHeader()
+}
+
+// FreePage puts page id on the free list, for AllocatePage to hand out
+// again. The page must not be used afterwards.
+func (s *Store) FreePage(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.check(id); err != nil {
+		return err
+	}
+
+	// A free page holds the ID of the next one.
+	page, err := s.arena.Get()
+	if err != nil {
+		return err
+	}
+	defer s.arena.Put(page)
+	clear(page)
+	binary.LittleEndian.PutUint64(page, s.freeHead)
+	if err := s.writePage(id, page); err != nil {
+		return err
+	}
+
+	s.freeHead = id
+
+	return s.writeHeader()
+}
+
+// Sync makes the pages written so far durable.
+func (s *Store) Sync() error {
+	return s.f.Sync()
+}
+
+// Close syncs the file and releases the store. It doesn't close the file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isClosed {
+		return errors.New("the store is already closed")
+	}
+	s.isClosed = true
+
+	err := s.f.Sync()
+	s.arena.Close()
+
+	return err
+}
+
+// check validates a page ID on an open store.
+func (s *Store) check(id uint64) error {
+	if s.isClosed {
+		return errors.New("the store is closed")
+	}
+	if id == 0 || id >= s.pages {
+		return ErrPageRange
+	}
+
+	return nil
+}
+
+// readPage reads page id into a page of the arena, and checks its checksum.
+func (s *Store) readPage(id uint64) ([]byte, error) {
+	page, err := s.arena.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := directio.ReadFullAt(s.f, page, int64(id)*int64(s.pageSize)); err != nil {
+		s.arena.Put(page)
+		return nil, err
+	}
+
+	if s.checksums {
+		data := page[:s.pageSize-checksumSize]
+		if crc32.Checksum(data, crc32c) != binary.LittleEndian.Uint32(page[len(data):]) {
+			s.arena.Put(page)
+			return nil, fmt.Errorf("page %d: %w", id, ErrChecksum)
+		}
+	}
+
+	return page, nil
+}
+
+// writePage writes the page of the arena page to page id, adding its
+// checksum.
+func (s *Store) writePage(id uint64, page []byte) error {
+	if s.checksums {
+		data := page[:s.pageSize-checksumSize]
+		binary.LittleEndian.PutUint32(page[len(data):], crc32.Checksum(data, crc32c))
+	}
+
+	_, err := directio.PWriteAligned(s.f, page, int64(id)*int64(s.pageSize))
+
+	return err
+}
+
+// writeHeader writes page 0.
+func (s *Store) writeHeader() error {
+	page, err := s.arena.Get()
+	if err != nil {
+		return err
+	}
+	defer s.arena.Put(page)
+	clear(page)
+
+	var flags uint32
+	if s.checksums {
+		flags |= flagChecksums
+	}
+	copy(page, headerMagic)
+	binary.LittleEndian.PutUint32(page[8:], uint32(s.pageSize))
+	binary.LittleEndian.PutUint32(page[12:], flags)
+	binary.LittleEndian.PutUint64(page[16:], s.pages)
+	binary.LittleEndian.PutUint64(page[24:], s.freeHead)
+	binary.LittleEndian.PutUint32(page[headerSize-4:], crc32.Checksum(page[:headerSize-4], crc32c))
+
+	_, err = directio.PWriteAligned(s.f, page, 0)
+
+	return err
+}
@@ -0,0 +1,143 @@
+//go:build linux
+// +build linux
+
+package pagestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oddmario/directio"
+)
+
+func openFile(t *testing.T) *os.File {
+	dir, err := os.MkdirTemp("/var/tmp", "pagestore-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	f, err := os.OpenFile(filepath.Join(dir, "pages"), os.O_RDWR|os.O_CREATE|directio.O_DIRECT, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	return f
+}
+
+func TestStore(t *testing.T) {
+	f := openFile(t)
+
+	s, err := Create(f, 4096, WithChecksums(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []uint64
+	for i := 0; i < 4; i++ {
+		id, err := s.AllocatePage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != uint64(i+1) {
+			t.Fatalf("page %d got ID %d", i, id)
+		}
+		if err := s.WritePage(id, bytes.Repeat([]byte{byte('a' + i)}, s.DataSize())); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := s.FreePage(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FreePage(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WritePage(9, make([]byte, s.DataSize())); !errors.Is(err, ErrPageRange) {
+		t.Fatalf("page out of range: got %v", err)
+	}
+	if err := s.WritePage(1, make([]byte, 10)); !errors.Is(err, ErrPageSize) {
+		t.Fatalf("short page: got %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.DataSize() != 4092 || s.Pages() != 5 {
+		t.Fatalf("reopened with data size %d and %d pages", s.DataSize(), s.Pages())
+	}
+
+	// The free list is last in, first out.
+	for _, want := range []uint64{ids[2], ids[1], 5} {
+		id, err := s.AllocatePage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != want {
+			t.Fatalf("allocated page %d, want %d", id, want)
+		}
+	}
+
+	p := make([]byte, s.DataSize())
+	if err := s.ReadPage(ids[3], p); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, bytes.Repeat([]byte{'d'}, s.DataSize())) {
+		t.Fatal("page content mismatch")
+	}
+	if err := s.ReadPage(ids[1], p); err != nil || !bytes.Equal(p, make([]byte, s.DataSize())) {
+		t.Fatalf("reallocated page isn't zeroed (%v)", err)
+	}
+
+	// Corrupt a page behind the store's back.
+	raw, err := os.OpenFile(f.Name(), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.WriteAt([]byte("x"), 4*4096+100); err != nil {
+		t.Fatal(err)
+	}
+	raw.Sync()
+	raw.Close()
+	if err := s.ReadPage(4, p); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("corrupted page: got %v, want ErrChecksum", err)
+	}
+}
+
+func TestOpenNotStore(t *testing.T) {
+	f := openFile(t)
+
+	if _, err := Open(f); !errors.Is(err, ErrNotPageStore) {
+		t.Fatalf("got %v, want ErrNotPageStore", err)
+	}
+
+	// A valid header with a page size Create refuses, too small to hold
+	// the header itself.
+	for _, pageSize := range []uint32{16, 32, 4097} {
+		head := make([]byte, 4096)
+		copy(head, headerMagic)
+		binary.LittleEndian.PutUint32(head[8:], pageSize)
+		binary.LittleEndian.PutUint64(head[16:], 1)
+		binary.LittleEndian.PutUint32(head[headerSize-4:], crc32.Checksum(head[:headerSize-4], crc32c))
+		if err := os.WriteFile(f.Name(), head, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Open(f); !errors.Is(err, ErrNotPageStore) {
+			t.Fatalf("page size %d: got %v, want ErrNotPageStore", pageSize, err)
+		}
+	}
+}
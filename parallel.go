@@ -0,0 +1,134 @@
+package directio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ParallelWriter writes an output of known size with several writers at
+// once: the output is split into block aligned regions, each written by its
+// own goroutine with pwrite(2) from its own aligned buffer. Devices that
+// only reach their bandwidth with several requests in flight, like NVMe
+// drives, are kept busy this way.
+type ParallelWriter struct {
+	f  *os.File
+	ws []*DirectIO
+
+	// offs holds the start of every region, followed by the size.
+	offs []int64
+
+	isClosed bool
+}
+
+// NewParallelWriter returns a writer splitting the size bytes of f into at
+// most workers regions. f must be opened with O_DIRECT. The region writers
+// get a buffer of bufSize bytes and the options opts, see Regions.
+func NewParallelWriter(f *os.File, size int64, workers int, bufSize int, opts ...Option) (*ParallelWriter, error) {
+	if size <= 0 {
+		return nil, errors.New("size must be greater than zero")
+	}
+	if workers <= 0 {
+		return nil, errors.New("workers must be greater than zero")
+	}
+
+	regs, err := NewRegions(f, bufSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize, _ := fdAlignment(f.Fd())
+	regionSize := int64(alignUp(int((size+int64(workers)-1)/int64(workers)), blockSize))
+
+	p := &ParallelWriter{f: f}
+	for off := int64(0); off < size; off += regionSize {
+		length := min(regionSize, size-off)
+
+		w, err := regs.Writer(off, length)
+		if err != nil {
+			p.release()
+			return nil, err
+		}
+		p.ws = append(p.ws, w)
+		p.offs = append(p.offs, off)
+	}
+	p.offs = append(p.offs, size)
+
+	return p, nil
+}
+
+// Len returns the number of regions.
+func (p *ParallelWriter) Len() int { return len(p.ws) }
+
+// Region returns the offset and length of region i.
+func (p *ParallelWriter) Region(i int) (off, length int64) {
+	return p.offs[i], p.offs[i+1] - p.offs[i]
+}
+
+// Run calls fill for every region at once, each on its own goroutine, with
+// the writer of the region. fill must write the whole region. The region
+// writers are closed once fill returns. Run returns when all regions are
+// done, with the errors of the failed ones joined; a failing region doesn't
+// stop the others. The file is then truncated to the size of the output,
+// cutting the padding of the last region. Run can only be called once.
+func (p *ParallelWriter) Run(fill func(i int, w io.Writer) error) error {
+	if p.isClosed {
+		return errors.New("the writer is already closed")
+	}
+	p.isClosed = true
+
+	errs := make([]error, len(p.ws))
+	done := make(chan struct{})
+	for i, w := range p.ws {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			err := fill(i, w)
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+			if _, length := p.Region(i); err == nil && w.Stats().Written < length {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("region %d: %w", i, err)
+			}
+		}()
+	}
+	for range p.ws {
+		<-done
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if info, err := p.f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+
+	return p.f.Truncate(p.offs[len(p.ws)])
+}
+
+// ReadFromAt fills the output with the same range of r, reading every
+// region from r at its offset.
+func (p *ParallelWriter) ReadFromAt(r io.ReaderAt) error {
+	return p.Run(func(i int, w io.Writer) error {
+		off, length := p.Region(i)
+
+		n, err := io.Copy(w, io.NewSectionReader(r, off, length))
+		if err == nil && n < length {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return err
+	})
+}
+
+// release frees the buffers of the region writers. They hold no data yet,
+// and the file stays open.
+func (p *ParallelWriter) release() {
+	for _, w := range p.ws {
+		w.release()
+	}
+}
@@ -0,0 +1,79 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestParallelWriter(t *testing.T) {
+	data := make([]byte, 1<<20+333)
+	for i := range data {
+		data[i] = byte(i % 233)
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "parallel")
+	defer f.Close()
+
+	p, err := NewParallelWriter(f, int64(len(data)), 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 4 {
+		t.Fatalf("got %d regions, want 4", p.Len())
+	}
+	if err := p.ReadFromAt(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("file content mismatch, got %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestParallelWriterErrors(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "parallel-errors")
+	defer f.Close()
+
+	p, err := NewParallelWriter(f, 1<<20, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errFill := errors.New("fill failed")
+	err = p.Run(func(i int, w io.Writer) error {
+		switch i {
+		case 1:
+			return errFill
+		case 2:
+			// Leaves the region short.
+			_, err := w.Write(make([]byte, 4096))
+			return err
+		}
+		_, length := p.Region(i)
+		_, err := w.Write(make([]byte, length))
+		return err
+	})
+	if !errors.Is(err, errFill) || !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("got %v, want both region errors", err)
+	}
+
+	if err := p.Run(func(int, io.Writer) error { return nil }); err == nil {
+		t.Fatal("second Run succeeded")
+	}
+}
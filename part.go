@@ -0,0 +1,122 @@
+package directio
+
+import (
+	"crypto/md5"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+var _ io.WriteCloser = (*PartWriter)(nil)
+
+// Part describes a part completed by a PartWriter.
+type Part struct {
+	// Number is the number of the part, from 1 like S3 multipart uploads.
+	Number int
+
+	// Off and Size locate the part in the file.
+	Off  int64
+	Size int64
+
+	// Sum is the digest of the part.
+	Sum []byte
+}
+
+// PartWriter writes its output to a file in parts of a fixed size, for
+// gateways keeping the data locally while uploading it in parts to object
+// storage. As soon as a part is complete and written to the file, it is
+// passed to a callback, which can then upload it from the file; the last,
+// shorter part is passed at Close.
+type PartWriter struct {
+	w    *DirectIO
+	base int64
+	fn   func(p Part) error
+
+	// done holds the parts complete but not written yet.
+	done     []Part
+	parts    int
+	isClosed bool
+}
+
+// NewPartWriter returns a PartWriter writing to f, opened with O_DIRECT,
+// from its current offset in parts of partSize bytes, a multiple of the
+// block size. Parts are hashed with a hash from newHash, MD5 if nil, which
+// makes the digest the ETag S3 expects. fn is called within Write and Close;
+// the part is written to the file, but not synced. opts configure the
+// underlying writer; WithChunkCallback is taken by the PartWriter.
+func NewPartWriter(f *os.File, partSize int64, newHash func() hash.Hash, fn func(p Part) error, opts ...Option) (*PartWriter, error) {
+	if partSize <= 0 {
+		return nil, errors.New("part size must be greater than zero")
+	}
+	if newHash == nil {
+		newHash = md5.New
+	}
+
+	pw := &PartWriter{fn: fn}
+	opts = append(opts[:len(opts):len(opts)], WithChunkCallback(partSize, newHash, func(off, n int64, sum []byte) {
+		pw.parts++
+		pw.done = append(pw.done, Part{Number: pw.parts, Off: pw.base + off, Size: n, Sum: sum})
+	}))
+
+	w, err := NewSize(f, 0, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if partSize%int64(w.BlockSize()) != 0 {
+		w.release()
+		return nil, errors.New("part size must be a multiple of the block size")
+	}
+	pw.w, pw.base = w, w.off
+
+	return pw, nil
+}
+
+// Write writes p, passing the parts it completes to the callback once they
+// are written to the file.
+func (pw *PartWriter) Write(p []byte) (int, error) {
+	if pw.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+
+	n, err := pw.w.Write(p)
+	if err == nil && len(pw.done) > 0 {
+		// The parts end on block boundaries, Flush writes them all out.
+		err = pw.w.Flush()
+	}
+	if err == nil {
+		err = pw.report()
+	}
+
+	return n, err
+}
+
+// Close writes out the rest of the data, passes the last part to the
+// callback and closes the underlying writer. It doesn't close the file
+// unless WithCloseFile says so.
+func (pw *PartWriter) Close() error {
+	if pw.isClosed {
+		return errors.New("the writer is already closed")
+	}
+	pw.isClosed = true
+
+	if err := pw.w.Close(); err != nil {
+		return err
+	}
+
+	return pw.report()
+}
+
+// report passes the parts written to the callback.
+func (pw *PartWriter) report() error {
+	for len(pw.done) > 0 {
+		p := pw.done[0]
+		pw.done = pw.done[1:]
+
+		if err := pw.fn(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
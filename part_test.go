@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestPartWriter(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "parts")
+	defer f.Close()
+
+	in, err := os.Open(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	if _, err := NewPartWriter(f, 1000, nil, nil); err == nil {
+		t.Fatal("unaligned part size accepted")
+	}
+
+	const partSize = 1 << 18
+	var parts []Part
+	pw, err := NewPartWriter(f, partSize, nil, func(p Part) error {
+		// The part must be readable from the file already.
+		got := make([]byte, p.Size)
+		if _, err := io.ReadFull(io.NewSectionReader(in, p.Off, p.Size), got); err != nil {
+			return err
+		}
+		if sum := md5.Sum(got); !bytes.Equal(sum[:], p.Sum) {
+			t.Errorf("part %d: digest doesn't match the file", p.Number)
+		}
+		parts = append(parts, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 3*partSize+5000)
+	for i := range data {
+		data[i] = byte(i % 233)
+	}
+	for p := data; len(p) > 0; {
+		n := min(len(p), 100003)
+		if _, err := pw.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts before Close, want 3", len(parts))
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts, want 4", len(parts))
+	}
+	for i, p := range parts {
+		if p.Number != i+1 || p.Off != int64(i)*partSize {
+			t.Fatalf("part %d: got number %d at %d", i, p.Number, p.Off)
+		}
+	}
+	if last := parts[3]; last.Size != 5000 {
+		t.Fatalf("last part of %d bytes, want 5000", last.Size)
+	}
+}
@@ -0,0 +1,228 @@
+package directio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// Pattern fills buf, which starts at offset off of the target, with
+// deterministic data. Calling it twice with the same arguments must produce
+// the same bytes, so that what was written can be checked afterwards.
+type Pattern func(buf []byte, off int64)
+
+// PatternByte returns a Pattern repeating b, like the 0xaa, 0x55, 0xff and
+// 0x00 passes of badblocks.
+func PatternByte(b byte) Pattern {
+	return func(buf []byte, off int64) {
+		for i := range buf {
+			buf[i] = b
+		}
+	}
+}
+
+// PatternOffset returns a Pattern storing, in every 8 bytes, their own offset
+// xored with seed. Unlike a fixed byte it also catches blocks written or
+// read at the wrong place.
+func PatternOffset(seed uint64) Pattern {
+	return func(buf []byte, off int64) {
+		var word [8]byte
+		for i := 0; i < len(buf); i += 8 {
+			binary.LittleEndian.PutUint64(word[:], uint64(off+int64(i))^seed)
+			copy(buf[i:], word[:])
+		}
+	}
+}
+
+// BadRange is a range of the target that didn't read back what was written.
+type BadRange struct {
+	Offset int64
+	Length int64
+
+	// Err is the read error hit in the range, nil if the data was just wrong.
+	Err error
+}
+
+// PatternOption configures WritePattern, VerifyPattern and CheckPattern.
+type PatternOption func(c *patternConfig)
+
+type patternConfig struct {
+	bufSize  int
+	progress func(done, total int64)
+}
+
+// PatternBufferSize sets the size of the aligned buffer data is written and
+// read through, 1MB by default. It is rounded up to the block size.
+func PatternBufferSize(n int) PatternOption {
+	return func(c *patternConfig) {
+		c.bufSize = n
+	}
+}
+
+// PatternProgress sets a function called after every chunk with the bytes
+// processed so far in the current pass and the size of the target.
+func PatternProgress(fn func(done, total int64)) PatternOption {
+	return func(c *patternConfig) {
+		c.progress = fn
+	}
+}
+
+// patternTarget returns the block size of f and the size to cover, which is
+// size or, if size is zero, the whole file or device, rounded down to the
+// block size.
+func patternTarget(f *os.File, size int64) (int, int64, error) {
+	blockSize, _ := fdAlignment(f.Fd())
+
+	if size <= 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return 0, 0, err
+		}
+		size = info.Size()
+
+		if isBlockDevice(info) {
+			dev, err := queryBlockDevice(f.Fd())
+			if err != nil {
+				return 0, 0, err
+			}
+			blockSize = dev.alignment()
+			size = dev.size
+		}
+	}
+
+	return blockSize, size - size%int64(blockSize), nil
+}
+
+// patternSetup applies opts and allocates the buffers a pass needs.
+func patternSetup(blockSize int, opts []PatternOption) (*patternConfig, []byte, error) {
+	cfg := &patternConfig{bufSize: defaultCopyBufSize}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.bufSize <= 0 {
+		cfg.bufSize = defaultCopyBufSize
+	}
+
+	buf, err := allocAlignedBuf(blockSize, alignUp(cfg.bufSize, blockSize))
+
+	return cfg, buf, err
+}
+
+// WritePattern fills the first size bytes of f, or all of it if size is 0,
+// with p, writing whole aligned blocks at their offset. f must be opened
+// with O_DIRECT for writing. A trailing partial block is left alone. It
+// returns the number of bytes written.
+func WritePattern(f *os.File, size int64, p Pattern, opts ...PatternOption) (int64, error) {
+	blockSize, size, err := patternTarget(f, size)
+	if err != nil {
+		return 0, err
+	}
+
+	cfg, buf, err := patternSetup(blockSize, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var off int64
+	for off < size {
+		chunk := buf
+		if rest := size - off; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+
+		p(chunk, off)
+		if _, err := f.WriteAt(chunk, off); err != nil {
+			return off, err
+		}
+		off += int64(len(chunk))
+
+		if cfg.progress != nil {
+			cfg.progress(off, size)
+		}
+	}
+
+	return off, nil
+}
+
+// VerifyPattern reads back the first size bytes of f, or all of it if size
+// is 0, and compares them block by block with p. f must be opened with
+// O_DIRECT for reading. Mismatching blocks and chunks that failed to read
+// are returned as merged ranges; a read error doesn't stop the scan.
+func VerifyPattern(f *os.File, size int64, p Pattern, opts ...PatternOption) ([]BadRange, error) {
+	blockSize, size, err := patternTarget(f, size)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, buf, err := patternSetup(blockSize, opts)
+	if err != nil {
+		return nil, err
+	}
+	want := make([]byte, len(buf))
+
+	var bad []BadRange
+	mark := func(off, length int64, err error) {
+		if n := len(bad); n > 0 && err == nil && bad[n-1].Err == nil && bad[n-1].Offset+bad[n-1].Length == off {
+			bad[n-1].Length += length
+			return
+		}
+		bad = append(bad, BadRange{Offset: off, Length: length, Err: err})
+	}
+
+	var off int64
+	for off < size {
+		chunk := buf
+		if rest := size - off; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+
+		n, err := pread(f, chunk, off)
+		if err == nil && n < len(chunk) {
+			err = errors.New("short read")
+		}
+		if err != nil {
+			mark(off, int64(len(chunk)), err)
+		} else {
+			exp := want[:len(chunk)]
+			p(exp, off)
+
+			for i := 0; i < len(chunk); i += blockSize {
+				if !bytes.Equal(chunk[i:i+blockSize], exp[i:i+blockSize]) {
+					mark(off+int64(i), int64(blockSize), nil)
+				}
+			}
+		}
+		off += int64(len(chunk))
+
+		if cfg.progress != nil {
+			cfg.progress(off, size)
+		}
+	}
+
+	return bad, nil
+}
+
+// CheckPattern writes every pattern in turn to f, syncs it and verifies it,
+// like a destructive badblocks run. f must be opened with O_RDWR|O_DIRECT.
+// The bad ranges of all passes are returned together.
+func CheckPattern(f *os.File, size int64, patterns []Pattern, opts ...PatternOption) ([]BadRange, error) {
+	var bad []BadRange
+
+	for _, p := range patterns {
+		if _, err := WritePattern(f, size, p, opts...); err != nil {
+			return bad, err
+		}
+		if err := f.Sync(); err != nil {
+			return bad, err
+		}
+
+		found, err := VerifyPattern(f, size, p, opts...)
+		bad = append(bad, found...)
+		if err != nil {
+			return bad, err
+		}
+	}
+
+	return bad, nil
+}
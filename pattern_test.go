@@ -0,0 +1,96 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPattern(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	path := filepath.Join(dir, "pattern")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|O_DIRECT, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	const size = 1 << 20
+	p := PatternOffset(0x1234)
+
+	bad, err := CheckPattern(f, size, []Pattern{PatternByte(0xAA), p}, PatternBufferSize(64<<10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 0 {
+		t.Fatalf("unexpected bad ranges %v", bad)
+	}
+
+	// Damage two adjacent blocks behind the writer's back.
+	blockSize, _ := fdAlignment(f.Fd())
+	g, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.WriteAt(make([]byte, blockSize+1), int64(3*blockSize))
+	g.Sync()
+	g.Close()
+
+	bad, err = VerifyPattern(f, 0, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BadRange{Offset: int64(3 * blockSize), Length: int64(2 * blockSize)}
+	if len(bad) != 1 || bad[0] != want {
+		t.Fatalf("got bad ranges %v, want %v", bad, want)
+	}
+}
+
+func TestWipe(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	path := filepath.Join(dir, "wipe")
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = 0xFF
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	passes := 0
+	err = Wipe(f, 2, WipeProgress(func(pass int, done, total int64) {
+		passes = pass
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passes != 2 {
+		t.Errorf("progress reported %d passes, want 2", passes)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("file is %d bytes after wipe, want %d", len(got), len(data))
+	}
+	for i, b := range got {
+		if b != 0 {
+			t.Fatalf("byte %d is %#x after wipe", i, b)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package directio
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// pipeDepth is the number of blocks a pipe stages, bounding its memory.
+const pipeDepth = 4
+
+var (
+	_ io.ReadCloser  = (*PipeReader)(nil)
+	_ io.WriterTo    = (*PipeReader)(nil)
+	_ io.WriteCloser = (*PipeWriter)(nil)
+	_ io.ReaderFrom  = (*PipeWriter)(nil)
+)
+
+// pipe is the state shared by the two ends of a Pipe.
+type pipe struct {
+	// full carries the staged blocks to the reader, free takes them back.
+	full chan []byte
+	free chan []byte
+
+	// done is closed by the reader, rerr is then what writes return. werr
+	// is what reads return once full is closed by the writer.
+	done  chan struct{}
+	once  sync.Once
+	rerr  error
+	werr  error
+	wonce sync.Once
+}
+
+// Pipe returns the two ends of a pipe staging its data in aligned blocks of
+// blockSize bytes, a multiple of 512, like io.Pipe but with a bounded
+// buffer of a few blocks between the ends, so a producer and a consumer on
+// different goroutines don't wait on each other for every write. The blocks
+// are aligned to the fallback alignment in memory: PipeReader.WriteTo hands
+// them as is to a DirectIO, which writes them without copying when they are
+// at least its buffer size, and
+// PipeWriter.ReadFrom reads into them, so r can be a file opened with
+// O_DIRECT and read directly. A write waits while all blocks are full, a
+// read while they are all empty.
+func Pipe(blockSize int) (*PipeReader, *PipeWriter, error) {
+	if blockSize <= 0 || blockSize%512 != 0 {
+		return nil, nil, errors.New("block size must be a multiple of 512")
+	}
+
+	p := &pipe{
+		full: make(chan []byte, pipeDepth),
+		free: make(chan []byte, pipeDepth),
+		done: make(chan struct{}),
+	}
+	for i := 0; i < pipeDepth; i++ {
+		buf, err := allocAlignedBuf(config().FallbackAlignment, blockSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.free <- buf
+	}
+
+	return &PipeReader{p: p}, &PipeWriter{p: p}, nil
+}
+
+// PipeReader is the read end of a Pipe.
+type PipeReader struct {
+	p *pipe
+
+	// cur is the block being read, off how much of it was.
+	cur []byte
+	off int
+}
+
+// next makes the next staged block current, giving back the previous one.
+func (r *PipeReader) next() error {
+	if r.cur != nil {
+		r.p.free <- r.cur[:cap(r.cur)]
+		r.cur = nil
+	}
+
+	buf, ok := <-r.p.full
+	if !ok {
+		return r.p.werr
+	}
+	r.cur, r.off = buf, 0
+
+	return nil
+}
+
+// Read reads data from the pipe, waiting for the writer if nothing is
+// staged. It returns io.EOF once the writer closed the pipe and everything
+// was read, or the error of CloseWithError.
+func (r *PipeReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for r.cur == nil || r.off == len(r.cur) {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.cur[r.off:])
+	r.off += n
+
+	return n, nil
+}
+
+// WriteTo writes the data of the pipe to w until the writer closes it,
+// passing the staged blocks themselves to w, without copying them.
+func (r *PipeReader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		if r.cur != nil && r.off < len(r.cur) {
+			n, err := w.Write(r.cur[r.off:])
+			r.off += n
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+
+		if err := r.next(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return written, err
+		}
+	}
+}
+
+// Close closes the pipe, making writes fail with io.ErrClosedPipe.
+func (r *PipeReader) Close() error {
+	return r.CloseWithError(nil)
+}
+
+// CloseWithError closes the pipe, making writes fail with err, or
+// io.ErrClosedPipe if nil.
+func (r *PipeReader) CloseWithError(err error) error {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	r.p.once.Do(func() {
+		r.p.rerr = err
+		close(r.p.done)
+	})
+
+	return nil
+}
+
+// PipeWriter is the write end of a Pipe.
+type PipeWriter struct {
+	p *pipe
+
+	// cur is the block being filled, n how much of it is.
+	cur []byte
+	n   int
+
+	isClosed bool
+}
+
+// block returns the block to fill, waiting for the reader to give one back.
+func (w *PipeWriter) block() ([]byte, error) {
+	if w.isClosed {
+		return nil, io.ErrClosedPipe
+	}
+
+	if w.cur == nil {
+		select {
+		case w.cur = <-w.p.free:
+			w.n = 0
+		case <-w.p.done:
+			return nil, w.p.rerr
+		}
+	}
+
+	return w.cur, nil
+}
+
+// stage hands the current block, full or not, over to the reader.
+func (w *PipeWriter) stage() error {
+	if w.cur == nil || w.n == 0 {
+		return nil
+	}
+
+	select {
+	case w.p.full <- w.cur[:w.n]:
+		w.cur = nil
+		return nil
+	case <-w.p.done:
+		return w.p.rerr
+	}
+}
+
+// Write writes p to the pipe, staging it in blocks. It returns once p is
+// staged, waiting for the reader to free blocks if they are all full. Data
+// is handed over block by block; Flush hands over a partial one.
+func (w *PipeWriter) Write(p []byte) (int, error) {
+	var nn int
+	for len(p) > 0 {
+		buf, err := w.block()
+		if err != nil {
+			return nn, err
+		}
+
+		n := copy(buf[w.n:], p)
+		w.n += n
+		nn += n
+		p = p[n:]
+
+		if w.n == len(buf) {
+			if err := w.stage(); err != nil {
+				return nn, err
+			}
+		}
+	}
+
+	return nn, nil
+}
+
+// ReadFrom reads r until io.EOF straight into the blocks of the pipe.
+func (w *PipeWriter) ReadFrom(r io.Reader) (int64, error) {
+	var nn int64
+	for {
+		buf, err := w.block()
+		if err != nil {
+			return nn, err
+		}
+
+		n, rerr := r.Read(buf[w.n:])
+		w.n += n
+		nn += int64(n)
+
+		if w.n == len(buf) {
+			if err := w.stage(); err != nil {
+				return nn, err
+			}
+		}
+		if rerr == io.EOF {
+			return nn, nil
+		}
+		if rerr != nil {
+			return nn, rerr
+		}
+	}
+}
+
+// Flush hands the partially filled block over to the reader.
+func (w *PipeWriter) Flush() error {
+	if w.isClosed {
+		return io.ErrClosedPipe
+	}
+
+	return w.stage()
+}
+
+// Close hands the rest of the data over and closes the pipe: reads return
+// io.EOF once everything was read.
+func (w *PipeWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError is Close, reads then returning err, or io.EOF if nil. The
+// data staged is still read first.
+func (w *PipeWriter) CloseWithError(err error) error {
+	if w.isClosed {
+		return nil
+	}
+
+	serr := w.stage()
+	w.isClosed = true
+	if err == nil {
+		err = io.EOF
+	}
+	w.p.wonce.Do(func() {
+		w.p.werr = err
+		close(w.p.full)
+	})
+
+	return serr
+}
@@ -0,0 +1,99 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	if _, _, err := Pipe(1000); err == nil {
+		t.Fatal("unaligned block size accepted")
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "pipe")
+	defer f.Close()
+
+	const blockSize = 1 << 16
+	pr, pw, err := Pipe(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 10*blockSize+777)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+	go func() {
+		for p := data; len(p) > 0; {
+			n := min(len(p), 12345)
+			if _, err := pw.Write(p[:n]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			p = p[n:]
+		}
+		pw.Close()
+	}()
+
+	d, err := NewSize(f, blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := pr.WriteTo(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("wrote %d bytes, want %d", n, len(data))
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("file content differs from the data written")
+	}
+
+	// The other way around, read from a file into the pipe.
+	in, want := readerFile(t, dir, 5*blockSize+100)
+	defer in.Close()
+
+	pr, pw, err = Pipe(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, err := pw.ReadFrom(in)
+		pw.CloseWithError(err)
+	}()
+	got, err = io.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("data read differs from the file")
+	}
+
+	// Writes fail once the reader is gone.
+	pr, pw, err = Pipe(blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.Close()
+	if _, err := pw.Write(make([]byte, pipeDepth*blockSize+1)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("write after the reader closed: %v", err)
+	}
+}
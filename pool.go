@@ -0,0 +1,107 @@
+package directio
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// maxIdleWriters bounds the writers a WriterPool keeps for reuse.
+const maxIdleWriters = 64
+
+// WriterPool hands out writers with buffers of the same size, reusing the
+// writers put back and their aligned buffers, for services writing many
+// short-lived files. Unlike a sync.Pool it releases the writers it drops,
+// which matters for those of WithBufferAdvice, whose buffers the garbage
+// collector doesn't free. It is safe for concurrent use.
+type WriterPool struct {
+	size int
+	opts []Option
+
+	mu       sync.Mutex
+	idle     []*DirectIO
+	isClosed bool
+}
+
+// NewWriterPool returns a pool of writers with a buffer of size bytes and
+// the options opts, see NewSize.
+func NewWriterPool(size int, opts ...Option) *WriterPool {
+	return &WriterPool{size: size, opts: opts}
+}
+
+// Get returns a writer for f, which must be opened with O_DIRECT. It is
+// either an idle writer of the pool, Reset onto f, or a new one.
+func (p *WriterPool) Get(f *os.File) (*DirectIO, error) {
+	for {
+		p.mu.Lock()
+		if p.isClosed {
+			p.mu.Unlock()
+			return nil, errors.New("the pool is closed")
+		}
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			return NewSize(f, p.size, p.opts...)
+		}
+		w := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if err := w.Reset(f); err == nil {
+			return w, nil
+		}
+		// f doesn't suit the writer, the next one or a new one may do.
+		w.Close()
+	}
+}
+
+// Put gives w back to the pool, finishing it with Finish first if it is
+// still open, and returns the error of Finish. Writers the pool can't reuse,
+// closed ones, those whose buffer changed size or failed to finish, and
+// those past what the pool keeps, are closed. w must not be used afterwards.
+func (p *WriterPool) Put(w *DirectIO) error {
+	w.lock()
+	finished, released := w.isClosed, w.released
+	reusable := len(w.buf) == bufSize(p.size, w.blockSize)
+	w.unlock()
+
+	if released {
+		return nil
+	}
+
+	var err error
+	if !finished {
+		_, err = w.Finish()
+	}
+
+	p.mu.Lock()
+	keep := err == nil && reusable && !p.isClosed && len(p.idle) < maxIdleWriters
+	if keep {
+		p.idle = append(p.idle, w)
+	}
+	p.mu.Unlock()
+
+	if !keep {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Close closes the idle writers of the pool. Writers handed out and put
+// back afterwards are closed by Put.
+func (p *WriterPool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.isClosed = true
+	p.mu.Unlock()
+
+	var errs []error
+	for _, w := range idle {
+		errs = append(errs, w.Close())
+	}
+
+	return errors.Join(errs...)
+}
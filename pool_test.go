@@ -0,0 +1,55 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestWriterPool(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	pool := NewWriterPool(1 << 16)
+
+	var first *DirectIO
+	for i := 0; i < 3; i++ {
+		f := tmpFile(t, dir, fmt.Sprintf("pool-%d", i))
+		defer f.Close()
+
+		w, err := pool.Get(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = w
+		} else if w != first {
+			t.Fatal("pool didn't reuse the writer put back")
+		}
+
+		if _, err := fmt.Fprintf(w, "file %d", i); err != nil {
+			t.Fatal(err)
+		}
+		if err := pool.Put(w); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("file %d", i); string(got) != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Get(nil); err == nil {
+		t.Fatal("Get on a closed pool didn't fail")
+	}
+}
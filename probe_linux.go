@@ -0,0 +1,169 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// probeSizes are the alignments ProbeAlignment tries, smallest first.
+var probeSizes = []int{512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+
+// ProbeAlignment discovers the offset and length alignment O_DIRECT really
+// requires for files next to f, for filesystems that report nothing useful
+// through statx or statfs.
+//
+// Like SQLite and PostgreSQL, it does trial writes of increasing size at an
+// offset of the same size, and returns the first size the kernel accepts.
+// The writes go to an O_TMPFILE in the directory of f, or to a temporary
+// file which is removed afterwards, so f itself is never touched. For block
+// devices the logical sector size is returned without writing anything.
+func ProbeAlignment(f *os.File) (int, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if isBlockDevice(info) {
+		dev, err := queryBlockDevice(f.Fd())
+		if err != nil {
+			return 0, err
+		}
+		return dev.logical, nil
+	}
+
+	// The name of an O_TMPFILE is its directory.
+	dir := f.Name()
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	scratch, err := openProbeFile(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer scratch.Close()
+
+	buf, err := allocAlignedBuf(probeSizes[len(probeSizes)-1], probeSizes[len(probeSizes)-1])
+	if err != nil {
+		return 0, err
+	}
+
+	for _, size := range probeSizes {
+		// An offset of size is aligned to size but not to twice size.
+		_, err := unix.Pwrite(int(scratch.Fd()), buf[:size], int64(size))
+		if err == nil {
+			return size, nil
+		}
+		if !errors.Is(err, unix.EINVAL) {
+			return 0, err
+		}
+	}
+
+	return 0, ErrFSNoDIOSupport
+}
+
+// openProbeFile opens an anonymous scratch file with O_DIRECT in dir.
+func openProbeFile(dir string) (*os.File, error) {
+	f, err := os.OpenFile(dir, os.O_RDWR|O_DIRECT|unix.O_TMPFILE, 0600)
+	if err == nil {
+		return f, nil
+	}
+
+	// No O_TMPFILE support: use a named file and unlink it right away.
+	tmp, err := os.CreateTemp(dir, ".directio-probe-")
+	if err != nil {
+		return nil, err
+	}
+	name := tmp.Name()
+	tmp.Close()
+	defer os.Remove(name)
+
+	return os.OpenFile(name, os.O_RDWR|O_DIRECT, 0600)
+}
+
+// Capabilities describes what O_DIRECT can do for a file, as found by
+// ProbeCapabilities. Alignments and sizes are 0 when unknown.
+type Capabilities struct {
+	// Support is the verdict of SupportsDirectIO for the path.
+	Support Support
+
+	// Open reports whether a file could be opened with O_DIRECT.
+	Open bool
+
+	// MemAlign and OffsetAlign are the statx DIOALIGN alignments of buffers
+	// and of file offsets and lengths.
+	MemAlign    int
+	OffsetAlign int
+
+	// AtomicWriteMin and AtomicWriteMax bound the sizes of untorn writes
+	// (STATX_WRITE_ATOMIC, Linux 6.11 and later).
+	AtomicWriteMin int
+	AtomicWriteMax int
+
+	// ProbedAlign is the alignment found by trial writes, when requested.
+	ProbedAlign int
+}
+
+// ProbeCapabilities answers whether O_DIRECT actually works at path, and
+// with which constraints. path may be an existing file or block device, or
+// a directory, or a file that doesn't exist yet. In the last two cases an
+// anonymous file is created in the directory for the checks.
+//
+// If trialWrite is set, ProbeAlignment is run too. It writes to a scratch
+// file, never to path.
+func ProbeCapabilities(path string, trialWrite bool) (Capabilities, error) {
+	var c Capabilities
+
+	s, err := SupportsDirectIO(path)
+	if err != nil {
+		return c, err
+	}
+	c.Support = s
+
+	var f *os.File
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && (info.Mode().IsRegular() || isBlockDevice(info)):
+		f, err = os.OpenFile(path, os.O_RDONLY|O_DIRECT, 0)
+	case err == nil && info.IsDir():
+		f, err = openProbeFile(path)
+	default:
+		f, err = openProbeFile(filepath.Dir(path))
+	}
+	if err != nil {
+		if errors.Is(err, unix.EINVAL) {
+			// O_DIRECT was refused, nothing more to learn.
+			return c, nil
+		}
+		return c, err
+	}
+	defer f.Close()
+	c.Open = true
+
+	var stx unix.Statx_t
+	mask := unix.STATX_DIOALIGN | unix.STATX_WRITE_ATOMIC
+	if err := unix.Statx(int(f.Fd()), "", unix.AT_EMPTY_PATH|unix.AT_STATX_SYNC_AS_STAT, mask, &stx); err == nil {
+		if stx.Mask&unix.STATX_DIOALIGN != 0 {
+			c.MemAlign = int(stx.Dio_mem_align)
+			c.OffsetAlign = int(stx.Dio_offset_align)
+		}
+		if stx.Mask&unix.STATX_WRITE_ATOMIC != 0 {
+			c.AtomicWriteMin = int(stx.Atomic_write_unit_min)
+			c.AtomicWriteMax = int(stx.Atomic_write_unit_max)
+		}
+	}
+
+	if trialWrite {
+		if c.ProbedAlign, err = ProbeAlignment(f); err != nil {
+			return c, err
+		}
+	}
+
+	return c, nil
+}
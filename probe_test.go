@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import "testing"
+
+func TestProbeAlignment(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "probe")
+	defer f.Close()
+
+	a, err := ProbeAlignment(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logical, _, err := SectorSizes(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a > logical {
+		t.Fatalf("ProbeAlignment = %d, above the logical sector size %d", a, logical)
+	}
+}
+
+func TestSupportsDirectIO(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "support")
+	f.Close()
+
+	s, err := SupportsDirectIO(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Level == SupportNone {
+		t.Fatalf("SupportsDirectIO(%s) = %+v, but the file was opened with O_DIRECT", f.Name(), s)
+	}
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	c, err := ProbeCapabilities(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Open || c.ProbedAlign == 0 {
+		t.Fatalf("ProbeCapabilities(%s) = %+v", dir, c)
+	}
+	if c.OffsetAlign != 0 && c.ProbedAlign > c.OffsetAlign {
+		t.Fatalf("probed alignment %d is above the statx offset alignment %d", c.ProbedAlign, c.OffsetAlign)
+	}
+}
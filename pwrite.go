@@ -0,0 +1,49 @@
+package directio
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrUnalignedBuffer is returned by PWriteAligned for a buffer whose address
+// or length doesn't meet the direct I/O alignment of the file.
+var ErrUnalignedBuffer = errors.New("buffer is not aligned for direct I/O")
+
+// PWriteAligned writes all of p to f, opened with O_DIRECT, at off with
+// pwrite(2), without any buffering. It is meant for callers managing their
+// own aligned pages: the address and length of p must meet the alignment of
+// the file, or ErrUnalignedBuffer is returned, and so must off, or
+// ErrUnalignedOffset is. Nothing is written then.
+func PWriteAligned(f *os.File, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativePosition
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	a := cachedFdAlignment(f.Fd())
+	unit := int64(a.unit())
+
+	if int64(len(p))%unit != 0 || align(p, a.blockSize) != 0 {
+		return 0, ErrUnalignedBuffer
+	}
+	if off%unit != 0 {
+		return 0, ErrUnalignedOffset
+	}
+
+	var n int
+	for n < len(p) {
+		m, err := pwrite(f, p[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,45 @@
+package directio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is matched by the *QuotaError a writer created with
+// WithMaxSize returns once its budget is used up.
+var ErrQuotaExceeded = errors.New("write quota exceeded")
+
+// QuotaError is returned when a write would take a writer past the budget
+// of WithMaxSize. errors.Is(err, ErrQuotaExceeded) reports true for it.
+type QuotaError struct {
+	// Max is the budget of the writer.
+	Max int64
+
+	// Accepted is the number of bytes the writer took in, Flushed the number
+	// of bytes it had written to the file when the error was returned.
+	Accepted int64
+	Flushed  int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("write quota of %d bytes exceeded (%d accepted, %d flushed)", e.Max, e.Accepted, e.Flushed)
+}
+
+func (e *QuotaError) Is(target error) bool { return target == ErrQuotaExceeded }
+
+// quota returns how many more bytes the writer may accept, or -1 if there
+// is no budget.
+func (d *DirectIO) quota() int64 {
+	if d.maxSize <= 0 {
+		return -1
+	}
+	if d.written >= d.maxSize {
+		return 0
+	}
+
+	return d.maxSize - d.written
+}
+
+func (d *DirectIO) quotaError() error {
+	return &QuotaError{Max: d.maxSize, Accepted: d.written, Flushed: d.flushed}
+}
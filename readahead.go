@@ -0,0 +1,157 @@
+package directio
+
+import "io"
+
+// ReaderOption configures a DirectReader.
+type ReaderOption func(d *DirectReader)
+
+// ReadAhead makes the reader prefetch the next n buffers of the file in the
+// background while the current one is consumed, so that a sequential scan
+// of cold data keeps the device busy instead of waiting on every read. It
+// costs n extra buffers. Close must be called to stop the prefetching.
+func ReadAhead(n int) ReaderOption {
+	return func(d *DirectReader) {
+		if n > 0 {
+			d.ahead = n
+		}
+	}
+}
+
+// readahead is the prefetching state of a DirectReader.
+type readahead struct {
+	chunks chan aheadChunk
+	free   chan []byte
+	stop   chan struct{}
+	done   chan struct{}
+
+	// cur is the chunk being consumed, pos how much of it was.
+	cur aheadChunk
+	pos int
+}
+
+// aheadChunk is a buffer read at off by the prefetcher.
+type aheadChunk struct {
+	buf []byte
+	off int64
+	n   int
+	err error
+}
+
+// startAhead starts prefetching from the offset the next fill reads at.
+func (d *DirectReader) startAhead() error {
+	ra := d.ra
+	if ra == nil {
+		ra = &readahead{free: make(chan []byte, d.ahead)}
+		for i := 0; i < d.ahead; i++ {
+			buf, err := allocAlignedBuf(d.blockSize, len(d.buf))
+			if err != nil {
+				return err
+			}
+			ra.free <- buf
+		}
+		d.ra = ra
+	}
+
+	ra.chunks = make(chan aheadChunk, d.ahead)
+	ra.stop = make(chan struct{})
+	ra.done = make(chan struct{})
+	ra.cur, ra.pos = aheadChunk{}, 0
+
+	go d.prefetch(ra, d.base+int64(d.w))
+
+	return nil
+}
+
+// prefetch reads the file from off into free buffers and queues them, until
+// an error or the end of the file, or until stopped.
+func (d *DirectReader) prefetch(ra *readahead, off int64) {
+	defer close(ra.done)
+
+	for {
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.stop:
+			return
+		}
+
+		n, err := pread(d.f, buf, off)
+		if err == nil && n < len(buf) {
+			err = io.EOF
+		}
+
+		select {
+		case ra.chunks <- aheadChunk{buf: buf, off: off, n: n, err: err}:
+		case <-ra.stop:
+			ra.free <- buf
+			return
+		}
+
+		if err != nil {
+			return
+		}
+		off += int64(n)
+	}
+}
+
+// stopAhead stops the prefetcher and takes back its buffers.
+func (d *DirectReader) stopAhead() {
+	ra := d.ra
+	if ra == nil || ra.stop == nil {
+		return
+	}
+
+	close(ra.stop)
+	<-ra.done
+
+	for len(ra.chunks) > 0 {
+		ra.free <- (<-ra.chunks).buf
+	}
+	if ra.cur.buf != nil {
+		ra.free <- ra.cur.buf
+	}
+	ra.cur = aheadChunk{}
+	ra.stop = nil
+}
+
+// fillAhead moves prefetched data into the buffer. When the buffer is empty
+// and a whole chunk is ready, the two are swapped instead of copied.
+func (d *DirectReader) fillAhead() {
+	ra := d.ra
+	if ra == nil || ra.stop == nil {
+		if d.err = d.startAhead(); d.err != nil {
+			return
+		}
+		ra = d.ra
+	}
+
+	if ra.cur.buf == nil {
+		ra.cur, ra.pos = <-ra.chunks, 0
+	}
+	c := &ra.cur
+
+	if d.w == 0 && ra.pos == 0 {
+		d.buf, c.buf = c.buf, d.buf
+		d.w = c.n
+		ra.pos = c.n
+	} else {
+		n := copy(d.buf[d.w:], c.buf[ra.pos:c.n])
+		d.w += n
+		ra.pos += n
+	}
+
+	if ra.pos == c.n {
+		if c.err != nil {
+			d.err = c.err
+		}
+		ra.free <- c.buf
+		ra.cur = aheadChunk{}
+	}
+}
+
+// Close stops the prefetching of ReadAhead. It doesn't close the file.
+func (d *DirectReader) Close() error {
+	d.stopAhead()
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package directio
+
+import (
+	"io"
+	"os"
+)
+
+// ReadFullAt reads len(p) bytes of f, opened with O_DIRECT, at off into p.
+// Neither off, len(p) nor p itself need to be aligned: the covering aligned
+// range is read into an aligned buffer and the requested part copied out.
+// When they all happen to be aligned, f is read into p directly. Like
+// io.ReaderAt, it returns io.EOF when the file ends before p is full.
+func ReadFullAt(f *os.File, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	a := cachedFdAlignment(f.Fd())
+	unit := int64(a.unit())
+
+	if off%unit == 0 && int64(len(p))%unit == 0 && align(p, a.blockSize) == 0 {
+		return readFullAligned(f, p, off)
+	}
+
+	start := off - off%unit
+	end := off + int64(len(p))
+	if rem := end % unit; rem != 0 {
+		end += unit - rem
+	}
+
+	size := int64(alignUp(defaultCopyBufSize, a.blockSize))
+	if end-start < size {
+		size = end - start
+	}
+	buf, err := allocAlignedBuf(a.blockSize, int(size))
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for pos := start; pos < end; {
+		chunk := buf
+		if rest := end - pos; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+
+		m, err := pread(f, chunk, pos)
+		if err != nil {
+			return n, err
+		}
+
+		// Copy out the part of the chunk that is within the request.
+		head := int64(0)
+		if pos < off {
+			head = off - pos
+		}
+		if int64(m) > head {
+			n += copy(p[n:], chunk[head:m])
+		}
+
+		if m < len(chunk) {
+			break
+		}
+		pos += int64(m)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// readFullAligned reads into the aligned p at the aligned off.
+func readFullAligned(f *os.File, p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		m, err := pread(f, p[n:], off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.EOF
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,290 @@
+package directio
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+)
+
+var (
+	_ io.ReadSeeker = (*DirectReader)(nil)
+	_ io.ByteReader = (*DirectReader)(nil)
+)
+
+var errNegativePosition = errors.New("negative position")
+
+// DirectReader reads a file opened with O_DIRECT through an aligned buffer.
+// The file is always read in whole blocks at block aligned offsets, whatever
+// the sizes the caller asks for, so it gets the page cache bypass of O_DIRECT
+// with the convenience of bufio.Reader.
+type DirectReader struct {
+	f         *os.File
+	buf       []byte
+	blockSize int
+	offAlign  int
+
+	// buf[r:w] is the buffered data, base the file offset of buf[0]. base
+	// and w are kept multiples of the offset alignment, except when the end
+	// of the file is in the buffer. skip is the head of the next read to
+	// hide, when positioned in the middle of an aligned unit.
+	r, w int
+	base int64
+	skip int
+	err  error
+
+	ahead int
+	ra    *readahead
+}
+
+// NewReader returns a new DirectReader reading f from its current offset.
+func NewReader(f *os.File, opts ...ReaderOption) (*DirectReader, error) {
+	return NewReaderSize(f, 0, opts...)
+}
+
+// NewReaderSize returns a new DirectReader reading f from its current offset
+// with a buffer of at least size bytes, rounded up to the block size. f is
+// advised to be read sequentially and once, see Advise.
+func NewReaderSize(f *os.File, size int, opts ...ReaderOption) (*DirectReader, error) {
+	if size <= 0 {
+		size = config().BufferSize
+	}
+
+	a := cachedFdAlignment(f.Fd())
+	buf, err := allocAlignedBuf(a.blockSize, alignUp(size, a.blockSize))
+	if err != nil {
+		return nil, err
+	}
+
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DirectReader{
+		f:         f,
+		buf:       buf,
+		blockSize: a.blockSize,
+		offAlign:  a.unit(),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.reset(off)
+
+	// Best effort, for whatever reads f through the page cache alongside.
+	Advise(f, 0, 0, AdviceSequential)
+	Advise(f, 0, 0, AdviceNoReuse)
+
+	return d, nil
+}
+
+// BlockSize returns the block size the file is read with.
+func (d *DirectReader) BlockSize() int { return d.blockSize }
+
+// Buffered returns the number of bytes that can be read from the buffer
+// without reading the file.
+func (d *DirectReader) Buffered() int { return d.w - d.r }
+
+// reset empties the buffer and positions the reader at off. The next read
+// starts at the aligned offset below off and hides the bytes up to it.
+func (d *DirectReader) reset(off int64) {
+	d.stopAhead()
+
+	rem := int(off % int64(d.offAlign))
+
+	d.base = off - int64(rem)
+	d.r, d.w = 0, 0
+	d.skip = rem
+	d.err = nil
+}
+
+// Seek sets the offset of the next Read to offset, interpreted according to
+// whence like io.Seeker. offset doesn't need to be aligned: the reader reads
+// from the aligned offset below and hides the difference. Seeking within the
+// buffered data doesn't read the file again. The offset of the file itself
+// isn't changed, except by io.SeekEnd.
+func (d *DirectReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = d.base + int64(d.r) + int64(d.skip) + offset
+	case io.SeekEnd:
+		end, err := d.f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		abs = end + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errNegativePosition
+	}
+
+	if d.skip == 0 && abs >= d.base && abs <= d.base+int64(d.w) {
+		d.r = int(abs - d.base)
+		return abs, nil
+	}
+
+	d.reset(abs)
+
+	return abs, nil
+}
+
+// fill reads more of the file into the buffer. The aligned units already
+// consumed are dropped first to make room, so the read stays aligned.
+func (d *DirectReader) fill() {
+	if drop := d.r - d.r%d.offAlign; drop > 0 {
+		copy(d.buf, d.buf[drop:d.w])
+		d.base += int64(drop)
+		d.r -= drop
+		d.w -= drop
+	}
+
+	if d.w == len(d.buf) {
+		return
+	}
+
+	if d.ahead > 0 {
+		d.fillAhead()
+	} else {
+		n, err := pread(d.f, d.buf[d.w:], d.base+int64(d.w))
+		d.w += n
+
+		switch {
+		case err != nil:
+			d.err = err
+		case n < len(d.buf)-(d.w-n):
+			// A short read means the end of the file was reached.
+			d.err = io.EOF
+		}
+	}
+
+	if d.skip > 0 {
+		d.r = min(d.skip, d.w)
+		d.skip = 0
+	}
+}
+
+// Read reads data into p. It returns the number of bytes read, which may be
+// less than len(p). The file is only read when the buffer is empty, so small
+// reads are served from memory. Read never returns 0 and a nil error for a
+// non-empty p, as bufio.Scanner and bufio.Reader require.
+func (d *DirectReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for d.r == d.w {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.fill()
+	}
+
+	n := copy(p, d.buf[d.r:d.w])
+	d.r += n
+
+	return n, nil
+}
+
+// ReadByte reads and returns a single byte.
+func (d *DirectReader) ReadByte() (byte, error) {
+	for d.r == d.w {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.fill()
+	}
+
+	c := d.buf[d.r]
+	d.r++
+
+	return c, nil
+}
+
+// Peek returns the next n bytes without advancing the reader. The bytes stop
+// being valid at the next read call. If Peek returns fewer than n bytes, it
+// also returns an error explaining why; bufio.ErrBufferFull if n is larger
+// than what the buffer can hold. As the buffer starts at an aligned offset,
+// that is the buffer size less the position of the reader past it.
+func (d *DirectReader) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, bufio.ErrNegativeCount
+	}
+
+	var err error
+	if max := len(d.buf) - (d.r+d.skip)%d.offAlign; n > max {
+		n, err = max, bufio.ErrBufferFull
+	}
+
+	for d.w-d.r < n && d.err == nil {
+		d.fill()
+	}
+
+	if avail := d.w - d.r; avail < n {
+		n = avail
+		if err == nil {
+			err = d.err
+		}
+	}
+
+	return d.buf[d.r : d.r+n], err
+}
+
+// NextBlock returns the data up to the next block boundary of the file,
+// which is a whole block once the reader is at an aligned offset, and
+// advances the reader past it, so that blocks can be processed one by one,
+// e.g. checksummed, without being copied. The last block of the file may be
+// short. The slice references the buffer of the reader and stops being
+// valid at the next read call. At the end of the file it returns io.EOF.
+func (d *DirectReader) NextBlock() ([]byte, error) {
+	pos := d.base + int64(d.r) + int64(d.skip)
+	want := d.blockSize - int(pos%int64(d.blockSize))
+
+	for d.w-d.r < want && d.err == nil {
+		avail := d.w - d.r
+		d.fill()
+		if d.w-d.r == avail && d.err == nil {
+			// The buffer can't hold more, whatever it has will do.
+			break
+		}
+	}
+
+	n := min(want, d.w-d.r)
+	if n == 0 {
+		return nil, d.err
+	}
+	b := d.buf[d.r : d.r+n]
+	d.r += n
+
+	return b, nil
+}
+
+// Discard skips the next n bytes and returns the number of bytes discarded.
+// If Discard skips fewer than n bytes, it also returns an error.
+func (d *DirectReader) Discard(n int) (discarded int, err error) {
+	if n < 0 {
+		return 0, bufio.ErrNegativeCount
+	}
+
+	for {
+		skip := d.w - d.r
+		if skip > n-discarded {
+			skip = n - discarded
+		}
+		d.r += skip
+		discarded += skip
+
+		if discarded == n {
+			return n, nil
+		}
+		if d.err != nil {
+			return discarded, d.err
+		}
+		d.fill()
+	}
+}
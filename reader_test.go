@@ -0,0 +1,344 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readerFile creates a file of size bytes whose content is its offset
+// modulo 251, and opens it with O_DIRECT.
+func readerFile(t *testing.T, dir string, size int) (*os.File, []byte) {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	path := filepath.Join(dir, "reader")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f, data
+}
+
+func TestReaderPeekDiscard(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 50000)
+	defer f.Close()
+
+	r, err := NewReaderSize(f, 16384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	buf := make([]byte, 1000)
+
+	// Peek across buffer refills, then consume what was peeked.
+	for len(got) < 20000 {
+		p, err := r.Peek(7000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, data[len(got):len(got)+7000]) {
+			t.Fatalf("wrong bytes peeked at %d", len(got))
+		}
+
+		n, _ := r.Read(buf)
+		got = append(got, buf[:n]...)
+	}
+
+	if _, err := r.Peek(20000); err != bufio.ErrBufferFull {
+		t.Errorf("oversized peek returned %v, want ErrBufferFull", err)
+	}
+
+	if n, err := r.Discard(10001); n != 10001 || err != nil {
+		t.Fatalf("discard returned %d, %v", n, err)
+	}
+	got = append(got, data[len(got):len(got)+10001]...)
+
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, rest...)
+	if !bytes.Equal(got, data) {
+		t.Fatal("wrong bytes were read")
+	}
+
+	if n, err := r.Discard(1); n != 0 || err != io.EOF {
+		t.Errorf("discard at the end returned %d, %v", n, err)
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 100000)
+	defer f.Close()
+
+	if _, err := f.Seek(1234, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReaderSize(f, 16384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 777)
+	check := func(want int64) {
+		t.Helper()
+		n, err := io.ReadFull(r, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], data[want:want+int64(n)]) {
+			t.Fatalf("wrong bytes read at %d", want)
+		}
+	}
+
+	check(1234)
+
+	for _, tc := range []struct {
+		off    int64
+		whence int
+		want   int64
+	}{
+		{5000, io.SeekStart, 5000},
+		{-100, io.SeekCurrent, 5677},
+		{54321, io.SeekStart, 54321},
+		{-4097, io.SeekEnd, 100000 - 4097},
+		{3, io.SeekStart, 3},
+	} {
+		pos, err := r.Seek(tc.off, tc.whence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pos != tc.want {
+			t.Fatalf("seek(%d, %d) returned %d, want %d", tc.off, tc.whence, pos, tc.want)
+		}
+		check(tc.want)
+	}
+
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seek to a negative offset succeeded")
+	}
+
+	r.Seek(99990, io.SeekStart)
+	if rest, err := io.ReadAll(r); err != nil || !bytes.Equal(rest, data[99990:]) {
+		t.Errorf("read at the end returned %d bytes, %v", len(rest), err)
+	}
+}
+
+func TestReaderReadAhead(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 300000)
+	defer f.Close()
+
+	r, err := NewReaderSize(f, 16384, ReadAhead(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var got []byte
+	buf := make([]byte, 5000)
+	for len(got) < 100000 {
+		if _, err := r.Peek(10000); err != nil {
+			t.Fatal(err)
+		}
+		n, err := r.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if !bytes.Equal(got, data[:len(got)]) {
+		t.Fatal("wrong bytes were read ahead")
+	}
+
+	if _, err := r.Seek(150001, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, data[150001:]) {
+		t.Fatal("wrong bytes were read ahead after a seek")
+	}
+}
+
+func TestReaderNextBlock(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 50000)
+	defer f.Close()
+
+	for _, opts := range [][]ReaderOption{nil, {ReadAhead(2)}} {
+		r, err := NewReader(f, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Start off a block boundary: the first block is partial.
+		if _, err := r.Seek(1000, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []byte
+		for {
+			b, err := r.NextBlock()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			end := len(got) + 1000 + len(b)
+			if end%r.BlockSize() != 0 && end != len(data) {
+				t.Fatalf("block of %d bytes ends at %d, off a block boundary", len(b), end)
+			}
+			got = append(got, b...)
+		}
+		if !bytes.Equal(got, data[1000:]) {
+			t.Fatalf("got %d bytes, want %d", len(got), len(data)-1000)
+		}
+		r.Close()
+	}
+}
+
+func TestReadFullAt(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 3<<20+5)
+	defer f.Close()
+
+	for _, tc := range []struct {
+		off    int64
+		length int
+	}{
+		{0, 4096},
+		{1, 10},
+		{4095, 2},
+		{12345, 2 << 20},
+		{3<<20 - 100, 100},
+	} {
+		p := make([]byte, tc.length)
+		n, err := ReadFullAt(f, p, tc.off)
+		if err != nil || n != tc.length {
+			t.Fatalf("ReadFullAt(%d, %d) returned %d, %v", tc.off, tc.length, n, err)
+		}
+		if !bytes.Equal(p, data[tc.off:tc.off+int64(tc.length)]) {
+			t.Fatalf("ReadFullAt(%d, %d) read the wrong bytes", tc.off, tc.length)
+		}
+	}
+
+	p := make([]byte, 100)
+	n, err := ReadFullAt(f, p, int64(len(data)-10))
+	if n != 10 || err != io.EOF || !bytes.Equal(p[:n], data[len(data)-10:]) {
+		t.Fatalf("read past the end returned %d, %v", n, err)
+	}
+}
+
+func TestSectionReader(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 100000)
+	defer f.Close()
+
+	const off, n = 4097, 30001
+	want := data[off : off+n]
+
+	s, err := NewSectionReader(f, off, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("read %d bytes of the section, want %d", len(got), n)
+	}
+
+	if pos, err := s.Seek(-10, io.SeekEnd); err != nil || pos != n-10 {
+		t.Fatalf("seek returned %d, %v", pos, err)
+	}
+	got, _ = io.ReadAll(s)
+	if !bytes.Equal(got, want[n-10:]) {
+		t.Fatal("wrong bytes read after seek")
+	}
+
+	p := make([]byte, 100)
+	if m, err := s.ReadAt(p, n-50); m != 50 || err != io.EOF || !bytes.Equal(p[:m], want[n-50:]) {
+		t.Fatalf("ReadAt at the end returned %d, %v", m, err)
+	}
+}
+
+func TestTextReader(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	path := filepath.Join(dir, "text")
+	var want []string
+	var data []byte
+	for i := 0; i < 100000; i++ {
+		line := fmt.Sprintf("line %d %s", i, strings.Repeat("x", i%97))
+		want = append(want, line)
+		data = append(data, line+"\n"...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s, err := NewTextReader(f, ReadAhead(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	i := 0
+	for s.Scan() {
+		if i >= len(want) || s.Text() != want[i] {
+			t.Fatalf("line %d is %q", i, s.Text())
+		}
+		i++
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(want) {
+		t.Fatalf("scanned %d lines, want %d", i, len(want))
+	}
+}
@@ -0,0 +1,102 @@
+package directio
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var _ io.ReaderFrom = (*DirectIO)(nil)
+
+// ReadFrom implements io.ReaderFrom, so io.Copy to a DirectIO writer reads
+// straight into the aligned buffer instead of going through an intermediate
+// buffer.
+//
+// When r is a pipe, the block aligned part of the data available in it is
+// moved into the file with splice(2) without passing through user space.
+// When r is a socket, such as a *net.TCPConn, data is spliced through a pipe
+// kept by the writer until Close. The writer falls back to the buffered path
+// for the rest, and for good if the kernel refuses to splice into the file.
+//
+// Like Write, ReadFrom leaves the unaligned remainder in the buffer for Close.
+// With WithMaxSize, it stops at the budget and returns a *QuotaError if r
+// has more data.
+func (d *DirectIO) ReadFrom(r io.Reader) (n int64, err error) {
+	d.lock()
+	defer d.unlock()
+
+	if d.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+
+	splice := d.canSplice()
+
+	for {
+		if d.err != nil {
+			return n, d.err
+		}
+
+		if d.Available() == 0 {
+			if err := d.flush(); err != nil {
+				return n, err
+			}
+			d.report()
+		}
+
+		if splice && d.n == 0 && !d.noSplice {
+			m, err := d.spliceFrom(r)
+			n += m
+			d.written += m
+			d.report()
+			if err != nil {
+				d.err = err
+				return n, err
+			}
+		}
+
+		room := d.Available()
+		if q := d.quota(); q == 0 {
+			// The budget is used up, make sure r has nothing more to give.
+			var b [1]byte
+			if m, _ := io.ReadFull(r, b[:]); m > 0 {
+				return n, d.quotaError()
+			}
+			return n, nil
+		} else if q > 0 && int64(room) > q {
+			room = int(q)
+		}
+
+		m, rerr := r.Read(d.buf[d.n : d.n+room])
+		if m < 0 || m > room {
+			return n, errors.New("invalid read count")
+		}
+		d.n += m
+		d.accept(d.buf[d.n-m : d.n])
+		n += int64(m)
+
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// canSplice reports whether data may bypass the buffer. Options that need
+// to see every byte rule it out, and so do backends other than *os.File and
+// the positional writers of Regions. Spliced data doesn't go through
+// writeOut either, so the options acting on every write to the file, from
+// rate limiting to failure points, and engines other than EngineDirect rule
+// it out too.
+func (d *DirectIO) canSplice() bool {
+	if _, ok := d.f.(*os.File); !ok || d.positional {
+		return false
+	}
+	if d.hash != nil || d.chunks != nil || d.verify || d.maxSize > 0 || d.tees != nil {
+		return false
+	}
+
+	return d.engine == EngineDirect && d.limiter == nil && d.syncPolicy.mode == syncDefault &&
+		d.devSize == 0 && d.ioprio == 0 && d.observer == nil && d.failpoints == nil
+}
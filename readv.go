@@ -0,0 +1,62 @@
+package directio
+
+import (
+	"io"
+	"os"
+)
+
+// maxIovecs is the most buffers one preadv(2) takes, IOV_MAX on Linux.
+const maxIovecs = 1024
+
+// ReadVAt reads f, opened with O_DIRECT, at off into bufs in order with
+// preadv(2), scattering one large direct read across several destinations
+// without a copy, e.g. the columns of a row group. Every buffer must meet
+// the alignment of the file in address and length, or ErrUnalignedBuffer is
+// returned, and so must off, or ErrUnalignedOffset is; nothing is read then.
+// It returns the total read, and io.EOF when the file ends before the
+// buffers are full.
+func ReadVAt(f *os.File, bufs [][]byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativePosition
+	}
+
+	a := cachedFdAlignment(f.Fd())
+	unit := a.unit()
+
+	if off%int64(unit) != 0 {
+		return 0, ErrUnalignedOffset
+	}
+
+	var total int
+	for _, buf := range bufs {
+		if len(buf)%unit != 0 || (len(buf) > 0 && align(buf, a.blockSize) != 0) {
+			return 0, ErrUnalignedBuffer
+		}
+		total += len(buf)
+	}
+
+	var n int
+	for len(bufs) > 0 {
+		batch := bufs[:min(len(bufs), maxIovecs)]
+		want := 0
+		for _, buf := range batch {
+			want += len(buf)
+		}
+
+		m, err := preadv(f, batch, off+int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m < want {
+			break
+		}
+		bufs = bufs[len(batch):]
+	}
+
+	if n < total {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
@@ -0,0 +1,62 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadVAt(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	name := filepath.Join(dir, "readv")
+	data := make([]byte, 5*4096+100)
+	for i := range data {
+		data[i] = byte(i % 249)
+	}
+	if err := os.WriteFile(name, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf, err := allocAlignedBuf(4096, 6*4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := [][]byte{buf[:4096], buf[4096 : 3*4096], buf[3*4096 : 4*4096]}
+
+	if _, err := ReadVAt(f, [][]byte{buf[1:4097]}, 0); err != ErrUnalignedBuffer {
+		t.Fatalf("unaligned buffer: got %v, want ErrUnalignedBuffer", err)
+	}
+	if _, err := ReadVAt(f, cols, 100); err != ErrUnalignedOffset {
+		t.Fatalf("unaligned offset: got %v, want ErrUnalignedOffset", err)
+	}
+
+	n, err := ReadVAt(f, cols, 4096)
+	if err != nil || n != 4*4096 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if !bytes.Equal(buf[:n], data[4096:4096+n]) {
+		t.Fatal("data read back differs")
+	}
+
+	// The file ends within the second buffer.
+	n, err = ReadVAt(f, [][]byte{buf[:4096], buf[4096 : 3*4096]}, 4*4096)
+	if err != io.EOF || n != 4096+100 {
+		t.Fatalf("read past the end: got %d, %v", n, err)
+	}
+	if !bytes.Equal(buf[:n], data[4*4096:]) {
+		t.Fatal("data read back at the end differs")
+	}
+}
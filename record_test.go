@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRecordWriter(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "records")
+	defer f.Close()
+
+	if _, err := NewRecordWriter(f, 1000); err == nil {
+		t.Fatal("record size not a multiple of the block size accepted")
+	}
+
+	r, err := NewRecordWriter(f, 8192, WithMaxSize(10*8192))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []byte
+	for i := 0; i < 5; i++ {
+		rec := bytes.Repeat([]byte{byte('a' + i)}, 8192)
+		idx, err := r.WriteRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx != int64(i) {
+			t.Fatalf("record %d got index %d", i, idx)
+		}
+		want = append(want, rec...)
+	}
+
+	var serr *RecordSizeError
+	if _, err := r.WriteRecord(make([]byte, 4096)); !errors.As(err, &serr) || !errors.Is(err, ErrRecordSize) || serr.Len != 4096 {
+		t.Fatalf("short record: got %v", err)
+	}
+	if r.Next() != 5 {
+		t.Fatalf("next index %d, want 5", r.Next())
+	}
+
+	n, err := r.Checkpoint()
+	if err != nil || n != 5 || r.Flushed() != 5 {
+		t.Fatalf("checkpoint at %d records (%v), %d flushed", n, err, r.Flushed())
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Carry on after the existing records.
+	r, err = NewRecordWriter(f, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx, err := r.WriteRecord(make([]byte, 8192)); err != nil || idx != 5 {
+		t.Fatalf("got index %d, %v", idx, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, make([]byte, 8192)...)
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("file content mismatch, got %d bytes, want %d", len(got), len(want))
+	}
+}
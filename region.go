@@ -0,0 +1,98 @@
+package directio
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// ErrRegionOverlap is returned by Regions.Writer for a region overlapping
+// one handed out before.
+var ErrRegionOverlap = errors.New("region overlaps another region")
+
+// Regions hands out positional writers over one file, each writing its own
+// region with pwrite(2) and leaving the file offset alone, so several
+// goroutines can fill the file at once, e.g. the chunks of a parallel
+// download. The writers share the buffers they allocate, and the alignment
+// detected for the file.
+type Regions struct {
+	f    *os.File
+	size int
+	opts []Option
+	pool bufPool
+
+	mu      sync.Mutex
+	regions [][2]int64
+}
+
+// NewRegions returns Regions over f, which must be opened with O_DIRECT.
+// The writers get a buffer of size bytes and the options opts. Files opened
+// with O_APPEND are refused with ErrAppendMode, pwrite(2) appends to them
+// whatever the offset.
+func NewRegions(f *os.File, size int, opts ...Option) (*Regions, error) {
+	if err := checkDirectIO(f.Fd()); err != nil {
+		return nil, err
+	}
+	if appendMode(f.Fd()) {
+		return nil, ErrAppendMode
+	}
+
+	return &Regions{f: f, size: size, opts: opts}, nil
+}
+
+// Writer returns a writer for the length bytes of the file starting at off,
+// which must meet the direct I/O alignment of the file. The writer accepts
+// at most length bytes, returning a *QuotaError past that, and writes an
+// unaligned tail the way TailPad does, as toggling O_DIRECT on the shared
+// descriptor would disturb the other writers. The padding is left in the
+// file, truncate it to its final size once the writers are closed. Close
+// doesn't close the file.
+func (r *Regions) Writer(off, length int64) (*DirectIO, error) {
+	if off < 0 {
+		return nil, errNegativePosition
+	}
+	if length <= 0 {
+		return nil, errors.New("region length must be greater than zero")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, reg := range r.regions {
+		if off < reg[1] && reg[0] < off+length {
+			return nil, ErrRegionOverlap
+		}
+	}
+
+	opts := append(r.opts[:len(r.opts):len(r.opts)], func(d *DirectIO) {
+		d.positional = true
+		d.off = off
+		d.maxSize = length
+		d.pool = &r.pool
+	})
+	d, err := newWriter(r.f, r.size, EngineDirect, opts)
+	if err != nil {
+		return nil, err
+	}
+	r.regions = append(r.regions, [2]int64{off, off + length})
+
+	return d, nil
+}
+
+// bufPool recycles the aligned buffers of writers over the same file.
+type bufPool struct {
+	pool sync.Pool
+}
+
+// get returns a buffer of size bytes aligned to blockSize.
+func (p *bufPool) get(blockSize, size int) ([]byte, error) {
+	if buf, ok := p.pool.Get().([]byte); ok && len(buf) == size && align(buf, blockSize) == 0 {
+		return buf, nil
+	}
+
+	return allocAlignedBuf(blockSize, size)
+}
+
+func (p *bufPool) put(buf []byte) {
+	p.pool.Put(buf)
+}
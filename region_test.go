@@ -0,0 +1,119 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestRegions(t *testing.T) {
+	const region = 1 << 18
+	data := make([]byte, 3*region+1000)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "regions")
+	defer f.Close()
+
+	regs, err := NewRegions(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := regs.Writer(3, region); !errors.Is(err, ErrUnalignedOffset) {
+		t.Fatalf("unaligned region: got %v, want ErrUnalignedOffset", err)
+	}
+
+	// Fill the regions from the last one, in parallel.
+	done := make(chan error)
+	for off := int64(3 * region); off >= 0; off -= region {
+		end := off + region
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+
+		w, err := regs.Writer(off, end-off)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go func(p []byte) {
+			// Odd write sizes, so every writer goes through its buffer.
+			for len(p) > 0 {
+				n := min(len(p), 10007)
+				if _, err := w.Write(p[:n]); err != nil {
+					done <- err
+					return
+				}
+				p = p[n:]
+			}
+			done <- w.Close()
+		}(data[off:end])
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := regs.Writer(region/2, region); !errors.Is(err, ErrRegionOverlap) {
+		t.Fatalf("overlapping region: got %v, want ErrRegionOverlap", err)
+	}
+
+	if off, err := f.Seek(0, io.SeekCurrent); err != nil || off != 0 {
+		t.Fatalf("file offset moved to %d (%v)", off, err)
+	}
+
+	// The padding of the last region is for the owner of the file to cut.
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() <= int64(len(data)) {
+		t.Fatalf("file is %d bytes, the padding of the last region was cut", info.Size())
+	}
+	if err := f.Truncate(int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("file content mismatch, got %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestRegionsQuota(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "regions-quota")
+	defer f.Close()
+
+	regs, err := NewRegions(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := regs.Writer(0, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write(make([]byte, 5000)); n != 4096 || !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("write past the region: got %d, %v", n, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,130 @@
+package directio
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAlignmentChanged is returned by Reset, with ResetSameAlignment, for a
+// backend whose alignment differs from the one of the previous file.
+var ErrAlignmentChanged = errors.New("alignment differs from the previous file")
+
+// ResetPolicy selects what Reset does about the alignment of the new file,
+// which may differ from the previous one when it is on another filesystem
+// or device.
+type ResetPolicy int
+
+const (
+	// ResetKeepAlignment keeps the alignment of the previous file without
+	// looking at the new one, the cheapest. Writes fail if the new file
+	// needs a larger one.
+	ResetKeepAlignment ResetPolicy = iota
+
+	// ResetRedetect detects the alignment of the new file, and reallocates
+	// the buffer if it no longer meets it.
+	ResetRedetect
+
+	// ResetSameAlignment detects the alignment of the new file, and makes
+	// Reset fail with ErrAlignmentChanged if it differs.
+	ResetSameAlignment
+)
+
+// WithResetPolicy sets what Reset does about the alignment of the new file.
+// An alignment set with WithAlignment is kept whatever the policy.
+func WithResetPolicy(p ResetPolicy) Option {
+	return func(d *DirectIO) {
+		d.resetPolicy = p
+	}
+}
+
+// Reset points a writer done with Finish at the backend f, keeping its
+// buffer and options, so writing many files doesn't allocate a buffer for
+// each. The writer starts over: its counters, checksum and page cache
+// bookkeeping are cleared, and writing starts at the offset of f. The
+// alignment detected for the previous file is kept unless WithResetPolicy
+// says otherwise. With WithCloseFile, the previous file is closed.
+func (d *DirectIO) Reset(f Backend) (err error) {
+	d.lock()
+	defer d.unlock()
+
+	if d.released {
+		return errors.New("the writer is closed")
+	}
+	if !d.isClosed {
+		return errors.New("the writer is not finished")
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.failPending(nil)
+	d.releaseVerify()
+
+	if d.closer != nil {
+		err = d.closer.Close()
+	}
+
+	d.f = f
+	d.closer = nil
+	d.n = 0
+	d.err = nil
+	d.written = 0
+	d.flushed = 0
+	d.reported = 0
+	d.unsynced = 0
+	d.sum = nil
+	if d.hash != nil {
+		d.hash.Reset()
+	}
+	if d.chunks != nil {
+		d.chunks.reset()
+	}
+	d.fast = fastPath{}
+	d.dropOff, d.dropEnd = 0, 0
+	d.lastFull = time.Time{}
+
+	if aerr := d.reattach(); aerr != nil {
+		// Stays finished, Reset can be tried again.
+		return errors.Join(err, aerr)
+	}
+	d.isClosed = false
+
+	if d.timer != nil {
+		d.timer.Reset(d.interval)
+	}
+
+	return err
+}
+
+// reattach attaches the writer to its new backend as the reset policy says.
+// The previous alignment is restored if it fails.
+func (d *DirectIO) reattach() (err error) {
+	blockSize, offsetAlign, source := d.blockSize, d.offsetAlign, d.alignSource
+	defer func() {
+		if err != nil {
+			d.blockSize, d.offsetAlign, d.alignSource = blockSize, offsetAlign, source
+		}
+	}()
+
+	detect := d.resetPolicy != ResetKeepAlignment
+	if detect && !d.fixedAlign {
+		d.blockSize = 0
+	}
+	if err := d.attach(detect); err != nil {
+		return err
+	}
+
+	if d.blockSize == blockSize && d.offsetAlign == offsetAlign {
+		return nil
+	}
+	if d.resetPolicy == ResetSameAlignment {
+		return fmt.Errorf("%w: block size %d and offset alignment %d, was %d and %d",
+			ErrAlignmentChanged, d.blockSize, d.offsetAlign, blockSize, offsetAlign)
+	}
+	if len(d.buf)%d.blockSize != 0 || align(d.buf, d.blockSize) != 0 {
+		return d.replaceBuf(bufSize(len(d.buf), d.blockSize))
+	}
+
+	return nil
+}
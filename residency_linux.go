@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// CacheResidency reports how much of the length bytes of f at off is in the
+// page cache, by mapping the range and asking mincore(2). A length of 0 means
+// up to the end of the file. Both counts are in bytes, rounded out to whole
+// pages: resident is the part cached, total the size of the range. Files
+// written and read through this package should have next to nothing
+// resident.
+func CacheResidency(f *os.File, off, length int64) (resident, total int64, err error) {
+	if off < 0 || length < 0 {
+		return 0, 0, errNegativePosition
+	}
+
+	if length == 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return 0, 0, err
+		}
+		length = info.Size() - off
+		if length <= 0 {
+			return 0, 0, nil
+		}
+	}
+
+	page := int64(os.Getpagesize())
+	start := off - off%page
+	end := off + length
+	if rem := end % page; rem != 0 {
+		end += page - rem
+	}
+
+	// The mapping is never touched, so it doesn't pull anything in.
+	m, err := unix.Mmap(int(f.Fd()), start, int(end-start), unix.PROT_READ, unix.MAP_SHARED)
+	if err == unix.EACCES {
+		// Opened write only, as writers usually are.
+		r, rerr := reopenDirect(f.Fd())
+		if rerr != nil {
+			return 0, 0, err
+		}
+		defer r.Close()
+		m, err = unix.Mmap(int(r.Fd()), start, int(end-start), unix.PROT_READ, unix.MAP_SHARED)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unix.Munmap(m)
+
+	vec := make([]byte, (end-start)/page)
+	if _, _, e1 := syscall.Syscall(syscall.SYS_MINCORE, uintptr(unsafe.Pointer(&m[0])), uintptr(len(m)), uintptr(unsafe.Pointer(&vec[0]))); e1 != 0 {
+		return 0, 0, e1
+	}
+
+	for _, v := range vec {
+		if v&1 != 0 {
+			resident += page
+		}
+	}
+
+	return resident, end - start, nil
+}
@@ -0,0 +1,86 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestCacheResidency(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "residency")
+	defer f.Close()
+
+	dio, err := New(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("residency"), 100000)
+	if _, err := dio.Write(data[:len(data)-len(data)%dio.BlockSize()]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dio.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resident, total, err := CacheResidency(f, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total < int64(len(data))-int64(dio.BlockSize()) {
+		t.Fatalf("total = %d, want about %d", total, len(data))
+	}
+	if resident != 0 {
+		t.Errorf("%d bytes of a direct written file are cached", resident)
+	}
+
+	// Reading the file normally brings it in.
+	if _, err := os.ReadFile(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if resident, _, err = CacheResidency(f, 0, 0); err != nil || resident == 0 {
+		t.Errorf("%d bytes cached after a buffered read, %v", resident, err)
+	}
+}
+
+func TestAdvise(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, _ := readerFile(t, dir, 1<<20)
+	defer f.Close()
+
+	for _, a := range []Advice{AdviceSequential, AdviceRandom, AdviceNoReuse, AdviceNormal} {
+		if err := Advise(f, 0, 0, a); err != nil {
+			t.Fatalf("Advise(%d) = %v", a, err)
+		}
+	}
+
+	g, err := os.Open(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	if err := Advise(g, 0, 0, AdviceWillNeed); err != nil {
+		t.Fatal(err)
+	}
+	if resident, _, _ := CacheResidency(g, 0, 0); resident == 0 {
+		t.Error("nothing cached after AdviceWillNeed")
+	}
+	// Only clean pages can be dropped.
+	if err := g.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Advise(g, 0, 0, AdviceDontNeed); err != nil {
+		t.Fatal(err)
+	}
+	if resident, _, _ := CacheResidency(g, 0, 0); resident != 0 {
+		t.Errorf("%d bytes still cached after AdviceDontNeed", resident)
+	}
+}
@@ -0,0 +1,469 @@
+package directio
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const (
+	// ringMagic identifies a file formatted by CreateRing.
+	ringMagic = "DIORING\x01"
+
+	// ringSuperblockLen is the number of meaningful bytes in the superblock.
+	// The superblock always occupies one full block on disk.
+	ringSuperblockLen = 44
+)
+
+var (
+	// ErrNotRing is returned when the superblock of a file is missing or corrupt.
+	ErrNotRing = errors.New("not a directio ring file")
+
+	crc32c = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// ringSuperblock is the on-disk header of a ring file.
+//
+// Layout (big endian):
+//
+//	[0:8]   magic
+//	[8:12]  block size
+//	[12:16] reserved
+//	[16:24] capacity of the data region in bytes
+//	[24:32] head (logical offset of the next byte to be written)
+//	[32:40] tail (logical offset of the oldest byte still readable)
+//	[40:44] CRC32-C of bytes [0:40]
+type ringSuperblock struct {
+	blockSize int
+	capacity  int64
+	head      int64
+	tail      int64
+}
+
+func (sb *ringSuperblock) encode(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+
+	copy(b[0:8], ringMagic)
+	binary.BigEndian.PutUint32(b[8:12], uint32(sb.blockSize))
+	binary.BigEndian.PutUint64(b[16:24], uint64(sb.capacity))
+	binary.BigEndian.PutUint64(b[24:32], uint64(sb.head))
+	binary.BigEndian.PutUint64(b[32:40], uint64(sb.tail))
+	binary.BigEndian.PutUint32(b[40:44], crc32.Checksum(b[0:40], crc32c))
+}
+
+func (sb *ringSuperblock) decode(b []byte) error {
+	if len(b) < ringSuperblockLen || string(b[0:8]) != ringMagic {
+		return ErrNotRing
+	}
+	if binary.BigEndian.Uint32(b[40:44]) != crc32.Checksum(b[0:40], crc32c) {
+		return ErrNotRing
+	}
+
+	sb.blockSize = int(binary.BigEndian.Uint32(b[8:12]))
+	sb.capacity = int64(binary.BigEndian.Uint64(b[16:24]))
+	sb.head = int64(binary.BigEndian.Uint64(b[24:32]))
+	sb.tail = int64(binary.BigEndian.Uint64(b[32:40]))
+
+	if sb.blockSize <= 0 || sb.capacity <= 0 || sb.capacity%int64(sb.blockSize) != 0 ||
+		sb.tail > sb.head || sb.head-sb.tail > sb.capacity {
+		return ErrNotRing
+	}
+
+	return nil
+}
+
+// readRingSuperblock reads and validates the superblock of f.
+func readRingSuperblock(f *os.File, blockSize int) (ringSuperblock, error) {
+	var sb ringSuperblock
+
+	buf, err := allocAlignedBuf(blockSize, blockSize)
+	if err != nil {
+		return sb, err
+	}
+
+	if _, err := f.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return sb, err
+	}
+
+	if err := sb.decode(buf); err != nil {
+		return sb, err
+	}
+
+	if sb.blockSize != blockSize {
+		// The ring was formatted with a different alignment, re-read with it.
+		return readRingSuperblock(f, sb.blockSize)
+	}
+
+	return sb, nil
+}
+
+// RingWriter treats a preallocated file (or block device) as a ring buffer.
+//
+// The first block of the file holds a superblock tracking head and tail, the
+// rest is the data region. Once the data region is full the oldest data is
+// overwritten, which makes RingWriter suitable for flight-recorder style
+// logging: the file always holds the most recent capacity bytes.
+//
+// All I/O is block aligned and goes through O_DIRECT. The partially filled
+// block at the head is kept in memory and rewritten in place on every flush.
+type RingWriter struct {
+	f     *os.File
+	sb    ringSuperblock
+	sbBuf []byte
+	buf   []byte
+	start int64 // logical offset of buf[0], always block aligned
+	n     int
+	err   error
+
+	isClosed bool
+}
+
+// CreateRing formats f as a ring with a data region of capacity bytes and
+// returns a writer positioned at its beginning. capacity is rounded up to the
+// block size. Regular files are grown to the ring size; block devices must
+// already be large enough.
+//
+// f must be opened with O_RDWR and O_DIRECT.
+func CreateRing(f *os.File, capacity int64) (*RingWriter, error) {
+	if err := checkDirectIO(f.Fd()); err != nil {
+		return nil, err
+	}
+
+	blockSize := GetBestAlignment(f.Name())
+
+	if capacity <= 0 {
+		return nil, errors.New("capacity must be greater than zero")
+	}
+	if rem := capacity % int64(blockSize); rem != 0 {
+		capacity += int64(blockSize) - rem
+	}
+
+	if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+		if err := f.Truncate(int64(blockSize) + capacity); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := newRingWriter(f, ringSuperblock{blockSize: blockSize, capacity: capacity})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.writeSuperblock(); err != nil {
+		return nil, err
+	}
+
+	return w, f.Sync()
+}
+
+// OpenRing opens an existing ring and returns a writer that continues
+// appending at the recorded head.
+//
+// f must be opened with O_RDWR and O_DIRECT.
+func OpenRing(f *os.File) (*RingWriter, error) {
+	if err := checkDirectIO(f.Fd()); err != nil {
+		return nil, err
+	}
+
+	sb, err := readRingSuperblock(f, GetBestAlignment(f.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := newRingWriter(f, sb)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload the partial block at the head so that new data is merged into it.
+	if w.n > 0 {
+		if _, err := f.ReadAt(w.buf[:sb.blockSize], w.physical(w.start)); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+func newRingWriter(f *os.File, sb ringSuperblock) (*RingWriter, error) {
+	size := alignUp(defaultBufSize, sb.blockSize)
+	if int64(size) > sb.capacity {
+		size = int(sb.capacity)
+	}
+
+	buf, err := allocAlignedBuf(sb.blockSize, size)
+	if err != nil {
+		return nil, err
+	}
+
+	sbBuf, err := allocAlignedBuf(sb.blockSize, sb.blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	start := sb.head - sb.head%int64(sb.blockSize)
+
+	return &RingWriter{
+		f:     f,
+		sb:    sb,
+		sbBuf: sbBuf,
+		buf:   buf,
+		start: start,
+		n:     int(sb.head - start),
+	}, nil
+}
+
+// Capacity returns the size of the data region in bytes.
+func (w *RingWriter) Capacity() int64 { return w.sb.capacity }
+
+// physical maps a block aligned logical offset to its position in the file.
+func (w *RingWriter) physical(off int64) int64 {
+	return int64(w.sb.blockSize) + off%w.sb.capacity
+}
+
+// writeSuperblock persists the current head and tail. The writer only moves
+// the tail when it overwrites data, so a tail moved further on disk by
+// RingReader.Commit is kept.
+func (w *RingWriter) writeSuperblock() error {
+	var disk ringSuperblock
+	if _, err := w.f.ReadAt(w.sbBuf, 0); err == nil && disk.decode(w.sbBuf) == nil &&
+		disk.tail > w.sb.tail && disk.tail <= w.sb.head {
+		w.sb.tail = disk.tail
+	}
+
+	w.sb.encode(w.sbBuf)
+
+	_, err := w.f.WriteAt(w.sbBuf, 0)
+	return err
+}
+
+// flush writes the buffered blocks to the data region, wrapping around the
+// end of the ring if needed, and records the new head in the superblock.
+// The partially filled last block stays in the buffer.
+func (w *RingWriter) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.n == 0 {
+		return nil
+	}
+
+	bs := w.sb.blockSize
+
+	size := w.n
+	if rem := size % bs; rem != 0 {
+		// Zero the padding so stale bytes never reach the disk.
+		for i := w.n; i < w.n+bs-rem; i++ {
+			w.buf[i] = 0
+		}
+		size += bs - rem
+	}
+
+	p := w.buf[:size]
+	off := w.start
+	for len(p) > 0 {
+		chunk := len(p)
+		if toEnd := w.sb.capacity - off%w.sb.capacity; int64(chunk) > toEnd {
+			chunk = int(toEnd)
+		}
+
+		if _, w.err = w.f.WriteAt(p[:chunk], w.physical(off)); w.err != nil {
+			return w.err
+		}
+
+		p = p[chunk:]
+		off += int64(chunk)
+	}
+
+	w.sb.head = w.start + int64(w.n)
+	if oldest := w.start + int64(size) - w.sb.capacity; oldest > w.sb.tail {
+		w.sb.tail = oldest
+	}
+
+	if w.err = w.writeSuperblock(); w.err != nil {
+		return w.err
+	}
+
+	// Keep the partial block at the front of the buffer.
+	full := w.n - w.n%bs
+	copy(w.buf, w.buf[full:w.n])
+	w.start += int64(full)
+	w.n -= full
+
+	return nil
+}
+
+// Write appends p to the ring, overwriting the oldest data once the ring is full.
+func (w *RingWriter) Write(p []byte) (nn int, err error) {
+	if w.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+
+	for len(p) > 0 {
+		n := copy(w.buf[w.n:], p)
+		w.n += n
+		nn += n
+		p = p[n:]
+
+		if w.n == len(w.buf) {
+			if err := w.flush(); err != nil {
+				return nn, err
+			}
+		}
+	}
+
+	return nn, nil
+}
+
+// Sync flushes all buffered data, including the partial head block, updates
+// the superblock and calls Sync on the underlying os.File.
+func (w *RingWriter) Sync() error {
+	if w.isClosed {
+		return errors.New("the writer is closed")
+	}
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	return w.f.Sync()
+}
+
+// Close syncs the ring. It doesn't close the underlying os.File.
+func (w *RingWriter) Close() error {
+	if w.isClosed {
+		return errors.New("the writer is already closed")
+	}
+
+	err := w.Sync()
+	w.isClosed = true
+
+	return err
+}
+
+// RingReader drains data from a ring file in order, from the oldest byte
+// still held by the ring up to the head recorded in the superblock.
+type RingReader struct {
+	f     *os.File
+	sb    ringSuperblock
+	sbBuf []byte
+	buf   []byte
+	start int64 // logical offset of buf[0]
+	n     int   // valid bytes in buf
+	pos   int64 // logical offset of the next byte returned by Read
+}
+
+// NewRingReader returns a reader for the ring stored in f.
+//
+// f must be opened with O_DIRECT. Commit additionally requires O_RDWR.
+func NewRingReader(f *os.File) (*RingReader, error) {
+	if err := checkDirectIO(f.Fd()); err != nil {
+		return nil, err
+	}
+
+	sb, err := readRingSuperblock(f, GetBestAlignment(f.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	size := alignUp(defaultBufSize, sb.blockSize)
+	if int64(size) > sb.capacity {
+		size = int(sb.capacity)
+	}
+
+	buf, err := allocAlignedBuf(sb.blockSize, size)
+	if err != nil {
+		return nil, err
+	}
+
+	sbBuf, err := allocAlignedBuf(sb.blockSize, sb.blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RingReader{
+		f:     f,
+		sb:    sb,
+		sbBuf: sbBuf,
+		buf:   buf,
+		pos:   sb.tail,
+	}, nil
+}
+
+// Len returns the number of bytes left to drain.
+func (r *RingReader) Len() int64 { return r.sb.head - r.pos }
+
+// fill reads the blocks covering r.pos into the buffer.
+func (r *RingReader) fill() error {
+	bs := int64(r.sb.blockSize)
+
+	r.start = r.pos - r.pos%bs
+	r.n = 0
+
+	size := int64(len(r.buf))
+	if toEnd := r.sb.capacity - r.start%r.sb.capacity; size > toEnd {
+		size = toEnd
+	}
+
+	n, err := r.f.ReadAt(r.buf[:size], bs+r.start%r.sb.capacity)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if n == 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	r.n = n
+
+	return nil
+}
+
+// Read reads the next bytes of the ring into p.
+func (r *RingReader) Read(p []byte) (int, error) {
+	if r.pos >= r.sb.head {
+		return 0, io.EOF
+	}
+
+	if r.pos < r.start || r.pos >= r.start+int64(r.n) {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	end := r.start + int64(r.n)
+	if end > r.sb.head {
+		end = r.sb.head
+	}
+
+	n := copy(p, r.buf[r.pos-r.start:end-r.start])
+	r.pos += int64(n)
+
+	return n, nil
+}
+
+// Commit records in the superblock that everything read so far has been
+// drained, so that a later reader starts after it. The head is re-read from
+// disk first so that data appended since the reader was created is kept.
+func (r *RingReader) Commit() error {
+	sb, err := readRingSuperblock(r.f, r.sb.blockSize)
+	if err != nil {
+		return err
+	}
+
+	if r.pos > sb.tail {
+		sb.tail = r.pos
+	}
+	r.sb = sb
+	r.sb.encode(r.sbBuf)
+
+	if _, err := r.f.WriteAt(r.sbBuf, 0); err != nil {
+		return err
+	}
+
+	return r.f.Sync()
+}
@@ -0,0 +1,145 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, err := os.OpenFile(filepath.Join(dir, "ring"), os.O_RDWR|os.O_CREATE|O_DIRECT, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := CreateRing(f, 64*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 3*w.Capacity()+123)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	// Write in odd chunks so the head is rarely block aligned.
+	for p := data; len(p) > 0; {
+		n := 777
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRingReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() > w.Capacity() {
+		t.Fatalf("ring holds %d bytes, capacity is %d", r.Len(), w.Capacity())
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[len(data)-len(got):]) {
+		t.Fatal("ring returned wrong bytes")
+	}
+
+	// Appending after reopening continues at the recorded head.
+	w, err = OpenRing(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("tail")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewRingReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "tail" {
+		t.Fatalf("got %q after commit, want %q", got, "tail")
+	}
+}
+
+func TestRingCommit(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, err := os.OpenFile(filepath.Join(dir, "ring-commit"), os.O_RDWR|os.O_CREATE|O_DIRECT, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w, err := CreateRing(f, 64*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(bytes.Repeat([]byte("a"), 10000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drain and commit while the writer is still open.
+	r, err := NewRingReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing on must not bring the drained data back.
+	if _, err := w.Write(bytes.Repeat([]byte("b"), 5000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = NewRingReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Repeat([]byte("b"), 5000)) {
+		t.Fatalf("read %d bytes after the commit, want the 5000 written since", len(got))
+	}
+}
@@ -0,0 +1,51 @@
+package directio
+
+import (
+	"errors"
+	"os"
+)
+
+// ScanValidLength reads f, opened with O_DIRECT, from the start in blocks of
+// blockSize bytes and returns the offset right after the last block of the
+// valid prefix: the scan stops at the first block validator rejects. A
+// partial block at the end of the file is passed to validator as is. It is
+// meant to find where a log or segment file stops being trustworthy after a
+// crash, validator typically checking a per-block checksum or magic.
+//
+// blockSize must be a multiple of the direct I/O alignment of f. Blocks are
+// read several at a time through a 1MB aligned buffer.
+func ScanValidLength(f *os.File, blockSize int, validator func([]byte) bool) (int64, error) {
+	a := cachedFdAlignment(f.Fd())
+	if blockSize <= 0 || blockSize%a.unit() != 0 {
+		return 0, errors.New("block size is not a multiple of the alignment")
+	}
+
+	size := defaultCopyBufSize
+	if size < blockSize {
+		size = blockSize
+	}
+	buf, err := allocAlignedBuf(a.blockSize, size-size%blockSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var off int64
+	for {
+		n, err := pread(f, buf, off)
+		if err != nil {
+			return off, err
+		}
+
+		for i := 0; i < n; i += blockSize {
+			end := min(i+blockSize, n)
+			if !validator(buf[i:end]) {
+				return off + int64(i), nil
+			}
+		}
+		off += int64(n)
+
+		if n < len(buf) {
+			return off, nil
+		}
+	}
+}
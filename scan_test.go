@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanValidLength(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	const blockSize = 4096
+
+	// 600 good blocks, one torn block, then more good blocks that must not
+	// count.
+	data := bytes.Repeat([]byte{'G'}, 601*blockSize+100)
+	copy(data[600*blockSize:], "torn")
+
+	path := filepath.Join(dir, "scan")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	valid := func(b []byte) bool { return b[0] == 'G' }
+
+	n, err := ScanValidLength(f, blockSize, valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 600*blockSize {
+		t.Fatalf("valid length %d, want %d", n, 600*blockSize)
+	}
+
+	// Once repaired, the whole file including its partial block is valid.
+	data[600*blockSize] = 'G'
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ScanValidLength(f, blockSize, valid); err != nil || n != int64(len(data)) {
+		t.Fatalf("valid length %d, %v, want %d", n, err, len(data))
+	}
+
+	if _, err := ScanValidLength(f, 100, valid); err == nil {
+		t.Error("unaligned block size was accepted")
+	}
+}
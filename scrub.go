@@ -0,0 +1,172 @@
+package directio
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"syscall"
+	"time"
+)
+
+// ScrubOptions configures Scrub.
+type ScrubOptions struct {
+	// BlockSize is the size of the checksummed blocks, a multiple of the
+	// direct I/O alignment of the file.
+	BlockSize int
+
+	// Start is where the blocks start, e.g. past a header with a layout of
+	// its own. It must be a multiple of BlockSize.
+	Start int64
+
+	// Check reports whether the block at off is intact. It defaults to
+	// CheckCRC32C. The last block of the file may be short.
+	Check func(off int64, block []byte) bool
+
+	// Limiter bounds the read rate, so a background scrub doesn't starve
+	// the foreground I/O.
+	Limiter *Limiter
+}
+
+// CorruptRange is a run of consecutive corrupt or unreadable blocks.
+type CorruptRange struct {
+	Off int64
+	Len int64
+}
+
+// ScrubReport is the outcome of Scrub.
+type ScrubReport struct {
+	// Bytes and Blocks are what was checked.
+	Bytes  int64
+	Blocks int64
+
+	// Corrupt holds the ranges failing the check, or that couldn't be read
+	// because of a media error, in order.
+	Corrupt []CorruptRange
+
+	Elapsed time.Duration
+}
+
+// OK reports whether no corruption was found.
+func (r ScrubReport) OK() bool { return len(r.Corrupt) == 0 }
+
+// add records the block at off as corrupt, merging it with the previous
+// range if they touch.
+func (r *ScrubReport) add(off, n int64) {
+	if k := len(r.Corrupt); k > 0 && r.Corrupt[k-1].Off+r.Corrupt[k-1].Len == off {
+		r.Corrupt[k-1].Len += n
+		return
+	}
+	r.Corrupt = append(r.Corrupt, CorruptRange{Off: off, Len: n})
+}
+
+// CheckCRC32C reports whether the last 4 bytes of block hold the CRC-32C,
+// little endian, of the rest: the layout of pagestore pages with checksums.
+func CheckCRC32C(off int64, block []byte) bool {
+	if len(block) < 4 {
+		return false
+	}
+	data := block[:len(block)-4]
+
+	return crc32.Checksum(data, crc32c) == binary.LittleEndian.Uint32(block[len(data):])
+}
+
+// Scrub reads the whole file at path with O_DIRECT, so what is checked is
+// what the device holds and not the page cache, and checks every block of
+// it, reporting the corrupt ranges. A chunk failing with EIO is read again
+// block by block, and the unreadable blocks are reported as corrupt too;
+// other errors stop the scrub. Blocks are read several at a time through a
+// 1MB aligned buffer.
+func Scrub(path string, opts ScrubOptions) (r ScrubReport, err error) {
+	start := time.Now()
+	defer func() { r.Elapsed = time.Since(start) }()
+
+	f, err := os.OpenFile(path, os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+
+	a := cachedFdAlignment(f.Fd())
+	bs := opts.BlockSize
+	if bs <= 0 || bs%a.unit() != 0 {
+		return r, errors.New("block size is not a multiple of the alignment")
+	}
+	if opts.Start < 0 || opts.Start%int64(bs) != 0 {
+		return r, errors.New("start is not a multiple of the block size")
+	}
+	check := opts.Check
+	if check == nil {
+		check = CheckCRC32C
+	}
+
+	size := max(defaultCopyBufSize, bs)
+	buf, err := allocAlignedBuf(a.blockSize, size-size%bs)
+	if err != nil {
+		return r, err
+	}
+
+	for off := opts.Start; ; {
+		if opts.Limiter != nil {
+			opts.Limiter.Wait(len(buf))
+		}
+
+		n, err := pread(f, buf, off)
+		if errors.Is(err, syscall.EIO) {
+			// A media error somewhere in the chunk, find the bad blocks.
+			n, err = r.scrubBlocks(f, buf, off, bs, check)
+		} else if err == nil {
+			r.check(buf[:n], off, bs, check)
+		}
+		if err != nil {
+			return r, err
+		}
+		off += int64(n)
+
+		if n < len(buf) {
+			return r, nil
+		}
+	}
+}
+
+// check checks the blocks of bs bytes of the chunk read at off.
+func (r *ScrubReport) check(chunk []byte, off int64, bs int, check func(int64, []byte) bool) {
+	for i := 0; i < len(chunk); i += bs {
+		block := chunk[i:min(i+bs, len(chunk))]
+		if !check(off+int64(i), block) {
+			r.add(off+int64(i), int64(len(block)))
+		}
+		r.Blocks++
+		r.Bytes += int64(len(block))
+	}
+}
+
+// scrubBlocks reads and checks the chunk at off one block at a time after a
+// media error, reporting the unreadable blocks as corrupt. It returns how
+// much of the chunk the file holds.
+func (r *ScrubReport) scrubBlocks(f *os.File, buf []byte, off int64, bs int, check func(int64, []byte) bool) (int, error) {
+	var n int
+	for n < len(buf) {
+		block := buf[n : n+bs]
+
+		m, err := pread(f, block, off+int64(n))
+		switch {
+		case errors.Is(err, syscall.EIO):
+			r.add(off+int64(n), int64(bs))
+			r.Blocks++
+			r.Bytes += int64(bs)
+			m = bs
+		case err != nil:
+			return n, err
+		default:
+			r.check(block[:m], off+int64(n), bs, check)
+		}
+
+		n += m
+		if m < bs {
+			break
+		}
+	}
+
+	return n, nil
+}
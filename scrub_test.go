@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	// 600 blocks with a checksum each, more than the 1MB buffer holds, and
+	// a header block of another layout.
+	const bs = 4096
+	data := make([]byte, 601*bs)
+	for i := 1; i < 601; i++ {
+		block := data[i*bs : (i+1)*bs]
+		for j := range block[:bs-4] {
+			block[j] = byte(i + j)
+		}
+		binary.LittleEndian.PutUint32(block[bs-4:], crc32.Checksum(block[:bs-4], crc32c))
+	}
+	copy(data, "header")
+
+	// Corrupt blocks 10 and 11, which make one range, and 400.
+	data[10*bs+7]++
+	data[11*bs]++
+	data[400*bs+bs-1]++
+
+	path := filepath.Join(dir, "scrub")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Scrub(path, ScrubOptions{BlockSize: bs, Start: bs, Limiter: NewLimiter(1 << 30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Blocks != 600 || r.Bytes != 600*bs || r.OK() {
+		t.Fatalf("got %+v", r)
+	}
+	want := []CorruptRange{{10 * bs, 2 * bs}, {400 * bs, bs}}
+	if len(r.Corrupt) != len(want) || r.Corrupt[0] != want[0] || r.Corrupt[1] != want[1] {
+		t.Fatalf("corrupt ranges: got %v, want %v", r.Corrupt, want)
+	}
+
+	if _, err := Scrub(path, ScrubOptions{BlockSize: 100}); err == nil {
+		t.Fatal("unaligned block size accepted")
+	}
+}
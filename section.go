@@ -0,0 +1,111 @@
+package directio
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var (
+	_ io.ReadSeeker = (*SectionReader)(nil)
+	_ io.ReaderAt   = (*SectionReader)(nil)
+)
+
+// SectionReader reads the n bytes of an O_DIRECT file starting at off, like
+// io.SectionReader. The boundaries of the section don't need to be aligned:
+// reads are widened to the aligned range covering them and what lies outside
+// the section is never returned. It suits objects packed into large
+// container files.
+type SectionReader struct {
+	r   *DirectReader
+	f   *os.File
+	off int64
+	n   int64
+	pos int64
+}
+
+// NewSectionReader returns a SectionReader reading the n bytes of f at off.
+func NewSectionReader(f *os.File, off, n int64, opts ...ReaderOption) (*SectionReader, error) {
+	if off < 0 || n < 0 {
+		return nil, errNegativePosition
+	}
+
+	r, err := NewReader(f, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &SectionReader{r: r, f: f, off: off, n: n}, nil
+}
+
+// Size returns the size of the section in bytes.
+func (s *SectionReader) Size() int64 { return s.n }
+
+// Read reads up to len(p) bytes of the section.
+func (s *SectionReader) Read(p []byte) (int, error) {
+	if s.pos >= s.n {
+		return 0, io.EOF
+	}
+	if rest := s.n - s.pos; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+
+	return n, err
+}
+
+// Seek sets the offset of the next Read within the section.
+func (s *SectionReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.n
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errNegativePosition
+	}
+
+	if _, err := s.r.Seek(s.off+offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	s.pos = offset
+
+	return offset, nil
+}
+
+// ReadAt reads len(p) bytes at off within the section. It doesn't use or
+// move the offset of Read and is safe to call concurrently.
+func (s *SectionReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativePosition
+	}
+	if off >= s.n {
+		return 0, io.EOF
+	}
+
+	short := false
+	if rest := s.n - off; int64(len(p)) > rest {
+		p, short = p[:rest], true
+	}
+
+	n, err := ReadFullAt(s.f, p, s.off+off)
+	if err == nil && short {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// Close stops the prefetching of ReadAhead. It doesn't close the file.
+func (s *SectionReader) Close() error {
+	return s.r.Close()
+}
@@ -0,0 +1,120 @@
+package directio
+
+import (
+	"errors"
+	"io"
+)
+
+var _ io.WriteSeeker = (*DirectIO)(nil)
+
+// ErrUnalignedSeek is returned by Seek when the data written so far doesn't
+// end on a block boundary, so the partial block can't be left behind.
+var ErrUnalignedSeek = errors.New("buffered data doesn't end on a block boundary")
+
+// Seek implements io.Seeker. It writes out the whole blocks of the buffer
+// and moves the writer to offset, interpreted according to whence, so the
+// following writes land there, e.g. to fill in a header once the rest of a
+// file is written. The new offset must meet the direct I/O alignment of the
+// file, and the data written before the seek must end on a block boundary,
+// otherwise Seek fails with ErrUnalignedOffset or ErrUnalignedSeek and the
+// writer stays where it was. Seek(0, io.SeekCurrent) returns the current
+// offset and always succeeds.
+//
+// Close writes an unaligned tail at the current offset. With TailPad, a
+// tail landing before the end of the file zeroes the rest of its block.
+// Seeking is refused for files opened with O_APPEND.
+func (d *DirectIO) Seek(offset int64, whence int) (int64, error) {
+	d.lock()
+	defer d.unlock()
+
+	if d.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+
+	cur := d.off + int64(d.n)
+	if offset == 0 && whence == io.SeekCurrent {
+		return cur, nil
+	}
+
+	if appendMode(d.f.Fd()) {
+		return 0, ErrAppendMode
+	}
+
+	s, ok := d.f.(io.Seeker)
+	if !ok && !d.positional {
+		return 0, errors.New("backend doesn't support seeking")
+	}
+
+	err := d.flushAligned()
+	d.report()
+	if err != nil {
+		return 0, err
+	}
+
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = cur + offset
+	case io.SeekEnd:
+		end, err := d.end()
+		if err != nil {
+			return 0, err
+		}
+		pos = end + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errNegativePosition
+	}
+	if pos == cur {
+		return pos, nil
+	}
+
+	if d.n != 0 {
+		return 0, ErrUnalignedSeek
+	}
+	if err := d.checkOffset(pos); err != nil {
+		return 0, err
+	}
+
+	if !d.positional {
+		if _, err := s.Seek(pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	d.off = pos
+
+	return pos, nil
+}
+
+// end returns the size of the file, or of the device, the writer is on.
+func (d *DirectIO) end() (int64, error) {
+	if d.devSize > 0 {
+		return d.devSize, nil
+	}
+
+	if st, ok := d.f.(statter); ok {
+		info, err := st.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+
+	if s, ok := d.f.(io.Seeker); ok && !d.positional {
+		// Come back to where the writer is.
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := s.Seek(d.off, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return end, nil
+	}
+
+	return 0, errors.New("backend doesn't report its size")
+}
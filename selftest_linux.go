@@ -0,0 +1,165 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The checks of SelfTest, in the order they run.
+const (
+	CheckCapabilities   = "capabilities"
+	CheckAlignedWrite   = "aligned write"
+	CheckUnalignedWrite = "unaligned write"
+	CheckTail           = "tail"
+	CheckReadBack       = "read back"
+)
+
+// CheckResult is the outcome of one check of SelfTest, Err nil if it passed.
+type CheckResult struct {
+	Name    string
+	Err     error
+	Elapsed time.Duration
+}
+
+// Report is the outcome of SelfTest.
+type Report struct {
+	Dir string
+
+	// Capabilities is what ProbeCapabilities found for Dir, the probed
+	// alignment included.
+	Capabilities Capabilities
+
+	// BlockSize and AlignmentSource are those of the writer of the test.
+	BlockSize       int
+	AlignmentSource AlignmentSource
+
+	// Checks holds the checks run, in order. The first failure stops the
+	// test, the checks after it are missing.
+	Checks []CheckResult
+}
+
+// OK reports whether every check ran and passed.
+func (r Report) OK() bool {
+	if len(r.Checks) == 0 || r.Checks[len(r.Checks)-1].Name != CheckReadBack {
+		return false
+	}
+	for _, c := range r.Checks {
+		if c.Err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SelfTest checks that direct I/O works in dir the way the writers use it,
+// so a service can validate it at start-up and fall back to buffered I/O
+// early. On an anonymous file in dir, it writes aligned data through the
+// zero-copy path, then unaligned data through the buffer, closes the writer
+// to get the partial tail written, and reads it all back with O_DIRECT. The
+// error is that of the first failed check; the report says what passed.
+func SelfTest(dir string) (Report, error) {
+	r := Report{Dir: dir}
+
+	check := func(name string, fn func() error) error {
+		start := time.Now()
+		err := fn()
+		r.Checks = append(r.Checks, CheckResult{Name: name, Err: err, Elapsed: time.Since(start)})
+		if err != nil {
+			return fmt.Errorf("self-test %s: %w", name, err)
+		}
+
+		return nil
+	}
+
+	err := check(CheckCapabilities, func() (err error) {
+		r.Capabilities, err = ProbeCapabilities(dir, true)
+		if err == nil && !r.Capabilities.Open {
+			err = ErrFSNoDIOSupport
+		}
+
+		return err
+	})
+	if err != nil {
+		return r, err
+	}
+
+	f, err := openProbeFile(dir)
+	if err != nil {
+		return r, err
+	}
+	defer f.Close()
+
+	d, err := New(f)
+	if err != nil {
+		return r, err
+	}
+	defer d.Close()
+	r.BlockSize, r.AlignmentSource = d.BlockSize(), d.AlignmentSource()
+
+	// A buffer worth of blocks aligned in memory, which skips the buffer,
+	// then an odd size at an odd address, leaving a partial last block.
+	aligned, err := allocAlignedBuf(d.BlockSize(), d.Available())
+	if err != nil {
+		return r, err
+	}
+	unaligned := make([]byte, d.BlockSize()+1001)[1:]
+	for i := range aligned {
+		aligned[i] = byte(i % 251)
+	}
+	for i := range unaligned {
+		unaligned[i] = byte(i % 239)
+	}
+	want := append(append([]byte{}, aligned...), unaligned...)
+
+	if err := check(CheckAlignedWrite, func() error {
+		if _, err := d.Write(aligned); err != nil {
+			return err
+		}
+		if d.Buffered() != 0 {
+			return errors.New("aligned data was buffered")
+		}
+
+		return nil
+	}); err != nil {
+		return r, err
+	}
+
+	if err := check(CheckUnalignedWrite, func() error {
+		_, err := d.Write(unaligned)
+		return err
+	}); err != nil {
+		return r, err
+	}
+
+	if err := check(CheckTail, d.Close); err != nil {
+		return r, err
+	}
+
+	err = check(CheckReadBack, func() error {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() != int64(len(want)) {
+			return fmt.Errorf("file is %d bytes, want %d", info.Size(), len(want))
+		}
+
+		got := make([]byte, len(want))
+		if _, err := ReadFullAt(f, got, 0); err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			return errors.New("data read back differs from the data written")
+		}
+
+		return nil
+	})
+
+	return r, err
+}
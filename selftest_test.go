@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	r, err := SelfTest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OK() {
+		t.Fatalf("report not OK: %+v", r)
+	}
+	if r.BlockSize == 0 || r.Capabilities.ProbedAlign == 0 {
+		t.Fatalf("incomplete report: %+v", r)
+	}
+
+	r, err = SelfTest(filepath.Join(dir, "missing"))
+	if err == nil || r.OK() {
+		t.Fatalf("self-test of a missing directory passed: %+v", r)
+	}
+}
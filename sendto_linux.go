@@ -0,0 +1,149 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"io"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// SendTo writes the n bytes of the file at off to w, typically a socket of
+// a server sending large cold files. On a socket the block aligned part of
+// the range is handed to sendfile(2), which on an O_DIRECT file reads
+// straight from the device rather than through the page cache. The unaligned
+// head and tail, and everything when w isn't a socket or the kernel refuses,
+// are read with aligned preads and written with w.Write. It doesn't use or
+// move the offset of Read. It returns the number of bytes written and
+// io.ErrUnexpectedEOF if the file ends before off+n.
+func (d *DirectReader) SendTo(w io.Writer, off, n int64) (int64, error) {
+	if off < 0 || n < 0 {
+		return 0, errNegativePosition
+	}
+
+	unit := int64(d.offAlign)
+	start := off
+	if rem := start % unit; rem != 0 {
+		start += unit - rem
+	}
+	end := off + n
+	end -= end % unit
+
+	var sent int64
+
+	if c, ok := w.(syscall.Conn); ok && start < end {
+		// Head, up to the first aligned offset.
+		m, err := d.sendCopy(w, off, start-off)
+		sent += m
+		if err != nil {
+			return sent, err
+		}
+
+		m, err = d.sendFile(c, start, end-start)
+		sent += m
+		if err != nil {
+			return sent, err
+		}
+	}
+
+	m, err := d.sendCopy(w, off+sent, n-sent)
+	sent += m
+
+	return sent, err
+}
+
+// sendFile sends the aligned n bytes of the file at off to the socket behind
+// c with sendfile(2). It stops early, without an error, when the kernel
+// can't do it, leaving the rest to sendCopy.
+func (d *DirectReader) sendFile(c syscall.Conn, off, n int64) (int64, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return 0, nil
+	}
+
+	var sent int64
+	for sent < n {
+		var (
+			m    int
+			serr error
+		)
+		pos := off + sent
+		err := rc.Write(func(fd uintptr) bool {
+			m, serr = unix.Sendfile(int(fd), int(d.f.Fd()), &pos, int(n-sent))
+			return serr != unix.EAGAIN
+		})
+		if err != nil {
+			return sent, err
+		}
+
+		switch serr {
+		case nil:
+		case unix.EINTR:
+			continue
+		case unix.EINVAL, unix.ENOSYS, unix.EOPNOTSUPP, unix.ENOTSOCK:
+			return sent, nil
+		default:
+			return sent, serr
+		}
+		if m == 0 {
+			// The file ended, sendCopy reports it.
+			return sent, nil
+		}
+		sent += int64(m)
+	}
+
+	return sent, nil
+}
+
+// sendCopy writes the n bytes of the file at off to w through an aligned
+// buffer, reading the aligned range covering them.
+func (d *DirectReader) sendCopy(w io.Writer, off, n int64) (int64, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+
+	unit := int64(d.offAlign)
+	pos := off - off%unit
+
+	size := int64(alignUp(defaultCopyBufSize, d.blockSize))
+	if span := int64(alignUp(int(off+n-pos), d.blockSize)); span < size {
+		size = span
+	}
+	buf, err := allocAlignedBuf(d.blockSize, int(size))
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int64
+	for sent < n {
+		m, err := pread(d.f, buf, pos)
+		if err != nil {
+			return sent, err
+		}
+
+		// Write the part of the chunk that is within the range.
+		head := off + sent - pos
+		if int64(m) <= head {
+			return sent, io.ErrUnexpectedEOF
+		}
+		chunk := buf[head:m]
+		if rest := n - sent; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+
+		k, err := w.Write(chunk)
+		sent += int64(k)
+		if err != nil {
+			return sent, err
+		}
+		pos += int64(m)
+
+		if m < len(buf) && sent < n {
+			return sent, io.ErrUnexpectedEOF
+		}
+	}
+
+	return sent, nil
+}
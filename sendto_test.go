@@ -0,0 +1,76 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSendTo(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 3<<20+17)
+	defer f.Close()
+
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	for _, tc := range []struct{ off, n int64 }{
+		{0, 1 << 20},
+		{4097, 2<<20 + 5},
+		{10, 100},
+		{3<<20 - 3, 20},
+	} {
+		want := data[tc.off : tc.off+tc.n]
+
+		var buf bytes.Buffer
+		if m, err := r.SendTo(&buf, tc.off, tc.n); m != tc.n || err != nil {
+			t.Fatalf("SendTo(%d, %d) to a buffer returned %d, %v", tc.off, tc.n, m, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("SendTo(%d, %d) sent the wrong bytes to a buffer", tc.off, tc.n)
+		}
+
+		got := make(chan []byte)
+		go func() {
+			c, err := ln.Accept()
+			if err != nil {
+				got <- nil
+				return
+			}
+			b, _ := io.ReadAll(c)
+			c.Close()
+			got <- b
+		}()
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := r.SendTo(conn, tc.off, tc.n)
+		conn.Close()
+		if m != tc.n || err != nil {
+			t.Fatalf("SendTo(%d, %d) to a socket returned %d, %v", tc.off, tc.n, m, err)
+		}
+		if b := <-got; !bytes.Equal(b, want) {
+			t.Fatalf("SendTo(%d, %d) sent the wrong bytes to a socket", tc.off, tc.n)
+		}
+	}
+
+	if _, err := r.SendTo(io.Discard, int64(len(data))-10, 20); err != io.ErrUnexpectedEOF {
+		t.Errorf("SendTo past the end returned %v, want io.ErrUnexpectedEOF", err)
+	}
+}
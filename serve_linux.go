@@ -0,0 +1,102 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+)
+
+// ServeContentDirect replies to r with the content of f, opened with
+// O_DIRECT, like http.ServeContent, range requests and conditional headers
+// included, so huge cold files can be served without evicting what is hot
+// in the page cache. The ranges are read with aligned preads and written
+// with SendTo, which uses sendfile(2) when w gives access to its socket by
+// implementing syscall.Conn; the ResponseWriter of net/http doesn't. The
+// name and modification time of f are those of the reply.
+func ServeContentDirect(w http.ResponseWriter, r *http.Request, f *os.File) {
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	d, err := NewReader(f)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer d.Close()
+
+	c := &contentReader{r: d, size: info.Size()}
+	http.ServeContent(&contentResponse{ResponseWriter: w, c: c}, r, info.Name(), info.ModTime(), c)
+}
+
+// contentReader is the content of ServeContentDirect. pos is where the next
+// Read starts.
+type contentReader struct {
+	r    *DirectReader
+	size int64
+	pos  int64
+}
+
+func (c *contentReader) Read(p []byte) (int, error) {
+	if _, err := c.r.Seek(c.pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := c.r.Read(p)
+	c.pos += int64(n)
+
+	return n, err
+}
+
+func (c *contentReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.pos
+	case io.SeekEnd:
+		offset += c.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errNegativePosition
+	}
+	c.pos = offset
+
+	return offset, nil
+}
+
+// contentResponse sends the ranges http.ServeContent copies from the
+// contentReader with SendTo.
+type contentResponse struct {
+	http.ResponseWriter
+	c *contentReader
+}
+
+// ReadFrom is what io.CopyN in http.ServeContent ends up calling, with the
+// contentReader limited to the length of the range.
+func (w *contentResponse) ReadFrom(src io.Reader) (int64, error) {
+	lr, ok := src.(*io.LimitedReader)
+	if !ok || lr.R != w.c {
+		return io.Copy(w.ResponseWriter, src)
+	}
+
+	n, err := w.c.r.SendTo(w.ResponseWriter, w.c.pos, max(0, min(lr.N, w.c.size-w.c.pos)))
+	w.c.pos += n
+	lr.N -= n
+
+	return n, err
+}
+
+// Unwrap returns the ResponseWriter, for http.ResponseController.
+func (w *contentResponse) Unwrap() http.ResponseWriter { return w.ResponseWriter }
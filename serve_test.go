@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeContentDirect(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 100000)
+	defer f.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeContentDirect(w, r, f)
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		rng        string
+		status     int
+		start, end int
+	}{
+		{"", http.StatusOK, 0, len(data)},
+		{"bytes=1000-9999", http.StatusPartialContent, 1000, 10000},
+		{"bytes=4096-8191", http.StatusPartialContent, 4096, 8192},
+		{"bytes=-777", http.StatusPartialContent, len(data) - 777, len(data)},
+	} {
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.rng != "" {
+			req.Header.Set("Range", tc.rng)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != tc.status || !bytes.Equal(body, data[tc.start:tc.end]) {
+			t.Fatalf("range %q: got status %d, %d bytes", tc.rng, resp.StatusCode, len(body))
+		}
+	}
+
+	// Several ranges come as a multipart body.
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=10-20,50000-50100")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range [][2]int{{10, 21}, {50000, 50101}} {
+		if !bytes.Contains(body, data[part[0]:part[1]]) {
+			t.Fatalf("multipart body misses the range %v", part)
+		}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("multipart: got status %d", resp.StatusCode)
+	}
+}
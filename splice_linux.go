@@ -0,0 +1,194 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// pipeFile is the subset of *os.File needed to splice from a pipe.
+type pipeFile interface {
+	syscall.Conn
+	Stat() (os.FileInfo, error)
+}
+
+// spliceFrom moves the block aligned part of the data currently available in
+// the pipe r into the file with splice(2). It moves nothing when less than a
+// block is available. Sockets go through spliceConn. When r is neither or the
+// kernel can't splice into the file, d.noSplice is set so the caller sticks
+// to the buffered path.
+func (d *DirectIO) spliceFrom(r io.Reader) (int64, error) {
+	// io.Copy hands *os.File sources over wrapped in a type hiding WriteTo,
+	// so look for the methods rather than for *os.File itself.
+	p, ok := r.(pipeFile)
+	if !ok {
+		if c, ok := r.(syscall.Conn); ok {
+			return d.spliceConn(c)
+		}
+		d.noSplice = true
+		return 0, nil
+	}
+
+	info, err := p.Stat()
+	if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		d.noSplice = true
+		return 0, nil
+	}
+
+	rc, err := p.SyscallConn()
+	if err != nil {
+		d.noSplice = true
+		return 0, nil
+	}
+
+	var (
+		n    int64
+		serr error
+	)
+	err = rc.Read(func(fd uintptr) bool {
+		avail, err := unix.IoctlGetInt(int(fd), unix.TIOCINQ) // FIONREAD
+		if err != nil {
+			serr = err
+			return true
+		}
+
+		want := avail - avail%d.blockSize
+		if want == 0 {
+			return true
+		}
+
+		n, serr = unix.Splice(int(fd), nil, int(d.f.Fd()), nil, want, unix.SPLICE_F_MOVE)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	switch serr {
+	case nil:
+	case unix.EAGAIN:
+		return 0, nil
+	case unix.EINVAL, unix.ENOSYS, unix.EOPNOTSUPP, unix.ENOTTY:
+		d.noSplice = true
+		return 0, nil
+	default:
+		return 0, serr
+	}
+
+	if n < 0 {
+		n = 0
+	}
+	d.spliced(n)
+
+	return n, nil
+}
+
+// spliced accounts for n bytes spliced into the file, as writeOut does for
+// the bytes it writes.
+func (d *DirectIO) spliced(n int64) {
+	d.off += n
+	d.flushed += n
+}
+
+// spliceConn moves data from the socket behind c into the file through a
+// pipe, as splice(2) needs one end to be a pipe. Up to a buffer's worth is
+// taken from the socket per call; its block aligned part goes on to the
+// file and the rest is read into the empty buffer, to be completed by the
+// buffered path. Nothing is moved at the end of the stream, so that the
+// caller's next read sees it.
+func (d *DirectIO) spliceConn(c syscall.Conn) (int64, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		d.noSplice = true
+		return 0, nil
+	}
+
+	var isSocket bool
+	rc.Control(func(fd uintptr) {
+		var st unix.Stat_t
+		isSocket = unix.Fstat(int(fd), &st) == nil && st.Mode&unix.S_IFMT == unix.S_IFSOCK
+	})
+	if !isSocket {
+		d.noSplice = true
+		return 0, nil
+	}
+
+	if d.pipe == nil {
+		var p [2]int
+		if err := unix.Pipe2(p[:], unix.O_CLOEXEC); err != nil {
+			d.noSplice = true
+			return 0, nil
+		}
+		// Best effort, a pipe holds 64KB by default.
+		unix.FcntlInt(uintptr(p[1]), unix.F_SETPIPE_SZ, len(d.buf))
+		d.pipe = p[:]
+	}
+
+	var (
+		in   int64
+		serr error
+	)
+	err = rc.Read(func(fd uintptr) bool {
+		in, serr = unix.Splice(int(fd), nil, d.pipe[1], nil, len(d.buf), unix.SPLICE_F_MOVE|unix.SPLICE_F_NONBLOCK)
+		return serr != unix.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	switch serr {
+	case nil:
+	case unix.EINVAL, unix.ENOSYS, unix.EOPNOTSUPP:
+		d.noSplice = true
+		return 0, nil
+	default:
+		return 0, serr
+	}
+
+	var moved int64
+	for want := in - in%int64(d.blockSize); moved < want; {
+		m, err := unix.Splice(d.pipe[0], nil, int(d.f.Fd()), nil, int(want-moved), unix.SPLICE_F_MOVE)
+		if err == unix.EINTR {
+			continue
+		}
+		if err == unix.EINVAL || err == unix.ENOSYS || err == unix.EOPNOTSUPP {
+			// Leave the rest to the buffered path.
+			d.noSplice = true
+			break
+		}
+		if err != nil {
+			d.spliced(moved)
+			return moved, err
+		}
+		moved += m
+	}
+	d.spliced(moved)
+
+	// What is left in the pipe fits in the buffer, which is empty.
+	for d.n < int(in-moved) {
+		m, err := unix.Read(d.pipe[0], d.buf[d.n:in-moved])
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return moved + int64(d.n), err
+		}
+		d.n += m
+	}
+
+	return in, nil
+}
+
+// closePipe releases the pipe used to splice from sockets.
+func (d *DirectIO) closePipe() {
+	if d.pipe != nil {
+		unix.Close(d.pipe[0])
+		unix.Close(d.pipe[1])
+		d.pipe = nil
+	}
+}
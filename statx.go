@@ -12,31 +12,89 @@ import (
 var ErrFSNoDIOSupport = errors.New("filesystem does not expose Direct I/O alignment")
 
 func DIOMemAlign(path string) (uint32, error) {
+	memAlign, _, err := DIOAlignment(path)
+
+	return memAlign, err
+}
+
+// DIOAlignment returns both direct I/O alignments the kernel reports for
+// path: memAlign for user buffers and offsetAlign for file offsets and I/O
+// lengths. They differ on some filesystems, btrfs for instance.
+func DIOAlignment(path string) (memAlign, offsetAlign uint32, err error) {
+	return dioAlignment(unix.AT_FDCWD, path, 0)
+}
+
+// DIOMemAlignFd is DIOMemAlign for an open file descriptor. It works for
+// files that were renamed or unlinked, and for O_TMPFILE files.
+func DIOMemAlignFd(fd uintptr) (uint32, error) {
+	memAlign, _, err := DIOAlignmentFd(fd)
+
+	return memAlign, err
+}
+
+// DIOAlignmentFd is DIOAlignment for an open file descriptor.
+func DIOAlignmentFd(fd uintptr) (memAlign, offsetAlign uint32, err error) {
+	return dioAlignment(int(fd), "", unix.AT_EMPTY_PATH)
+}
+
+func dioAlignment(dirfd int, path string, extraFlags int) (memAlign, offsetAlign uint32, err error) {
 	var stx unix.Statx_t
 
 	// Ask statx for direct I/O info. On Linux ≥6.1, STATX_DIOALIGN returns
 	// stx.Dio_mem_align and stx.Dio_offset_align.
 	mask := unix.STATX_DIOALIGN
 
-	flags := unix.AT_STATX_SYNC_AS_STAT | unix.AT_NO_AUTOMOUNT
-	if err := unix.Statx(unix.AT_FDCWD, path, flags, mask, &stx); err != nil {
+	flags := unix.AT_STATX_SYNC_AS_STAT | unix.AT_NO_AUTOMOUNT | extraFlags
+	if err := unix.Statx(dirfd, path, flags, mask, &stx); err != nil {
 		switch {
 		case errors.Is(err, unix.ENOSYS),
 			errors.Is(err, unix.EOPNOTSUPP),
 			errors.Is(err, unix.ENOTSUP):
-			return 0, ErrFSNoDIOSupport
+			return 0, 0, ErrFSNoDIOSupport
 		}
-		return 0, err
+		return 0, 0, err
 	}
 
 	// Check which bits were actually filled by the kernel/FS.
 	if (stx.Mask & unix.STATX_DIOALIGN) == 0 {
-		return 0, ErrFSNoDIOSupport
+		return 0, 0, ErrFSNoDIOSupport
+	}
+
+	if stx.Dio_mem_align == 0 || stx.Dio_offset_align == 0 {
+		return 0, 0, ErrFSNoDIOSupport
+	}
+
+	return stx.Dio_mem_align, stx.Dio_offset_align, nil
+}
+
+// statxAlignment returns the larger of the two statx direct I/O alignments
+// of path, or 0 if the kernel doesn't report them.
+func statxAlignment(path string) int {
+	memAlign, offsetAlign, err := DIOAlignment(path)
+	if err != nil {
+		return 0
 	}
 
-	if stx.Dio_mem_align == 0 {
-		return 0, ErrFSNoDIOSupport
+	return int(max(memAlign, offsetAlign))
+}
+
+// statxAlignmentFd is statxAlignment for an open file descriptor.
+func statxAlignmentFd(fd uintptr) int {
+	memAlign, offsetAlign, err := DIOAlignmentFd(fd)
+	if err != nil {
+		return 0
+	}
+
+	return int(max(memAlign, offsetAlign))
+}
+
+// offsetAlignment returns the file offset alignment direct I/O on fd
+// requires, or 0 if the kernel doesn't report it.
+func offsetAlignment(fd uintptr) int {
+	_, offsetAlign, err := DIOAlignmentFd(fd)
+	if err != nil {
+		return 0
 	}
 
-	return stx.Dio_mem_align, nil
+	return int(offsetAlign)
 }
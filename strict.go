@@ -0,0 +1,94 @@
+package directio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotZeroCopy is matched by the *StrictAlignmentError a writer created
+// with WithStrictAlignment returns for a write it would have to copy.
+var ErrNotZeroCopy = errors.New("write can't take the zero-copy path")
+
+// StrictAlignmentError is returned by a writer created with
+// WithStrictAlignment for a slice that can't be written without copying it
+// to the buffer. errors.Is(err, ErrNotZeroCopy) reports true for it.
+type StrictAlignmentError struct {
+	// Len is the length of the slice and BlockSize the alignment of the
+	// writer. Misaligned reports that the slice doesn't start on a block
+	// boundary, Short that its length isn't a multiple of the block size.
+	Len        int
+	BlockSize  int
+	Misaligned bool
+	Short      bool
+
+	// Buffered is the size of the partial block ReadFrom left in the
+	// buffer, which the slice can't follow without being copied.
+	Buffered int
+}
+
+func (e *StrictAlignmentError) Error() string {
+	var why string
+	switch {
+	case e.Buffered > 0:
+		return fmt.Sprintf("write of %d bytes can't take the zero-copy path: %d bytes of a partial block are buffered", e.Len, e.Buffered)
+	case e.Misaligned && e.Short:
+		why = "misaligned and not a multiple of"
+	case e.Misaligned:
+		why = "misaligned to"
+	default:
+		why = "not a multiple of"
+	}
+
+	return fmt.Sprintf("write of %d bytes can't take the zero-copy path: %s the block size %d", e.Len, why, e.BlockSize)
+}
+
+func (e *StrictAlignmentError) Is(target error) bool { return target == ErrNotZeroCopy }
+
+// WithStrictAlignment makes Write refuse, with a *StrictAlignmentError,
+// every slice that can't be written straight from memory, instead of
+// silently copying it to the buffer: slices must start on a block boundary
+// and their length be a multiple of the block size, see BlockSize. Nothing
+// is buffered then, so each Write goes to the file before returning. A
+// write going past the budget of WithMaxSize is refused whole.
+//
+// ReadFrom, which reads into the buffer without an extra copy, and Close
+// are unchanged.
+func WithStrictAlignment(enabled bool) Option {
+	return func(d *DirectIO) {
+		d.strict = enabled
+	}
+}
+
+// writeStrict is writeData for WithStrictAlignment.
+func (d *DirectIO) writeStrict(p []byte) (int, error) {
+	misaligned := align(p, d.blockSize) != 0
+	short := len(p)%d.blockSize != 0
+	if (misaligned || short) && len(p) > 0 {
+		return 0, &StrictAlignmentError{Len: len(p), BlockSize: d.blockSize, Misaligned: misaligned, Short: short}
+	}
+
+	if q := d.quota(); q >= 0 && int64(len(p)) > q {
+		return 0, d.quotaError()
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// ReadFrom may have left data in the buffer, write it out first.
+	if err := d.flushAligned(); err != nil {
+		return 0, err
+	}
+	if d.n != 0 {
+		return 0, &StrictAlignmentError{Len: len(p), BlockSize: d.blockSize, Buffered: d.n}
+	}
+
+	n, err := d.writeFile(p)
+	d.fast.direct += int64(n)
+	if err != nil {
+		d.err = err
+	}
+	d.accept(p[:n])
+	d.report()
+
+	return n, err
+}
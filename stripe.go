@@ -0,0 +1,175 @@
+package directio
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// StripedWriter spreads a stream over several files, RAID-0 style: the
+// stream is cut into chunks of stripeSize bytes, written to the files
+// round-robin. With each file on its own drive, one stream can use the
+// bandwidth of all of them. StripedReader puts the stream back together.
+type StripedWriter struct {
+	ws         []*DirectIO
+	stripeSize int
+
+	// cur is the index of the file the current stripe goes to, pos how much
+	// of that stripe was written.
+	cur int
+	pos int
+
+	isClosed bool
+}
+
+// stripeBlockSize returns the largest alignment of files, which stripe
+// sizes must be a multiple of.
+func stripeBlockSize(files []*os.File) int {
+	blockSize := 0
+	for _, f := range files {
+		if a, _ := fdAlignment(f.Fd()); a > blockSize {
+			blockSize = a
+		}
+	}
+
+	return blockSize
+}
+
+// NewStripedWriter returns a writer striping over files, which must be
+// opened with O_DIRECT. stripeSize must be a multiple of their block size.
+func NewStripedWriter(files []*os.File, stripeSize int) (*StripedWriter, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files to stripe over")
+	}
+	if stripeSize <= 0 || stripeSize%stripeBlockSize(files) != 0 {
+		return nil, errors.New("stripe size must be a multiple of the block size")
+	}
+
+	ws := make([]*DirectIO, len(files))
+	for i, f := range files {
+		w, err := NewSize(f, stripeSize)
+		if err != nil {
+			return nil, err
+		}
+		ws[i] = w
+	}
+
+	return &StripedWriter{ws: ws, stripeSize: stripeSize}, nil
+}
+
+// Write writes p across the files.
+func (s *StripedWriter) Write(p []byte) (nn int, err error) {
+	if s.isClosed {
+		return 0, errors.New("the writer is closed")
+	}
+
+	for len(p) > 0 {
+		chunk := p
+		if rest := s.stripeSize - s.pos; len(chunk) > rest {
+			chunk = chunk[:rest]
+		}
+
+		n, err := s.ws[s.cur].Write(chunk)
+		nn += n
+		if err != nil {
+			return nn, err
+		}
+		p = p[n:]
+
+		s.pos += n
+		if s.pos == s.stripeSize {
+			s.cur = (s.cur + 1) % len(s.ws)
+			s.pos = 0
+		}
+	}
+
+	return nn, nil
+}
+
+// Close closes the writers of all files and returns the first error. It
+// doesn't close the files.
+func (s *StripedWriter) Close() error {
+	if s.isClosed {
+		return errors.New("the writer is already closed")
+	}
+
+	s.isClosed = true
+
+	var first error
+	for _, w := range s.ws {
+		if err := w.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// StripedReader reads back a stream written by StripedWriter.
+type StripedReader struct {
+	files      []*os.File
+	stripeSize int
+
+	buf    []byte
+	pos    int
+	stripe int64
+	done   bool
+}
+
+// NewStripedReader returns a reader over files, in the order they were
+// given to NewStripedWriter, with the same stripeSize. The files may be
+// opened with O_DIRECT.
+func NewStripedReader(files []*os.File, stripeSize int) (*StripedReader, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files to stripe over")
+	}
+
+	blockSize := stripeBlockSize(files)
+	if stripeSize <= 0 || stripeSize%blockSize != 0 {
+		return nil, errors.New("stripe size must be a multiple of the block size")
+	}
+
+	buf, err := allocAlignedBuf(blockSize, stripeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StripedReader{files: files, stripeSize: stripeSize, buf: buf[:0]}, nil
+}
+
+// next reads the next stripe. Stripes are filled in order, so the first
+// short one is the last one.
+func (s *StripedReader) next() error {
+	n := int64(len(s.files))
+	f := s.files[s.stripe%n]
+	off := s.stripe / n * int64(s.stripeSize)
+
+	m, err := pread(f, s.buf[:s.stripeSize], off)
+	if err != nil {
+		return err
+	}
+
+	s.buf = s.buf[:m]
+	s.pos = 0
+	s.stripe++
+	s.done = m < s.stripeSize
+
+	return nil
+}
+
+// Read reads the stream into p.
+func (s *StripedReader) Read(p []byte) (int, error) {
+	for s.pos == len(s.buf) {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.buf[s.pos:])
+	s.pos += n
+
+	return n, nil
+}
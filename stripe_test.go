@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestStriped(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	const stripeSize = 65536
+
+	for _, size := range []int{0, 100, stripeSize, 3*stripeSize + 5000, 10 * stripeSize} {
+		var files []*os.File
+		for i := 0; i < 3; i++ {
+			f := tmpFile(t, dir, fmt.Sprintf("stripe-%d-%d", size, i))
+			defer f.Close()
+			files = append(files, f)
+		}
+
+		w, err := NewStripedWriter(files, stripeSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		for p := data; len(p) > 0; {
+			n := min(len(p), 10000)
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var in []*os.File
+		for _, f := range files {
+			r, err := os.OpenFile(f.Name(), os.O_RDONLY|O_DIRECT, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			in = append(in, r)
+		}
+
+		r, err := NewStripedReader(in, stripeSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("size %d: read back %d bytes", size, len(got))
+		}
+	}
+}
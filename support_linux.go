@@ -0,0 +1,138 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// SupportLevel grades how well a filesystem supports O_DIRECT.
+type SupportLevel int
+
+const (
+	// SupportUnknown is reported for filesystems missing from the quirks table.
+	SupportUnknown SupportLevel = iota
+
+	// SupportNative means O_DIRECT bypasses the page cache as intended.
+	SupportNative
+
+	// SupportEmulated means O_DIRECT is accepted, but data still goes
+	// through a cache of the filesystem.
+	SupportEmulated
+
+	// SupportDepends means the behavior depends on another layer, like the
+	// upper filesystem of an overlay or the server of a FUSE mount.
+	SupportDepends
+
+	// SupportNone means opening files with O_DIRECT fails.
+	SupportNone
+)
+
+func (l SupportLevel) String() string {
+	switch l {
+	case SupportNative:
+		return "native"
+	case SupportEmulated:
+		return "emulated"
+	case SupportDepends:
+		return "depends"
+	case SupportNone:
+		return "none"
+	default:
+		return "unknown"
+	}
+}
+
+// Support is the verdict of SupportsDirectIO.
+type Support struct {
+	Level SupportLevel
+
+	// FSType is the name of the filesystem, or its magic number in hex if
+	// it isn't in the quirks table.
+	FSType string
+
+	// Reason explains the verdict.
+	Reason string
+}
+
+// zfsSuperMagic is the f_type of ZFS, which x/sys/unix doesn't define.
+const zfsSuperMagic = 0x2fc12fc1
+
+type fsQuirk struct {
+	name   string
+	level  SupportLevel
+	reason string
+}
+
+// fsQuirks maps the f_type reported by statfs to what is known about
+// O_DIRECT on that filesystem.
+var fsQuirks = map[int64]fsQuirk{
+	unix.EXT4_SUPER_MAGIC:      {"ext4", SupportNative, "O_DIRECT is fully supported"},
+	unix.XFS_SUPER_MAGIC:       {"xfs", SupportNative, "O_DIRECT is fully supported"},
+	unix.F2FS_SUPER_MAGIC:      {"f2fs", SupportNative, "O_DIRECT is supported, but falls back to buffered I/O on compressed files"},
+	unix.BTRFS_SUPER_MAGIC:     {"btrfs", SupportNative, "O_DIRECT is supported, but falls back to buffered I/O on compressed files"},
+	unix.BCACHEFS_SUPER_MAGIC:  {"bcachefs", SupportNative, "O_DIRECT is supported"},
+	zfsSuperMagic:              {"zfs", SupportEmulated, "ZFS before 2.3 accepts O_DIRECT but still caches data in the ARC"},
+	unix.TMPFS_MAGIC:           {"tmpfs", SupportEmulated, "tmpfs rejects O_DIRECT before Linux 6.6, and data lives in memory either way"},
+	unix.RAMFS_MAGIC:           {"ramfs", SupportNone, "ramfs has no backing device"},
+	unix.NFS_SUPER_MAGIC:       {"nfs", SupportNative, "O_DIRECT bypasses the client cache only, alignment isn't enforced and the server may still cache"},
+	unix.CIFS_SUPER_MAGIC:      {"cifs", SupportNative, "O_DIRECT bypasses the client cache only, the server may still cache"},
+	unix.SMB2_SUPER_MAGIC:      {"smb2", SupportNative, "O_DIRECT bypasses the client cache only, the server may still cache"},
+	unix.CEPH_SUPER_MAGIC:      {"ceph", SupportNative, "O_DIRECT bypasses the client cache only"},
+	unix.OVERLAYFS_SUPER_MAGIC: {"overlayfs", SupportDepends, "O_DIRECT is passed to the upper layer, which decides"},
+	unix.FUSE_SUPER_MAGIC:      {"fuse", SupportDepends, "O_DIRECT support is up to the FUSE server"},
+	unix.V9FS_MAGIC:            {"9p", SupportDepends, "O_DIRECT support depends on the cache mode of the mount"},
+}
+
+// SupportsDirectIO reports whether O_DIRECT works for files at path, based
+// on the type of the filesystem holding it. If path is an existing file, the
+// verdict is confirmed by opening it with O_DIRECT.
+func SupportsDirectIO(path string) (Support, error) {
+	info, statErr := os.Stat(path)
+	if statErr == nil && isBlockDevice(info) {
+		return Support{Level: SupportNative, FSType: "block device", Reason: "raw block devices support O_DIRECT"}, nil
+	}
+
+	// Ensure we check the directory if the file doesn't exist yet
+	checkPath := path
+	if statErr != nil || !info.IsDir() {
+		checkPath = filepath.Dir(path)
+	}
+
+	var stat unix.Statfs_t
+	if err := unix.Statfs(checkPath, &stat); err != nil {
+		return Support{}, err
+	}
+
+	s := Support{
+		Level:  SupportUnknown,
+		FSType: fmt.Sprintf("0x%x", stat.Type),
+		Reason: "unknown filesystem",
+	}
+	if q, ok := fsQuirks[int64(stat.Type)]; ok {
+		s = Support{Level: q.level, FSType: q.name, Reason: q.reason}
+	}
+
+	if statErr == nil && info.Mode().IsRegular() {
+		f, err := os.OpenFile(path, os.O_RDONLY|O_DIRECT, 0)
+		switch {
+		case err == nil:
+			f.Close()
+			if s.Level == SupportNone || s.Level == SupportUnknown {
+				s.Level = SupportNative
+				s.Reason += ", yet opening with O_DIRECT succeeded"
+			}
+		case errors.Is(err, unix.EINVAL):
+			s.Level = SupportNone
+			s.Reason += ", opening with O_DIRECT failed"
+		}
+	}
+
+	return s, nil
+}
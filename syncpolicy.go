@@ -0,0 +1,82 @@
+package directio
+
+// SyncPolicy sets when the writer calls Sync on the file. The zero value
+// syncs in Close after writing an unaligned tail, which unlike O_DIRECT
+// writes goes through the page cache.
+type SyncPolicy struct {
+	mode  syncMode
+	every int64
+}
+
+type syncMode int
+
+const (
+	syncDefault syncMode = iota
+	syncNever
+	syncOnClose
+	syncAlways
+	syncEvery
+)
+
+var (
+	// SyncNever never syncs the file, leaving it to the caller.
+	SyncNever = SyncPolicy{mode: syncNever}
+
+	// SyncOnClose syncs the file once, at the end of Close.
+	SyncOnClose = SyncPolicy{mode: syncOnClose}
+
+	// SyncAlways syncs the file after every write to it, so each flush is
+	// durable when Write returns.
+	SyncAlways = SyncPolicy{mode: syncAlways}
+)
+
+// SyncEvery syncs the file every time n more bytes were written to it since
+// the last sync, and at the end of Close.
+func SyncEvery(n int64) SyncPolicy {
+	if n <= 0 {
+		return SyncAlways
+	}
+
+	return SyncPolicy{mode: syncEvery, every: n}
+}
+
+// WithSyncPolicy sets when the writer syncs the file.
+func WithSyncPolicy(p SyncPolicy) Option {
+	return func(d *DirectIO) {
+		d.syncPolicy = p
+	}
+}
+
+// syncAfterWrite applies the sync policy after n bytes were written.
+func (d *DirectIO) syncAfterWrite(n int) error {
+	switch d.syncPolicy.mode {
+	case syncAlways:
+		return d.sync()
+	case syncEvery:
+		d.unsynced += int64(n)
+		if d.unsynced >= d.syncPolicy.every {
+			d.unsynced = 0
+			return d.sync()
+		}
+	}
+
+	return nil
+}
+
+// syncTail syncs the file after Close wrote the tail, unless a policy
+// other than the default was set.
+func (d *DirectIO) syncTail() {
+	if d.syncPolicy.mode == syncDefault {
+		d.sync()
+	}
+}
+
+// syncOnClose reports whether the policy wants Close to end with a sync.
+func (d *DirectIO) syncOnClose() bool {
+	switch d.syncPolicy.mode {
+	case syncOnClose, syncAlways, syncEvery:
+		return true
+	}
+
+	return false
+}
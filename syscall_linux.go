@@ -5,7 +5,11 @@ package directio
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -36,6 +40,13 @@ func checkDirectIO(fd uintptr) error {
 	return ErrNotSetDirectIO
 }
 
+// appendMode reports whether fd has O_APPEND set.
+func appendMode(fd uintptr) bool {
+	flags, err := fcntl(fd, syscall.F_GETFL, 0)
+
+	return err == nil && flags&syscall.O_APPEND != 0
+}
+
 func setDirectIO(fd uintptr, dio bool) error {
 	flag, err := fcntl(fd, syscall.F_GETFL, 0)
 	if err != nil {
@@ -51,3 +62,106 @@ func setDirectIO(fd uintptr, dio bool) error {
 	_, err = fcntl(fd, syscall.F_SETFL, flag)
 	return err
 }
+
+// reopenDirect opens a new read-only O_DIRECT file description for the file
+// behind fd. It works for files without a usable name too.
+func reopenDirect(fd uintptr) (*os.File, error) {
+	return os.OpenFile(fmt.Sprintf("/proc/self/fd/%d", fd), os.O_RDONLY|O_DIRECT, 0)
+}
+
+// pread reads into buf at off with a single pread(2), retrying only on EINTR.
+// Unlike os.File.ReadAt it never issues a second read after a short one,
+// which on an O_DIRECT file would be unaligned. A short read means the end
+// of the file was reached.
+func pread(f *os.File, buf []byte, off int64) (int, error) {
+	for {
+		n, err := syscall.Pread(int(f.Fd()), buf, off)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, &os.PathError{Op: "pread", Path: f.Name(), Err: err}
+		}
+
+		return n, nil
+	}
+}
+
+// preadv reads into bufs at off with a single preadv(2), retrying only on
+// EINTR. Like pread, a short read means the end of the file was reached.
+func preadv(f *os.File, bufs [][]byte, off int64) (int, error) {
+	for {
+		n, err := unix.Preadv(int(f.Fd()), bufs, off)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, &os.PathError{Op: "preadv", Path: f.Name(), Err: err}
+		}
+
+		return n, nil
+	}
+}
+
+// pwrite writes buf at off with a single pwrite(2), retrying only on EINTR.
+func pwrite(f *os.File, buf []byte, off int64) (int, error) {
+	for {
+		n, err := syscall.Pwrite(int(f.Fd()), buf, off)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, &os.PathError{Op: "pwrite", Path: f.Name(), Err: err}
+		}
+
+		return n, nil
+	}
+}
+
+// copyRange copies up to size bytes from the start of in to the start of out
+// with copy_file_range(2). It returns how far it got; anything short of size
+// means the kernel couldn't (or could no longer) offload the copy.
+func copyRange(out, in *os.File, size int64) int64 {
+	var roff, woff int64
+
+	for roff < size {
+		n, err := unix.CopyFileRange(int(in.Fd()), &roff, int(out.Fd()), &woff, int(size-roff), 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n == 0 {
+			break
+		}
+	}
+
+	return roff
+}
+
+// nextDataExtent returns the data extent of f starting at or after off, as
+// reported by SEEK_DATA and SEEK_HOLE. data is -1 when only a hole is left.
+func nextDataExtent(f *os.File, off int64) (data, hole int64, err error) {
+	data, err = unix.Seek(int(f.Fd()), off, unix.SEEK_DATA)
+	if err == syscall.ENXIO {
+		return -1, -1, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	hole, err = unix.Seek(int(f.Fd()), data, unix.SEEK_HOLE)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return data, hole, nil
+}
+
+// dupFd duplicates fd with the close-on-exec flag set.
+func dupFd(fd uintptr) (uintptr, error) {
+	nfd, err := unix.FcntlInt(fd, unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return uintptr(nfd), nil
+}
@@ -5,11 +5,21 @@ package directio
 
 import (
 	"errors"
+	"io"
+	"os"
+)
+
+// O_DIRECT is 0 where direct I/O isn't supported, so files meant for it
+// open normally and the writers refuse them with ErrUnsupportedDirectIO.
+const (
+	O_DIRECT = 0
 )
 
 // ErrUnsupportedDirectIO is not supported
 var ErrUnsupportedDirectIO = errors.New("No DirectIO support")
 
+var ErrNotSetDirectIO = ErrUnsupportedDirectIO
+
 // stub
 func checkDirectIO(fd uintptr) error {
 	return ErrUnsupportedDirectIO
@@ -19,3 +29,134 @@ func checkDirectIO(fd uintptr) error {
 func setDirectIO(fd uintptr, dio bool) error {
 	return ErrUnsupportedDirectIO
 }
+
+// stub
+func appendMode(fd uintptr) bool {
+	return false
+}
+
+// stub
+func reopenDirect(fd uintptr) (*os.File, error) {
+	return nil, ErrUnsupportedDirectIO
+}
+
+// stub
+func pread(f *os.File, buf []byte, off int64) (int, error) {
+	return f.ReadAt(buf, off)
+}
+
+// stub
+func preadv(f *os.File, bufs [][]byte, off int64) (int, error) {
+	var n int
+	for _, buf := range bufs {
+		m, err := f.ReadAt(buf, off+int64(n))
+		n += m
+		if err != nil || m < len(buf) {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// stub
+func pwrite(f *os.File, buf []byte, off int64) (int, error) {
+	return f.WriteAt(buf, off)
+}
+
+// stub
+func (d *DirectIO) spliceFrom(r io.Reader) (int64, error) {
+	d.noSplice = true
+	return 0, nil
+}
+
+// stub
+func (d *DirectIO) closePipe() {}
+
+// stub
+func mapAdvisedBuf(blockSize, size int, advice []BufferAdvice) (buf, region []byte, err error) {
+	return nil, nil, ErrUnsupportedDirectIO
+}
+
+// stub
+func unmapBuf(region []byte) {}
+
+// stub
+func copyRange(out, in *os.File, size int64) int64 {
+	return 0
+}
+
+// stub
+func nextDataExtent(f *os.File, off int64) (data, hole int64, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if off >= info.Size() {
+		return -1, -1, nil
+	}
+
+	return off, info.Size(), nil
+}
+
+// stub
+func queryBlockDevice(fd uintptr) (blockDevice, error) {
+	return blockDevice{}, ErrUnsupportedDirectIO
+}
+
+// stub
+func discardDevice(fd uintptr, off, length int64) error {
+	return ErrUnsupportedDirectIO
+}
+
+// stub
+func offsetAlignment(fd uintptr) int {
+	return 0
+}
+
+// stub
+func pathSectorSizes(path string) (logical, physical int) {
+	return 0, 0
+}
+
+// stub
+func fdSectorSizes(fd uintptr) (logical, physical int) {
+	return 0, 0
+}
+
+// stub
+func statxAlignment(path string) int {
+	return 0
+}
+
+// stub
+func statxAlignmentFd(fd uintptr) int {
+	return 0
+}
+
+// stub
+func ioprioValue(class IOPriorityClass, level int) int {
+	return 0
+}
+
+// stub
+func setThreadIOPriority(prio int) (int, error) {
+	return 0, ErrUnsupportedDirectIO
+}
+
+// stub
+func dupFd(fd uintptr) (uintptr, error) {
+	return 0, ErrUnsupportedDirectIO
+}
+
+// stub
+func (d *DirectIO) dropBehind(off int64, n int) {}
+
+// stub
+func (d *DirectIO) evict(off, n int64) {}
+
+// stub
+func (d *DirectIO) writeDontCache(p []byte) (int, error) {
+	d.engine = EngineNoCache
+	return d.f.Write(p)
+}
@@ -0,0 +1,69 @@
+package directio
+
+import (
+	"archive/tar"
+	"os"
+)
+
+// TarWriter writes a tar archive to a file opened with O_DIRECT, so large
+// archives, like backups, don't fill the page cache. Use it as a
+// tar.Writer; Close ends the archive.
+type TarWriter struct {
+	*tar.Writer
+	d *DirectIO
+}
+
+// NewTarWriter returns a TarWriter writing to f from its current offset
+// through a 1MB buffer, with a writer configured by opts.
+func NewTarWriter(f *os.File, opts ...Option) (*TarWriter, error) {
+	d, err := NewSize(f, defaultCopyBufSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TarWriter{Writer: tar.NewWriter(d), d: d}, nil
+}
+
+// Close writes the end of the archive, then zero pads it to a whole number
+// of blocks of the file, so that even the end is written with O_DIRECT;
+// readers stop at the end marker and ignore the padding, like the padding
+// of tar records. It then closes the writer, not the file.
+func (t *TarWriter) Close() error {
+	if err := t.Writer.Close(); err != nil {
+		t.d.Close()
+		return err
+	}
+
+	if rem := int(t.d.LogicalOffset() % int64(t.d.BlockSize())); rem != 0 {
+		if _, err := t.d.Write(make([]byte, t.d.BlockSize()-rem)); err != nil {
+			t.d.Close()
+			return err
+		}
+	}
+
+	return t.d.Close()
+}
+
+// TarReader reads a tar archive from a file opened with O_DIRECT. Use it as
+// a tar.Reader.
+type TarReader struct {
+	*tar.Reader
+	r *DirectReader
+}
+
+// NewTarReader returns a TarReader reading f from its current offset
+// through a 1MB buffer, with a reader configured by opts, ReadAhead suiting
+// large archives.
+func NewTarReader(f *os.File, opts ...ReaderOption) (*TarReader, error) {
+	r, err := NewReaderSize(f, defaultCopyBufSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TarReader{Reader: tar.NewReader(r), r: r}, nil
+}
+
+// Close stops the prefetching of ReadAhead. It doesn't close the file.
+func (t *TarReader) Close() error {
+	return t.r.Close()
+}
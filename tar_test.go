@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestTar(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f := tmpFile(t, dir, "tar")
+	defer f.Close()
+
+	tw, err := NewTarWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make([][]byte, 5)
+	for i := range files {
+		files[i] = bytes.Repeat([]byte{byte('a' + i)}, 3000*i+11)
+		hdr := &tar.Header{Name: fmt.Sprintf("file%d", i), Mode: 0644, Size: int64(len(files[i]))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(files[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size()%4096 != 0 {
+		t.Fatalf("archive of %d bytes isn't block aligned", info.Size())
+	}
+
+	in, err := os.OpenFile(f.Name(), os.O_RDONLY|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	tr, err := NewTarReader(in, ReadAhead(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if i != len(files) {
+				t.Fatalf("got %d files, want %d", i, len(files))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != fmt.Sprintf("file%d", i) || !bytes.Equal(got, files[i]) {
+			t.Fatalf("entry %d: got %s, %d bytes", i, hdr.Name, len(got))
+		}
+	}
+}
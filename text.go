@@ -0,0 +1,47 @@
+package directio
+
+import (
+	"bufio"
+	"os"
+)
+
+// TextReader scans a text file, typically a log, line by line with O_DIRECT,
+// so that going through a huge cold file doesn't evict the page cache of
+// everything else. It is a bufio.Scanner over a DirectReader: lines are
+// split with bufio.ScanLines unless Split is called, and lines longer than
+// bufio.MaxScanTokenSize need a larger buffer set with Buffer.
+//
+//	t, err := directio.NewTextReader(f, directio.ReadAhead(2))
+//	if err != nil {
+//		return err
+//	}
+//	defer t.Close()
+//
+//	for t.Scan() {
+//		line := t.Text()
+//		...
+//	}
+//	if err := t.Err(); err != nil {
+//		return err
+//	}
+type TextReader struct {
+	*bufio.Scanner
+
+	r *DirectReader
+}
+
+// NewTextReader returns a TextReader scanning f from its current offset.
+// The file is read in chunks of 1MB.
+func NewTextReader(f *os.File, opts ...ReaderOption) (*TextReader, error) {
+	r, err := NewReaderSize(f, defaultCopyBufSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TextReader{Scanner: bufio.NewScanner(r), r: r}, nil
+}
+
+// Close stops the prefetching of ReadAhead. It doesn't close the file.
+func (t *TextReader) Close() error {
+	return t.r.Close()
+}
@@ -0,0 +1,130 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TuneOption configures TuneBufferSize.
+type TuneOption func(c *tuneConfig)
+
+type tuneConfig struct {
+	total int64
+	sizes []int
+}
+
+// TuneTotalSize sets how many bytes TuneBufferSize writes in all, split
+// evenly between the candidates, each writing at least one buffer. It
+// defaults to 256MB.
+func TuneTotalSize(n int64) TuneOption {
+	return func(c *tuneConfig) {
+		c.total = n
+	}
+}
+
+// TuneCandidates sets the buffer sizes TuneBufferSize tries. They default
+// to the powers of two from 64KB to 16MB.
+func TuneCandidates(sizes ...int) TuneOption {
+	return func(c *tuneConfig) {
+		c.sizes = sizes
+	}
+}
+
+// TuneBufferSize measures the write throughput of DirectIO writers with
+// different buffer sizes on the filesystem holding path, a directory or a
+// file in it, and returns the fastest size. Services can call it at startup
+// to tune themselves to their device.
+//
+// The data is written to an anonymous scratch file, which is gone when
+// TuneBufferSize returns.
+func TuneBufferSize(path string, opts ...TuneOption) (int, error) {
+	cfg := tuneConfig{total: 256 << 20}
+	for size := 64 << 10; size <= 16<<20; size <<= 1 {
+		cfg.sizes = append(cfg.sizes, size)
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(cfg.sizes) == 0 {
+		return 0, errors.New("no buffer sizes to try")
+	}
+
+	dir := path
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	f, err := openProbeFile(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	best, bestRate := 0, 0.0
+	for _, size := range cfg.sizes {
+		total := max(cfg.total/int64(len(cfg.sizes)), int64(size))
+		elapsed, err := tuneRun(f, size, total)
+		if err != nil {
+			return 0, err
+		}
+
+		if rate := float64(total) / elapsed.Seconds(); best == 0 || rate > bestRate {
+			best, bestRate = size, rate
+		}
+	}
+
+	return best, nil
+}
+
+// tuneRun writes total bytes to f from the start with a buffer of size
+// bytes and returns how long it took, up to the data being on disk.
+func tuneRun(f *os.File, size int, total int64) (time.Duration, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	d, err := NewSize(f, size)
+	if err != nil {
+		return 0, err
+	}
+
+	// Writes of exactly the buffer size from an aligned buffer take the
+	// zero-copy path, so what is measured is the device.
+	buf, err := allocAlignedBuf(d.blockSize, len(d.buf))
+	if err != nil {
+		return 0, err
+	}
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+
+	start := time.Now()
+	for written := int64(0); written < total; {
+		p := buf
+		if rest := total - written; int64(len(p)) > rest {
+			p = p[:rest]
+		}
+		n, err := d.Write(p)
+		if err != nil {
+			return 0, err
+		}
+		written += int64(n)
+	}
+	if err := d.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import "testing"
+
+func TestTuneBufferSize(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	sizes := []int{64 << 10, 256 << 10, 1 << 20}
+
+	size, err := TuneBufferSize(dir, TuneTotalSize(4<<20), TuneCandidates(sizes...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range sizes {
+		if s == size {
+			return
+		}
+	}
+	t.Fatalf("TuneBufferSize = %d, not one of %v", size, sizes)
+}
@@ -0,0 +1,140 @@
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"os"
+)
+
+// ErrContentMismatch is returned by UpdateAt and WriteBlockAt, with
+// UpdateExpect, when the file doesn't hold the expected data. Nothing is
+// written then.
+var ErrContentMismatch = errors.New("file content doesn't match the expected data")
+
+// UpdateOption configures UpdateAt and WriteBlockAt.
+type UpdateOption func(c *updateConfig)
+
+type updateConfig struct {
+	lock     func(off, length int64) (unlock func())
+	expected []byte
+}
+
+// UpdateLock makes UpdateAt call lock with the aligned range it is about to
+// read and write back, and the function lock returns once it is done, so
+// concurrent updates of bytes sharing a block don't undo each other.
+func UpdateLock(lock func(off, length int64) (unlock func())) UpdateOption {
+	return func(c *updateConfig) {
+		c.lock = lock
+	}
+}
+
+// UpdateExpect makes the update compare-and-write: the range is read first,
+// and only written if it holds expected, of the length of the update, else
+// ErrContentMismatch is returned. Writers sharing a file get optimistic
+// concurrency this way; with UpdateLock, the comparison and the write are
+// atomic against the other updates taking the lock.
+func UpdateExpect(expected []byte) UpdateOption {
+	return func(c *updateConfig) {
+		c.expected = expected
+	}
+}
+
+// UpdateAt writes p to f, opened read-write with O_DIRECT, at off, neither
+// of them needing to be aligned: the aligned blocks covering the range are
+// read, patched with p and written back, e.g. to update a header in place
+// in a file written with direct I/O. Bytes past the end of the file read as
+// zeros, and a regular file grown by the update ends right after p. Without
+// UpdateLock, concurrent updates of the same blocks race.
+func UpdateAt(f *os.File, off int64, p []byte, opts ...UpdateOption) error {
+	if off < 0 {
+		return errNegativePosition
+	}
+	if len(p) == 0 {
+		return nil
+	}
+
+	var cfg updateConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	a := cachedFdAlignment(f.Fd())
+	unit := int64(a.unit())
+
+	start := off - off%unit
+	end := off + int64(len(p))
+	if rem := end % unit; rem != 0 {
+		end += unit - rem
+	}
+
+	if cfg.lock != nil {
+		defer cfg.lock(start, end-start)()
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if cfg.expected != nil && len(cfg.expected) != len(p) {
+		return errors.New("expected data must be as long as the update")
+	}
+
+	if start == off && end == off+int64(len(p)) && align(p, a.blockSize) == 0 && cfg.expected == nil {
+		// Nothing to merge.
+		_, err := PWriteAligned(f, p, off)
+		return err
+	}
+
+	buf, err := allocAlignedBuf(a.blockSize, int(end-start))
+	if err != nil {
+		return err
+	}
+	for n := 0; n < len(buf); {
+		m, err := pread(f, buf[n:], start+int64(n))
+		if err != nil {
+			return err
+		}
+		if m < len(buf)-n {
+			// End of the file, the rest stays zero.
+			break
+		}
+		n += m
+	}
+	if cfg.expected != nil && !bytes.Equal(buf[off-start:][:len(p)], cfg.expected) {
+		return ErrContentMismatch
+	}
+	copy(buf[off-start:], p)
+
+	if _, err := PWriteAligned(f, buf, start); err != nil {
+		return err
+	}
+
+	// The padding of the last block must not grow the file.
+	if size := max(info.Size(), off+int64(len(p))); info.Mode().IsRegular() && end > size {
+		return f.Truncate(size)
+	}
+
+	return nil
+}
+
+// WriteBlockAt writes p as block idx of f, opened read-write with O_DIRECT,
+// blocks being len(p) bytes long: p is written at idx*len(p). The address
+// and length of p must meet the alignment of the file, or
+// ErrUnalignedBuffer is returned. It is meant for page stores sharing a
+// file, with UpdateExpect and UpdateLock.
+func WriteBlockAt(f *os.File, idx int64, p []byte, opts ...UpdateOption) error {
+	if idx < 0 {
+		return errNegativePosition
+	}
+	if len(p) == 0 {
+		return errors.New("block must not be empty")
+	}
+
+	a := cachedFdAlignment(f.Fd())
+	if len(p)%a.unit() != 0 || align(p, a.blockSize) != 0 {
+		return ErrUnalignedBuffer
+	}
+
+	return UpdateAt(f, idx*int64(len(p)), p, opts...)
+}
@@ -0,0 +1,112 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestUpdateAt(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	name := filepath.Join(dir, "update")
+	want := bytes.Repeat([]byte{'a'}, 10000)
+	if err := os.WriteFile(name, want, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR|O_DIRECT, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var mu sync.Mutex
+	locked := 0
+	lock := UpdateLock(func(off, length int64) func() {
+		mu.Lock()
+		locked++
+		return mu.Unlock
+	})
+
+	for _, u := range []struct {
+		off  int64
+		data string
+	}{
+		{3, "header"},
+		{4090, "across a block boundary"},
+		{9995, "past the end"},
+	} {
+		if err := UpdateAt(f, u.off, []byte(u.data), lock); err != nil {
+			t.Fatal(err)
+		}
+		if end := int(u.off) + len(u.data); end > len(want) {
+			want = append(want, make([]byte, end-len(want))...)
+		}
+		copy(want[u.off:], u.data)
+	}
+	if locked != 3 {
+		t.Fatalf("lock called %d times, want 3", locked)
+	}
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("file content mismatch, got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestWriteBlockAt(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, err := os.OpenFile(filepath.Join(dir, "blocks"), os.O_RDWR|os.O_CREATE|O_DIRECT, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	const size = 8192
+	v1, err := allocAlignedBuf(size, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := allocAlignedBuf(size, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range v1 {
+		v1[i], v2[i] = 1, 2
+	}
+
+	if err := WriteBlockAt(f, 0, v1[:100]); err != ErrUnalignedBuffer {
+		t.Fatalf("short block: got %v, want ErrUnalignedBuffer", err)
+	}
+	if err := WriteBlockAt(f, 2, v1, UpdateExpect(make([]byte, size))); err != nil {
+		t.Fatal(err)
+	}
+
+	// A writer still expecting the old content loses.
+	if err := WriteBlockAt(f, 2, v2, UpdateExpect(make([]byte, size))); err != ErrContentMismatch {
+		t.Fatalf("stale expectation: got %v, want ErrContentMismatch", err)
+	}
+	if err := WriteBlockAt(f, 2, v2, UpdateExpect(v1)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3*size || !bytes.Equal(got[2*size:], v2) || !bytes.Equal(got[:2*size], make([]byte, 2*size)) {
+		t.Fatalf("file content mismatch, got %d bytes", len(got))
+	}
+}
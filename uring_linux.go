@@ -0,0 +1,704 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The io_uring ABI, see io_uring_setup(2) and <linux/io_uring.h>.
+const (
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringEnterGetEvents = 1 << 0
+
+	uringRegisterFiles    = 2
+	uringRegisterPbufRing = 22
+
+	uringOpRead  = 22
+	uringOpWrite = 23
+
+	uringSQEFixedFile    = 1 << 0
+	uringSQEBufferSelect = 1 << 5
+
+	uringCQEBuffer      = 1 << 0
+	uringCQEBufferShift = 16
+
+	// uringMaxBufRing is the largest provided buffer ring.
+	uringMaxBufRing = 1 << 15
+
+	// defaultURingDepth is the default queue depth of a URing.
+	defaultURingDepth = 64
+)
+
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+type uringSQOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	flags       uint32
+	dropped     uint32
+	array       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+type uringCQOffsets struct {
+	head        uint32
+	tail        uint32
+	ringMask    uint32
+	ringEntries uint32
+	overflow    uint32
+	cqes        uint32
+	flags       uint32
+	resv1       uint32
+	userAddr    uint64
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	rwFlags     uint32
+	userData    uint64
+	bufIndex    uint16 // buf_group with IOSQE_BUFFER_SELECT
+	personality uint16
+	fileIndex   int32
+	addr3       uint64
+	pad         uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+type uringBufReg struct {
+	ringAddr    uint64
+	ringEntries uint32
+	bgid        uint16
+	flags       uint16
+	resv        [3]uint64
+}
+
+// uringBuf is an entry of a provided buffer ring. The resv field of the
+// first entry is the tail of the ring.
+type uringBuf struct {
+	addr uint64
+	len  uint32
+	bid  uint16
+	resv uint16
+}
+
+// URing is an io_uring instance queuing O_DIRECT reads and writes over any
+// number of files, e.g. the segment files of a log, and submitting them with
+// one system call per batch rather than one per block. Operations complete
+// in any order; Wait returns their completions. The buffers of queued and
+// in flight operations belong to the kernel until they complete. A URing is
+// not safe for concurrent use.
+type URing struct {
+	fd    int
+	depth int
+	batch int
+
+	// The rings and the submission queue entries, shared with the kernel.
+	sqMem, cqMem, sqeMem []byte
+
+	sqHead, sqTail *uint32
+	sqMask         uint32
+	sqArray        []uint32
+	sqes           []uringSQE
+
+	cqHead, cqTail *uint32
+	cqMask         uint32
+	cqes           []uringCQE
+
+	// tail is the submission queue tail, published to the kernel as
+	// entries are filled, queued how many of them weren't submitted yet.
+	tail   uint32
+	queued uint32
+
+	// ops holds what the operations not reaped yet refer to, keeping their
+	// buffers and files alive, by the ID given to the kernel.
+	ops  map[uint64]uringOp
+	next uint64
+
+	// done holds the completions reaped but not returned by Wait yet.
+	done []URingCompletion
+
+	files    bool
+	bufRings []*URingBufRing
+	isClosed bool
+
+	created              time.Time
+	submitted, completed int64
+	submits              int64
+}
+
+// uringOp is an operation queued on a URing.
+type uringOp struct {
+	user uint64
+	buf  []byte
+	f    *os.File
+	ring *URingBufRing
+}
+
+// URingFile names a file in the operations of a URing: either by its
+// descriptor, see File, or by its index among the files registered with
+// RegisterFiles.
+type URingFile struct {
+	fd    int32
+	fixed bool
+	f     *os.File
+}
+
+// URingCompletion is the outcome of an operation queued on a URing.
+type URingCompletion struct {
+	// User is the value given when the operation was queued.
+	User uint64
+
+	// N is the number of bytes read or written, Err the error of the
+	// operation, a syscall.Errno.
+	N   int
+	Err error
+
+	// Buf holds the data of a read of QueueReadBuffer, in the buffer the
+	// kernel picked from the ring, to be given back with Recycle.
+	Buf []byte
+
+	ring *URingBufRing
+	bid  uint16
+}
+
+// URingOption configures a URing.
+type URingOption func(r *URing)
+
+// URingQueueDepth sets the number of operations a URing queues at once,
+// rounded up to a power of two by the kernel, 64 by default. Twice as many
+// may be in flight. Deeper queues keep fast devices busier, at the cost of
+// the memory of the buffers in flight.
+func URingQueueDepth(n int) URingOption {
+	return func(r *URing) {
+		r.depth = n
+	}
+}
+
+// URingSubmitBatch makes a URing submit the queued operations on its own
+// once n are queued, trading the latency of the first ones for fewer system
+// calls. By default, operations are only submitted by Submit and Wait, or
+// when the queue is full.
+func URingSubmitBatch(n int) URingOption {
+	return func(r *URing) {
+		r.batch = n
+	}
+}
+
+// NewURing returns a URing with the options opts.
+func NewURing(opts ...URingOption) (*URing, error) {
+	r := &URing{depth: defaultURingDepth, ops: make(map[uint64]uringOp)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.depth <= 0 {
+		return nil, errors.New("queue depth must be greater than zero")
+	}
+	if r.batch < 0 {
+		return nil, errors.New("submit batch size must not be negative")
+	}
+
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(r.depth), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", errno)
+	}
+	r.fd = int(fd)
+	r.depth = int(p.sqEntries)
+	r.created = time.Now()
+
+	if err := r.mmap(&p); err != nil {
+		r.unmap()
+		unix.Close(r.fd)
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// mmap maps the rings set up by io_uring_setup.
+func (r *URing) mmap(p *uringParams) (err error) {
+	const prot, flags = unix.PROT_READ | unix.PROT_WRITE, unix.MAP_SHARED | unix.MAP_POPULATE
+
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	if r.sqMem, err = unix.Mmap(r.fd, uringOffSQRing, sqSize, prot, flags); err != nil {
+		return err
+	}
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	if r.cqMem, err = unix.Mmap(r.fd, uringOffCQRing, cqSize, prot, flags); err != nil {
+		return err
+	}
+	sqeSize := int(p.sqEntries) * int(unsafe.Sizeof(uringSQE{}))
+	if r.sqeMem, err = unix.Mmap(r.fd, uringOffSQEs, sqeSize, prot, flags); err != nil {
+		return err
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.array])), p.sqEntries)
+	r.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&r.sqeMem[0])), p.sqEntries)
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&r.cqMem[p.cqOff.cqes])), p.cqEntries)
+
+	r.tail = atomic.LoadUint32(r.sqTail)
+
+	return nil
+}
+
+// unmap releases the rings.
+func (r *URing) unmap() {
+	for _, m := range [][]byte{r.sqMem, r.cqMem, r.sqeMem} {
+		if m != nil {
+			unix.Munmap(m)
+		}
+	}
+	r.sqMem, r.cqMem, r.sqeMem = nil, nil, nil
+}
+
+// File returns the handle naming f by its descriptor. f must stay open
+// while operations on it are in flight.
+func (r *URing) File(f *os.File) URingFile {
+	return URingFile{fd: int32(f.Fd()), f: f}
+}
+
+// RegisterFiles registers files with the ring (IORING_REGISTER_FILES) and
+// returns the handles naming them by their index among them. The kernel
+// then neither looks the descriptor up nor takes a reference on the file
+// for every operation, which with small blocks over many files is a good
+// part of the cost of a submission. The ring keeps the files open until it
+// is closed. Files can only be registered once per ring.
+func (r *URing) RegisterFiles(files ...*os.File) ([]URingFile, error) {
+	if r.isClosed {
+		return nil, errors.New("the ring is closed")
+	}
+	if r.files {
+		return nil, errors.New("files are already registered")
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	fds := make([]int32, len(files))
+	for i, f := range files {
+		fds[i] = int32(f.Fd())
+	}
+	if err := r.register(uringRegisterFiles, unsafe.Pointer(&fds[0]), len(fds)); err != nil {
+		return nil, err
+	}
+	r.files = true
+
+	hs := make([]URingFile, len(files))
+	for i := range hs {
+		hs[i] = URingFile{fd: int32(i), fixed: true}
+	}
+
+	return hs, nil
+}
+
+// register runs io_uring_register(2).
+func (r *URing) register(op uintptr, arg unsafe.Pointer, n int) error {
+	_, _, errno := unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(r.fd), op, uintptr(arg), uintptr(n), 0, 0)
+	if errno != 0 {
+		return os.NewSyscallError("io_uring_register", errno)
+	}
+
+	return nil
+}
+
+// QueueWrite queues the write of p at off in the file h. p must be aligned
+// for O_DIRECT, and is not to be touched until the write completes.
+func (r *URing) QueueWrite(h URingFile, p []byte, off int64, user uint64) error {
+	return r.queue(h, uringOpWrite, p, len(p), off, user, nil)
+}
+
+// QueueRead queues the read of len(p) bytes at off in the file h into p,
+// which must be aligned for O_DIRECT.
+func (r *URing) QueueRead(h URingFile, p []byte, off int64, user uint64) error {
+	return r.queue(h, uringOpRead, p, len(p), off, user, nil)
+}
+
+// queue fills the next submission queue entry with an operation of n bytes
+// at off on h, into buf or into a buffer of ring, submitting the queued
+// entries first if the queue is full.
+// It waits for completions first too when as many operations are in flight
+// as the completion queue holds, so that none is lost.
+func (r *URing) queue(h URingFile, opcode uint8, buf []byte, n int, off int64, user uint64, ring *URingBufRing) error {
+	if r.isClosed {
+		return errors.New("the ring is closed")
+	}
+	if off < 0 {
+		return errNegativePosition
+	}
+
+	if r.tail-atomic.LoadUint32(r.sqHead) == uint32(len(r.sqes)) {
+		if err := r.Submit(); err != nil {
+			return err
+		}
+		if r.tail-atomic.LoadUint32(r.sqHead) == uint32(len(r.sqes)) {
+			return errors.New("submission queue is full")
+		}
+	}
+	for len(r.ops) >= len(r.cqes) {
+		if err := r.enter(1, uringEnterGetEvents); err != nil {
+			return err
+		}
+		r.reap()
+	}
+
+	r.next++
+	r.ops[r.next] = uringOp{user: user, buf: buf, f: h.f, ring: ring}
+
+	idx := r.tail & r.sqMask
+	sqe := &r.sqes[idx]
+	*sqe = uringSQE{
+		opcode:   opcode,
+		fd:       h.fd,
+		off:      uint64(off),
+		len:      uint32(n),
+		userData: r.next,
+	}
+	if len(buf) > 0 {
+		sqe.addr = uint64(uintptr(unsafe.Pointer(&buf[0])))
+	}
+	if h.fixed {
+		sqe.flags |= uringSQEFixedFile
+	}
+	if ring != nil {
+		sqe.flags |= uringSQEBufferSelect
+		sqe.bufIndex = ring.group
+	}
+	r.sqArray[idx] = idx
+
+	r.tail++
+	atomic.StoreUint32(r.sqTail, r.tail)
+	r.queued++
+
+	if r.batch > 0 && int(r.queued) >= r.batch {
+		return r.enter(0, 0)
+	}
+
+	return nil
+}
+
+// Submit hands the queued operations over to the kernel without waiting for
+// them. Wait submits them too.
+func (r *URing) Submit() error {
+	if r.isClosed {
+		return errors.New("the ring is closed")
+	}
+
+	return r.enter(0, 0)
+}
+
+// enter submits the queued operations and waits for wait completions.
+func (r *URing) enter(wait uint32, flags uintptr) error {
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(r.queued), uintptr(wait), flags, 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return os.NewSyscallError("io_uring_enter", errno)
+		}
+		r.queued -= uint32(n)
+		if n > 0 {
+			r.submitted += int64(n)
+			r.submits++
+		}
+
+		return nil
+	}
+}
+
+// reap takes the available completions off the completion queue.
+func (r *URing) reap() {
+	head := atomic.LoadUint32(r.cqHead)
+	tail := atomic.LoadUint32(r.cqTail)
+
+	for ; head != tail; head++ {
+		cqe := r.cqes[head&r.cqMask]
+		op := r.ops[cqe.userData]
+		delete(r.ops, cqe.userData)
+		r.completed++
+
+		c := URingCompletion{User: op.user}
+		if cqe.res < 0 {
+			c.Err = syscall.Errno(-cqe.res)
+		} else {
+			c.N = int(cqe.res)
+		}
+		if op.ring != nil && cqe.flags&uringCQEBuffer != 0 {
+			c.ring, c.bid = op.ring, uint16(cqe.flags>>uringCQEBufferShift)
+			c.Buf = op.ring.bufs[c.bid][:c.N]
+		}
+		r.done = append(r.done, c)
+	}
+
+	atomic.StoreUint32(r.cqHead, head)
+}
+
+// Wait submits the queued operations, waits until at least n operations
+// completed, fewer if not as many are in flight, and returns the
+// completions available.
+func (r *URing) Wait(n int) ([]URingCompletion, error) {
+	if r.isClosed {
+		return nil, errors.New("the ring is closed")
+	}
+	n = min(n, len(r.ops)+len(r.done))
+
+	r.reap()
+	for len(r.done) < n {
+		if err := r.enter(uint32(n-len(r.done)), uringEnterGetEvents); err != nil {
+			return nil, err
+		}
+		r.reap()
+	}
+	if r.queued > 0 {
+		if err := r.enter(0, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	done := r.done
+	r.done = nil
+
+	return done, nil
+}
+
+// InFlight returns the number of operations queued and not completed yet.
+func (r *URing) InFlight() int { return len(r.ops) }
+
+// URingStats are the counters of a URing, e.g. to tune its queue depth and
+// submit batch size for a device.
+type URingStats struct {
+	// Depth is the queue depth in effect, Batch the submit batch size.
+	Depth int
+	Batch int
+
+	// InFlight is the number of operations queued or submitted, and not
+	// completed yet. Queued counts those of them not submitted yet.
+	InFlight int
+	Queued   int
+
+	// Submitted and Completed count the operations handed to the kernel and
+	// completed since the ring was created, Submits the system calls that
+	// submitted them.
+	Submitted int64
+	Completed int64
+	Submits   int64
+
+	// Elapsed is the time since the ring was created.
+	Elapsed time.Duration
+}
+
+// SubmitRate returns the operations submitted per second.
+func (s URingStats) SubmitRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(s.Submitted) / s.Elapsed.Seconds()
+}
+
+// CompleteRate returns the operations completed per second.
+func (s URingStats) CompleteRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(s.Completed) / s.Elapsed.Seconds()
+}
+
+// Stats returns the current counters of the ring.
+func (r *URing) Stats() URingStats {
+	return URingStats{
+		Depth:     r.depth,
+		Batch:     r.batch,
+		InFlight:  len(r.ops),
+		Queued:    int(r.queued),
+		Submitted: r.submitted,
+		Completed: r.completed,
+		Submits:   r.submits,
+		Elapsed:   time.Since(r.created),
+	}
+}
+
+// Close waits for the operations in flight, then releases the ring and the
+// files registered with it. The completions not returned by Wait yet are
+// dropped.
+func (r *URing) Close() error {
+	if r.isClosed {
+		return errors.New("the ring is already closed")
+	}
+
+	var err error
+	for len(r.ops) > 0 && err == nil {
+		err = r.enter(1, uringEnterGetEvents)
+		r.reap()
+	}
+	r.isClosed = true
+	r.done = nil
+
+	r.unmap()
+	if cerr := unix.Close(r.fd); err == nil {
+		err = cerr
+	}
+	// The kernel let go of the buffer rings with the ring.
+	for _, b := range r.bufRings {
+		unix.Munmap(b.mem)
+	}
+	r.bufRings = nil
+
+	return err
+}
+
+// URingBufRing is a ring of aligned buffers provided to the kernel
+// (IORING_REGISTER_PBUF_RING) for the reads of QueueReadBuffer: they don't
+// name a buffer, the kernel picks one from the ring when it has the data,
+// and the completion holds it. A scanner keeping many random reads in
+// flight thus needs no buffer per read, its memory stays at the buffers of
+// the ring whatever the queue depth.
+type URingBufRing struct {
+	group uint16
+	size  int
+
+	// mem holds the entries of the ring, shared with the kernel, bufs the
+	// buffers by ID.
+	mem  []byte
+	ring []uringBuf
+	bufs [][]byte
+	tail uint16
+}
+
+// RegisterBufRing registers a ring of count buffers of size bytes, aligned
+// for O_DIRECT, as the buffer group group. count must be a power of two, up
+// to 32768, and size a multiple of the alignment of the files read. It needs
+// Linux 5.19 or later.
+func (r *URing) RegisterBufRing(group uint16, count, size int) (*URingBufRing, error) {
+	if r.isClosed {
+		return nil, errors.New("the ring is closed")
+	}
+	if count <= 0 || count > uringMaxBufRing || count&(count-1) != 0 {
+		return nil, errors.New("buffer count must be a power of two of at most 32768")
+	}
+	if size <= 0 {
+		return nil, errors.New("buffer size must be greater than zero")
+	}
+
+	b := &URingBufRing{group: group, size: size, bufs: make([][]byte, count)}
+	for i := range b.bufs {
+		buf, err := allocAlignedBuf(config().FallbackAlignment, size)
+		if err != nil {
+			return nil, err
+		}
+		b.bufs[i] = buf
+	}
+
+	mem, err := unix.Mmap(-1, 0, count*int(unsafe.Sizeof(uringBuf{})), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	b.mem = mem
+	b.ring = unsafe.Slice((*uringBuf)(unsafe.Pointer(&mem[0])), count)
+
+	reg := uringBufReg{
+		ringAddr:    uint64(uintptr(unsafe.Pointer(&mem[0]))),
+		ringEntries: uint32(count),
+		bgid:        group,
+	}
+	if err := r.register(uringRegisterPbufRing, unsafe.Pointer(&reg), 1); err != nil {
+		unix.Munmap(mem)
+		return nil, err
+	}
+	r.bufRings = append(r.bufRings, b)
+
+	for i := range b.bufs {
+		b.provide(uint16(i))
+	}
+
+	return b, nil
+}
+
+// provide hands buffer bid over to the kernel.
+func (b *URingBufRing) provide(bid uint16) {
+	e := &b.ring[b.tail&uint16(len(b.ring)-1)]
+	// Field by field: the resv field of the first entry is the tail.
+	e.addr = uint64(uintptr(unsafe.Pointer(&b.bufs[bid][0])))
+	e.len = uint32(b.size)
+	e.bid = bid
+	b.tail++
+
+	// The tail is published with a release store covering the entries. The
+	// 16 bits of it share a 32 bits word with the ID of the first entry.
+	var w [4]byte
+	binary.NativeEndian.PutUint16(w[0:2], b.ring[0].bid)
+	binary.NativeEndian.PutUint16(w[2:4], b.tail)
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(&b.mem[12])), binary.NativeEndian.Uint32(w[:]))
+}
+
+// Size returns the size of the buffers of the ring.
+func (b *URingBufRing) Size() int { return b.size }
+
+// Recycle gives the buffer of the completion c back to the ring, for the
+// kernel to fill again. c.Buf must not be used afterwards.
+func (b *URingBufRing) Recycle(c URingCompletion) error {
+	if c.ring != b {
+		return errors.New("the completion holds no buffer of the ring")
+	}
+	b.provide(c.bid)
+
+	return nil
+}
+
+// QueueReadBuffer queues the read of n bytes at off in the file h into a
+// buffer the kernel picks from b when the read is issued. n must not exceed
+// the size of the buffers. The read fails with ENOBUFS if the ring is empty
+// then, all its buffers being held by completions not recycled yet.
+func (r *URing) QueueReadBuffer(h URingFile, b *URingBufRing, n int, off int64, user uint64) error {
+	if n <= 0 || n > b.size {
+		return errors.New("read size must be between 1 and the buffer size")
+	}
+
+	return r.queue(h, uringOpRead, nil, n, off, user, b)
+}
@@ -0,0 +1,270 @@
+//go:build linux
+// +build linux
+
+package directio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// newTestURing returns a URing, skipping the test where io_uring is disabled.
+func newTestURing(t *testing.T, opts ...URingOption) *URing {
+	r, err := NewURing(opts...)
+	if errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EPERM) {
+		t.Skip("no io_uring:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestURingFixedFiles(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	r := newTestURing(t, URingQueueDepth(8))
+	defer r.Close()
+
+	// Several segment files, written through their registered indices.
+	var files []*os.File
+	for i := 0; i < 3; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("segment-%d", i)), os.O_RDWR|os.O_CREATE|O_DIRECT, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	hs, err := r.RegisterFiles(files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RegisterFiles(files...); err == nil {
+		t.Fatal("files registered twice")
+	}
+
+	const blockSize, blocks = 4096, 10
+	bufs := make([][]byte, blocks)
+	for i := range bufs {
+		if bufs[i], err = allocAlignedBuf(blockSize, blockSize); err != nil {
+			t.Fatal(err)
+		}
+		for j := range bufs[i] {
+			bufs[i][j] = byte(i)
+		}
+	}
+
+	// More blocks than the queue holds, so some submit on their own.
+	for i := range bufs {
+		h := hs[i%len(hs)]
+		if err := r.QueueWrite(h, bufs[i], int64(i/len(hs))*blockSize, uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := make(map[uint64]bool)
+	for len(seen) < blocks {
+		cs, err := r.Wait(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cs {
+			if c.Err != nil || c.N != blockSize {
+				t.Fatalf("write %d: %d bytes, %v", c.User, c.N, c.Err)
+			}
+			seen[c.User] = true
+		}
+	}
+	if r.InFlight() != 0 {
+		t.Fatalf("%d operations still in flight", r.InFlight())
+	}
+
+	got, err := allocAlignedBuf(blockSize, blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range bufs {
+		if _, err := files[i%len(hs)].ReadAt(got, int64(i/len(hs))*blockSize); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, bufs[i]) {
+			t.Fatalf("block %d wasn't written", i)
+		}
+	}
+
+	// Reads by descriptor, and the error of an unaligned one.
+	buf, err := allocAlignedBuf(blockSize, 2*blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.QueueRead(r.File(files[1]), buf[:blockSize], blockSize, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.QueueRead(r.File(files[1]), buf[blockSize+1:], 0, 2); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := r.Wait(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 2 {
+		t.Fatalf("got %d completions, want 2", len(cs))
+	}
+	for _, c := range cs {
+		switch c.User {
+		case 1:
+			if c.Err != nil || !bytes.Equal(buf[:blockSize], bufs[4]) {
+				t.Fatalf("read by descriptor: %d bytes, %v", c.N, c.Err)
+			}
+		case 2:
+			if !errors.Is(c.Err, syscall.EINVAL) {
+				t.Fatalf("unaligned read: %d bytes, %v", c.N, c.Err)
+			}
+		}
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.QueueRead(hs[0], buf, 0, 0); err == nil {
+		t.Fatal("read queued on a closed ring")
+	}
+}
+
+func TestURingBufRing(t *testing.T) {
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	f, data := readerFile(t, dir, 8*4096)
+	defer f.Close()
+
+	r := newTestURing(t, URingQueueDepth(16))
+	defer r.Close()
+
+	if _, err := r.RegisterBufRing(1, 3, 4096); err == nil {
+		t.Fatal("buffer count not a power of two accepted")
+	}
+	b, err := r.RegisterBufRing(1, 4, 4096)
+	if errors.Is(err, syscall.EINVAL) {
+		t.Skip("no provided buffer rings:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Twice as many reads as buffers, recycling them in between.
+	h := r.File(f)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 4; i++ {
+			blk := round*4 + i
+			if err := r.QueueReadBuffer(h, b, 4096, int64(blk)*4096, uint64(blk)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cs, err := r.Wait(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cs {
+			if c.Err != nil || c.N != 4096 {
+				t.Fatalf("read %d: %d bytes, %v", c.User, c.N, c.Err)
+			}
+			if off := int(c.User) * 4096; !bytes.Equal(c.Buf, data[off:off+4096]) {
+				t.Fatalf("read %d: wrong data", c.User)
+			}
+			if err := b.Recycle(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Without recycling, a fifth read finds the ring empty.
+	var held []URingCompletion
+	for i := 0; i < 5; i++ {
+		if err := r.QueueReadBuffer(h, b, 4096, 0, uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+		cs, err := r.Wait(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, cs...)
+	}
+	var nobufs int
+	for _, c := range held {
+		if errors.Is(c.Err, syscall.ENOBUFS) {
+			nobufs++
+		} else if c.Err != nil {
+			t.Fatal(c.Err)
+		}
+	}
+	if nobufs != 1 {
+		t.Fatalf("%d reads failed with ENOBUFS, want 1", nobufs)
+	}
+	if err := b.Recycle(URingCompletion{}); err == nil {
+		t.Fatal("completion without a buffer recycled")
+	}
+}
+
+func TestURingSubmitBatch(t *testing.T) {
+	if _, err := NewURing(URingQueueDepth(0)); err == nil {
+		t.Fatal("ring created without a queue")
+	}
+
+	dir, clean := tmpDir(t)
+	defer clean()
+
+	r := newTestURing(t, URingQueueDepth(8), URingSubmitBatch(3))
+	defer r.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, "batch"), os.O_RDWR|os.O_CREATE|O_DIRECT, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	const blockSize = 4096
+	buf, err := allocAlignedBuf(blockSize, 4*blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The third write submits the batch, the fourth waits for Submit.
+	for i := 0; i < 4; i++ {
+		if err := r.QueueWrite(r.File(f), buf[i*blockSize:(i+1)*blockSize], int64(i)*blockSize, uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+		s := r.Stats()
+		if want := int64(i+1) / 3 * 3; s.Submitted != want {
+			t.Fatalf("after %d writes: %d submitted, want %d", i+1, s.Submitted, want)
+		}
+		if s.InFlight != i+1 {
+			t.Fatalf("after %d writes: %d in flight", i+1, s.InFlight)
+		}
+	}
+	if s := r.Stats(); s.Queued != 1 || s.Submits != 1 || s.Depth != 8 || s.Batch != 3 {
+		t.Fatalf("stats before Submit: %+v", s)
+	}
+
+	for done := 0; done < 4; {
+		cs, err := r.Wait(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done += len(cs)
+	}
+	s := r.Stats()
+	if s.Submitted != 4 || s.Completed != 4 || s.InFlight != 0 || s.Queued != 0 {
+		t.Fatalf("stats after Wait: %+v", s)
+	}
+	if s.SubmitRate() <= 0 || s.CompleteRate() <= 0 {
+		t.Fatalf("rates: %v submitted/s, %v completed/s", s.SubmitRate(), s.CompleteRate())
+	}
+}
@@ -0,0 +1,85 @@
+package directio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// CorruptionError is returned by a writer created with WithVerify when data
+// read back from the file differs from what was written.
+type CorruptionError struct {
+	// Offset is the file offset of the first mismatching byte.
+	Offset int64
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("read-back verification failed at offset %d", e.Offset)
+}
+
+// verifyRange re-reads the range of the file p was just written to with
+// O_DIRECT and compares it with p. The range doesn't need to be aligned, the
+// covering blocks are read into the scratch buffer.
+func (d *DirectIO) verifyRange(p []byte, off int64) error {
+	if d.verifyF == nil {
+		f, err := reopenDirect(d.f.Fd())
+		if err != nil {
+			return err
+		}
+		d.verifyF = f
+	}
+
+	if d.scratch == nil {
+		buf, err := allocAlignedBuf(d.blockSize, alignUp(len(d.buf)+d.blockSize, d.blockSize))
+		if err != nil {
+			return err
+		}
+		d.scratch = buf
+	}
+
+	bs := int64(d.blockSize)
+	for len(p) > 0 {
+		start := off - off%bs
+		head := int(off - start)
+
+		chunk := len(p)
+		if chunk > len(d.scratch)-head {
+			chunk = len(d.scratch) - head
+		}
+
+		size := alignUp(head+chunk, d.blockSize)
+		n, err := d.verifyF.ReadAt(d.scratch[:size], start)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		var got []byte
+		if n > head {
+			got = d.scratch[head:n]
+		}
+		if len(got) > chunk {
+			got = got[:chunk]
+		}
+
+		if !bytes.Equal(got, p[:chunk]) {
+			i := 0
+			for i < len(got) && got[i] == p[i] {
+				i++
+			}
+			return &CorruptionError{Offset: off + int64(i)}
+		}
+
+		p = p[chunk:]
+		off += int64(chunk)
+	}
+
+	return nil
+}
+
+// releaseVerify closes the file descriptor used for read-back verification.
+func (d *DirectIO) releaseVerify() {
+	if d.verifyF != nil {
+		d.verifyF.Close()
+		d.verifyF = nil
+	}
+}
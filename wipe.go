@@ -0,0 +1,112 @@
+package directio
+
+import (
+	"crypto/rand"
+	"os"
+)
+
+// WipeOption configures Wipe.
+type WipeOption func(c *wipeConfig)
+
+type wipeConfig struct {
+	random   bool
+	discard  bool
+	bufSize  int
+	progress func(pass int, done, total int64)
+}
+
+// WipeRandom makes Wipe write random data instead of zeros.
+func WipeRandom(enabled bool) WipeOption {
+	return func(c *wipeConfig) {
+		c.random = enabled
+	}
+}
+
+// WipeDiscard makes Wipe discard a block device with BLKDISCARD once all
+// passes are done. It is ignored for regular files.
+func WipeDiscard(enabled bool) WipeOption {
+	return func(c *wipeConfig) {
+		c.discard = enabled
+	}
+}
+
+// WipeBufferSize sets the size of the aligned writes, 1MB by default.
+func WipeBufferSize(n int) WipeOption {
+	return func(c *wipeConfig) {
+		c.bufSize = n
+	}
+}
+
+// WipeProgress sets a function called after every write with the current
+// pass, starting from 1, the bytes written so far in the pass and the size
+// of the target.
+func WipeProgress(fn func(pass int, done, total int64)) WipeOption {
+	return func(c *wipeConfig) {
+		c.progress = fn
+	}
+}
+
+// Wipe overwrites the whole of f, a regular file or a block device, passes
+// times with zeros, or random data with WipeRandom, and syncs it after each
+// pass. f must be opened for writing with O_DIRECT. The last partial block of
+// a regular file is written padded, and the file is then truncated back to
+// its size.
+//
+// Note that on SSDs and copy on write filesystems overwriting doesn't
+// guarantee the old data is physically gone.
+func Wipe(f *os.File, passes int, opts ...WipeOption) error {
+	var cfg wipeConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	blockSize, size, err := patternTarget(f, 0)
+	if err != nil {
+		return err
+	}
+	if !isBlockDevice(info) {
+		size = int64(alignUp(int(info.Size()), blockSize))
+	}
+
+	fill := PatternByte(0)
+	if cfg.random {
+		fill = func(buf []byte, off int64) {
+			rand.Read(buf)
+		}
+	}
+
+	for pass := 1; pass <= passes; pass++ {
+		popts := []PatternOption{PatternBufferSize(cfg.bufSize)}
+		if cfg.progress != nil {
+			pass := pass
+			popts = append(popts, PatternProgress(func(done, total int64) {
+				cfg.progress(pass, done, total)
+			}))
+		}
+
+		if _, err := WritePattern(f, size, fill, popts...); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if isBlockDevice(info) {
+		if cfg.discard {
+			return discardDevice(f.Fd(), 0, size)
+		}
+		return nil
+	}
+
+	if size != info.Size() {
+		return f.Truncate(info.Size())
+	}
+
+	return nil
+}